@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"regexp"
 	"time"
@@ -10,20 +9,23 @@ import (
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	jwt "github.com/golang-jwt/jwt/v4"
-	"github.com/lestrrat/go-jwx/jwk"
 	appConfig "github.com/unitypark/cloudfront-authorization-at-edge/api/internal/config"
+	"github.com/unitypark/cloudfront-authorization-at-edge/api/internal/jwks"
 	zapLogger "github.com/unitypark/cloudfront-authorization-at-edge/api/internal/logger"
 	"go.uber.org/zap"
 )
 
 var (
 	config                 *appConfig.Config
+	jwksCache              *jwks.Cache
 	accessTokenCookieRegex = regexp.MustCompile(`ACCESS-TOKEN=(.*?);`)
 )
 
 func init() {
 	config = appConfig.New()
 	zapLogger.Init(config.Env)
+	// keys of the user pool are cached for the lifetime of the lambda instead of being fetched for every token
+	jwksCache = jwks.New(config.JwksUrl, jwks.DEFAULT_TTL, jwks.DEFAULT_REFRESH_INTERVAL)
 	zap.L().Info("lambda cold start")
 }
 
@@ -60,21 +62,7 @@ func handler(ctx context.Context, req events.APIGatewayV2CustomAuthorizerV2Reque
 }
 
 func parseToken(token string) (*jwt.Token, error) {
-	return jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		set, err := jwk.FetchHTTP(config.JwksUrl)
-		if err != nil {
-			return nil, err
-		}
-
-		keyID, ok := token.Header["kid"].(string)
-		if !ok {
-			return nil, errors.New("expecting JWT header to have string kid")
-		}
-		if key := set.LookupKeyID(keyID); len(key) == 1 {
-			return key[0].Materialize()
-		}
-		return nil, errors.New("unable to find key")
-	})
+	return jwt.Parse(token, jwksCache.Keyfunc, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}))
 }
 
 func findAuthHeader(headers map[string]string, authHeaderNames []string) string {
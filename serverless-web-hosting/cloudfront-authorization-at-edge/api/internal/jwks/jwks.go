@@ -0,0 +1,142 @@
+// Package jwks is a copy of serverless-file-share/lambda/api/internal/jwks, whose tests cover it. Changes are
+// made there and copied to the other examples, which are deployed on their own.
+package jwks
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/lestrrat/go-jwx/jwk"
+	"go.uber.org/zap"
+)
+
+const (
+	// keys are fetched again after this time, so that rotated keys are picked up
+	DEFAULT_TTL time.Duration = time.Hour
+	// keys are fetched at most once per interval, so that tokens with unknown key ids cannot flood the user pool
+	DEFAULT_REFRESH_INTERVAL time.Duration = time.Minute
+	FETCH_TIMEOUT            time.Duration = 5 * time.Second
+	MAX_JWKS_SIZE_IN_BYTES   int64         = 1024 * 1024
+)
+
+// ErrKeyNotFound is returned, if a token is signed by a key, which is not in the key set
+var ErrKeyNotFound = errors.New("unable to find key")
+
+// Cache keeps the key set of a user pool for the lifetime of the lambda. The keys are fetched again after their
+// ttl, or if a token is signed by an unknown key, which happens after the keys are rotated. If the keys cannot be
+// fetched, the keys fetched before are used until they can be fetched again. Concurrent requests wait for the
+// same fetch, which runs without holding the lock.
+type Cache struct {
+	url             string
+	ttl             time.Duration
+	refreshInterval time.Duration
+	client          *http.Client
+	mu              sync.Mutex
+	keys            *jwk.Set
+	fetchedAt       time.Time
+	attemptedAt     time.Time
+	// error of the last fetch, it is returned until the keys are fetched
+	err error
+	// closed, once the running fetch is finished
+	fetching chan struct{}
+}
+
+func New(url string, ttl, refreshInterval time.Duration) *Cache {
+	return &Cache{
+		url:             url,
+		ttl:             ttl,
+		refreshInterval: refreshInterval,
+		client:          &http.Client{Timeout: FETCH_TIMEOUT},
+	}
+}
+
+// Keyfunc returns the public key of the key id in the header of the token, it is passed to jwt.Parse
+func (c *Cache) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, errors.New("expecting JWT header to have string kid")
+	}
+	return c.PublicKey(kid)
+}
+
+// PublicKey returns the public key of given key id
+func (c *Cache) PublicKey(kid string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := c.lookup(kid)
+	if key != nil && time.Since(c.fetchedAt) < c.ttl {
+		return key.Materialize()
+	}
+	// expired keys and unknown key ids are refreshed at most once per interval. Without keys, the error of the
+	// last fetch is returned within the interval, so that an outage of the user pool is not called per request.
+	if c.fetching != nil || time.Since(c.attemptedAt) >= c.refreshInterval {
+		c.refresh()
+		key = c.lookup(kid)
+	}
+	if c.keys == nil {
+		return nil, c.err
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, kid)
+	}
+	return key.Materialize()
+}
+
+// refresh fetches the keys or waits for the running fetch. It is called with the lock held, which is released
+// while the keys are fetched.
+func (c *Cache) refresh() {
+	if fetching := c.fetching; fetching != nil {
+		c.mu.Unlock()
+		<-fetching
+		c.mu.Lock()
+		return
+	}
+	fetching := make(chan struct{})
+	c.fetching = fetching
+	c.attemptedAt = time.Now()
+	c.mu.Unlock()
+	keys, err := c.fetch()
+	c.mu.Lock()
+	c.fetching = nil
+	close(fetching)
+	if err != nil {
+		c.err = err
+		if c.keys != nil {
+			zap.L().Warn("failed to refresh jwks, keys fetched before are used", zap.String("url", c.url), zap.Time("fetchedAt", c.fetchedAt), zap.Error(err))
+		}
+		return
+	}
+	c.keys, c.err = keys, nil
+	c.fetchedAt = time.Now()
+}
+
+func (c *Cache) lookup(kid string) jwk.Key {
+	if c.keys == nil {
+		return nil
+	}
+	if keys := c.keys.LookupKeyID(kid); len(keys) == 1 {
+		return keys[0]
+	}
+	return nil
+}
+
+func (c *Cache) fetch() (*jwk.Set, error) {
+	res, err := c.client.Get(c.url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch jwks: status %d", res.StatusCode)
+	}
+	buf, err := io.ReadAll(io.LimitReader(res.Body, MAX_JWKS_SIZE_IN_BYTES))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jwks: %v", err)
+	}
+	return jwk.Parse(buf)
+}
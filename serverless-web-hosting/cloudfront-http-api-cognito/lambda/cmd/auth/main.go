@@ -2,15 +2,14 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	jwt "github.com/golang-jwt/jwt/v4"
-	"github.com/lestrrat/go-jwx/jwk"
 	appConfig "github.com/unitypark/cloudfront-http-api-cognito/internal/config"
+	"github.com/unitypark/cloudfront-http-api-cognito/internal/jwks"
 	zapLogger "github.com/unitypark/cloudfront-http-api-cognito/internal/logger"
 	"go.uber.org/zap"
 )
@@ -20,12 +19,15 @@ const (
 )
 
 var (
-	config *appConfig.Config
+	config    *appConfig.Config
+	jwksCache *jwks.Cache
 )
 
 func init() {
 	config = appConfig.New()
 	zapLogger.Init(config.Env)
+	// keys of the user pool are cached for the lifetime of the lambda instead of being fetched for every token
+	jwksCache = jwks.New(config.JwksUrl, jwks.DEFAULT_TTL, jwks.DEFAULT_REFRESH_INTERVAL)
 	zap.L().Info("lambda cold start")
 }
 
@@ -61,22 +63,7 @@ func generateResponse(isAuthorized bool, mapClaims jwt.MapClaims) events.APIGate
 }
 
 func validateIdToken(token string, isAdmin bool) (jwt.MapClaims, bool, error) {
-	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		set, err := jwk.FetchHTTP(config.JwksUrl)
-		if err != nil {
-			return nil, err
-		}
-
-		keyID, ok := token.Header["kid"].(string)
-		if !ok {
-			return nil, errors.New("expecting JWT header to have string kid")
-		}
-
-		if key := set.LookupKeyID(keyID); len(key) == 1 {
-			return key[0].Materialize()
-		}
-		return nil, errors.New("unable to find key")
-	})
+	parsedToken, err := jwt.Parse(token, jwksCache.Keyfunc, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}))
 	if err != nil {
 		return nil, isAdmin, err
 	}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -11,8 +10,8 @@ import (
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	jwt "github.com/golang-jwt/jwt/v4"
-	"github.com/lestrrat/go-jwx/jwk"
 	appConfig "github.com/unitypark/secure-cloudfront-http-api-cognito/lambda/internal/config"
+	"github.com/unitypark/secure-cloudfront-http-api-cognito/lambda/internal/jwks"
 	zapLogger "github.com/unitypark/secure-cloudfront-http-api-cognito/lambda/internal/logger"
 	"go.uber.org/zap"
 )
@@ -23,12 +22,15 @@ const (
 
 var (
 	config      *appConfig.Config
+	jwksCache   *jwks.Cache
 	cookieRegex = regexp.MustCompile(`idToken=(.+?)(;)`)
 )
 
 func init() {
 	config = appConfig.New()
 	zapLogger.Init(config.Env)
+	// keys of the user pool are cached for the lifetime of the lambda instead of being fetched for every token
+	jwksCache = jwks.New(config.JwksUrl, jwks.DEFAULT_TTL, jwks.DEFAULT_REFRESH_INTERVAL)
 	zap.L().Info("lambda cold start")
 }
 
@@ -79,22 +81,7 @@ func getContext(mapClaims map[string]interface{}) map[string]interface{} {
 }
 
 func validateIdToken(token string) (map[string]interface{}, error) {
-	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		set, err := jwk.FetchHTTP(config.JwksUrl)
-		if err != nil {
-			return nil, err
-		}
-
-		keyID, ok := token.Header["kid"].(string)
-		if !ok {
-			return nil, errors.New("expecting JWT header to have string kid")
-		}
-
-		if key := set.LookupKeyID(keyID); len(key) == 1 {
-			return key[0].Materialize()
-		}
-		return nil, errors.New("unable to find key")
-	})
+	parsedToken, err := jwt.Parse(token, jwksCache.Keyfunc, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}))
 	if err != nil {
 		return nil, err
 	}
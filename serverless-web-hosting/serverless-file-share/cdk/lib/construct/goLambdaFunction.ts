@@ -8,6 +8,8 @@ export interface GoLambdaFunctionProps {
     name: string;
     entry: string;
     environmentVariables?: { [key: string]: string };
+    timeout?: cdk.Duration;
+    memorySize?: number;
 }
 
 export class GoLambdaFunction extends Construct {
@@ -21,9 +23,9 @@ export class GoLambdaFunction extends Construct {
         functionName,
         runtime: lambda.Runtime.PROVIDED_AL2,
         entry: props.entry,
-        timeout: cdk.Duration.seconds(29),
+        timeout: props.timeout ?? cdk.Duration.seconds(29),
         architecture: lambda.Architecture.ARM_64,
-        memorySize: 256,
+        memorySize: props.memorySize ?? 256,
         tracing: lambda.Tracing.ACTIVE,
         environment: {
             ...props.environmentVariables,
@@ -2,7 +2,7 @@ import * as cdk from 'aws-cdk-lib';
 import * as ddb from 'aws-cdk-lib/aws-dynamodb';
 import { Construct } from 'constructs';
 import * as s3 from "aws-cdk-lib/aws-s3";
-import { AllowedMethods, CacheCookieBehavior, CachePolicy, CacheQueryStringBehavior, Function, Distribution, EdgeLambda, ErrorResponse, FunctionCode, FunctionEventType, LambdaEdgeEventType, OriginAccessIdentity, OriginProtocolPolicy, OriginRequestPolicy, OriginSslPolicy, ResponseHeadersPolicy, ViewerProtocolPolicy } from 'aws-cdk-lib/aws-cloudfront';
+import { AllowedMethods, CacheCookieBehavior, CachePolicy, CacheQueryStringBehavior, Function, Distribution, EdgeLambda, ErrorResponse, FunctionCode, FunctionEventType, KeyGroup, LambdaEdgeEventType, OriginAccessIdentity, OriginProtocolPolicy, OriginRequestPolicy, OriginSslPolicy, PublicKey, ResponseHeadersPolicy, ViewerProtocolPolicy } from 'aws-cdk-lib/aws-cloudfront';
 import { BucketDeployment, Source } from 'aws-cdk-lib/aws-s3-deployment';
 import path = require('path');
 import { GoLambdaFunction } from './construct/goLambdaFunction';
@@ -10,7 +10,7 @@ import { HttpLambdaIntegration } from '@aws-cdk/aws-apigatewayv2-integrations-al
 import { CorsHttpMethod, HttpApi, HttpMethod, PayloadFormatVersion } from '@aws-cdk/aws-apigatewayv2-alpha';
 import { CognitoUserPool } from './construct/cognito';
 import { HttpLambdaAuthorizer, HttpLambdaResponseType } from '@aws-cdk/aws-apigatewayv2-authorizers-alpha';
-import { Duration, RemovalPolicy } from 'aws-cdk-lib';
+import { Duration, Fn, RemovalPolicy } from 'aws-cdk-lib';
 import { HttpOrigin, S3Origin } from 'aws-cdk-lib/aws-cloudfront-origins';
 import { ARecord, IHostedZone, PublicHostedZone, RecordTarget } from 'aws-cdk-lib/aws-route53';
 import { Certificate } from 'aws-cdk-lib/aws-certificatemanager';
@@ -18,6 +18,12 @@ import { CloudFrontTarget } from 'aws-cdk-lib/aws-route53-targets';
 import * as serverless from 'aws-cdk-lib/aws-sam';
 import { Version } from 'aws-cdk-lib/aws-lambda';
 import { BlockPublicAccess, Bucket } from 'aws-cdk-lib/aws-s3';
+import { Secret } from 'aws-cdk-lib/aws-secretsmanager';
+import { FilterCriteria, FilterRule, FunctionUrlAuthType, InvokeMode, StartingPosition } from 'aws-cdk-lib/aws-lambda';
+import { DynamoEventSource } from 'aws-cdk-lib/aws-lambda-event-sources';
+import { LambdaDestination } from 'aws-cdk-lib/aws-s3-notifications';
+import { Rule, Schedule } from 'aws-cdk-lib/aws-events';
+import { LambdaFunction } from 'aws-cdk-lib/aws-events-targets';
 
 enum HttpStatus {
   OK = 200,
@@ -48,9 +54,26 @@ export class FileShareServiceStack extends cdk.Stack {
     const API_LAMBDA_PREFIX = '../lambda/api/cmd'
     const LAMBDA_GET_CONFIG_LOCATION = `${API_LAMBDA_PREFIX}/${LambdaType.API}/getConfig/main.go`
     const LAMBDA_POST_UPLOADS_LOCATION = `${API_LAMBDA_PREFIX}/${LambdaType.API}/postUploads/main.go`
+    const LAMBDA_GET_UPLOAD_PARTS_LOCATION = `${API_LAMBDA_PREFIX}/${LambdaType.API}/getUploadParts/main.go`
+    const LAMBDA_POST_UPLOAD_COMPLETE_LOCATION = `${API_LAMBDA_PREFIX}/${LambdaType.API}/postUploadComplete/main.go`
+    const LAMBDA_DELETE_UPLOAD_LOCATION = `${API_LAMBDA_PREFIX}/${LambdaType.API}/deleteUpload/main.go`
     const LAMBDA_POST_DOWNLOADS_LOCATION = `${API_LAMBDA_PREFIX}/${LambdaType.API}/postDownloads/main.go`
     const LAMBDA_GET_DOWNLOAD_LOCATION = `${API_LAMBDA_PREFIX}/${LambdaType.API}/getDownload/main.go`
+    const LAMBDA_GET_DOWNLOAD_CONTENT_LOCATION = `${API_LAMBDA_PREFIX}/${LambdaType.API}/getDownloadContent/main.go`
+    const LAMBDA_GET_SHARES_LOCATION = `${API_LAMBDA_PREFIX}/${LambdaType.API}/getShares/main.go`
+    const LAMBDA_GET_SHARE_LOCATION = `${API_LAMBDA_PREFIX}/${LambdaType.API}/getShare/main.go`
+    const LAMBDA_DELETE_SHARE_LOCATION = `${API_LAMBDA_PREFIX}/${LambdaType.API}/deleteShare/main.go`
+    const LAMBDA_GET_SHARE_ACCESSES_LOCATION = `${API_LAMBDA_PREFIX}/${LambdaType.API}/getShareAccesses/main.go`
+    const LAMBDA_GET_ACCESSES_LOCATION = `${API_LAMBDA_PREFIX}/${LambdaType.API}/getAccesses/main.go`
+    const LAMBDA_GET_FILE_VERSIONS_LOCATION = `${API_LAMBDA_PREFIX}/${LambdaType.API}/getFileVersions/main.go`
+    const LAMBDA_GET_QUOTA_LOCATION = `${API_LAMBDA_PREFIX}/${LambdaType.API}/getQuota/main.go`
+    const LAMBDA_PUT_QUOTA_LOCATION = `${API_LAMBDA_PREFIX}/${LambdaType.API}/putQuota/main.go`
     const LAMBDA_API_AUTHORIZER_LOCATION = `${API_LAMBDA_PREFIX}/${LambdaType.AUTH}/main.go`
+    const LAMBDA_MIGRATION_LOCATION = `${API_LAMBDA_PREFIX}/migration/main.go`
+    const LAMBDA_ARCHIVER_LOCATION = `${API_LAMBDA_PREFIX}/archiver/main.go`
+    const LAMBDA_PROCESSOR_LOCATION = `${API_LAMBDA_PREFIX}/processor/main.go`
+    const LAMBDA_NOTIFIER_LOCATION = `${API_LAMBDA_PREFIX}/notifier/main.go`
+    const LAMBDA_SWEEPER_LOCATION = `${API_LAMBDA_PREFIX}/sweeper/main.go`
 
     /**
      * DynamoDB
@@ -67,6 +90,49 @@ export class FileShareServiceStack extends cdk.Stack {
         type: ddb.AttributeType.STRING,
       },
       removalPolicy: cdk.RemovalPolicy.DESTROY,
+      // new shares of folders are streamed to the archiver, downloads of shares to the notifier
+      stream: ddb.StreamViewType.NEW_IMAGE,
+      // expired shares, downloads and uploads are deleted after their retention
+      timeToLiveAttribute: 'TTL',
+    })
+    // shares and uploads of an asset are looked up by its path
+    ddbTable.addGlobalSecondaryIndex({
+      indexName: 'PathIndex',
+      partitionKey: {
+        name: 'Path',
+        type: ddb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'CreatedAt',
+        type: ddb.AttributeType.STRING,
+      },
+      projectionType: ddb.ProjectionType.ALL,
+    })
+    // shares are listed by their creator
+    ddbTable.addGlobalSecondaryIndex({
+      indexName: 'CreatedByIndex',
+      partitionKey: {
+        name: 'CreatedBy',
+        type: ddb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'CreatedAt',
+        type: ddb.AttributeType.STRING,
+      },
+      projectionType: ddb.ProjectionType.ALL,
+    })
+    // downloads of all shares are listed by their time for the audit trail, only access items have both keys
+    ddbTable.addGlobalSecondaryIndex({
+      indexName: 'AccessIndex',
+      partitionKey: {
+        name: 'Type',
+        type: ddb.AttributeType.STRING,
+      },
+      sortKey: {
+        name: 'AccessedAt',
+        type: ddb.AttributeType.STRING,
+      },
+      projectionType: ddb.ProjectionType.ALL,
     })
 
     /**
@@ -93,11 +159,14 @@ export class FileShareServiceStack extends cdk.Stack {
           "X-Amz-Security-Token",
           "X-Amz-User-Agent",
           "Content-Encoding",
+          "X-Share-Passphrase",
         ],
         allowMethods: [
           CorsHttpMethod.OPTIONS,
           CorsHttpMethod.GET,
           CorsHttpMethod.POST,
+          CorsHttpMethod.PUT,
+          CorsHttpMethod.DELETE,
         ],
         allowCredentials: true,
       },
@@ -309,24 +378,6 @@ export class FileShareServiceStack extends cdk.Stack {
       ),
     });
 
-    // api path
-    distribution.addBehavior("/api/*", new HttpOrigin(`${httpApi.httpApiId}.execute-api.${this.region}.${this.urlSuffix}`), {
-      viewerProtocolPolicy: ViewerProtocolPolicy.REDIRECT_TO_HTTPS,
-      allowedMethods: AllowedMethods.ALLOW_ALL,
-      compress: true,
-      functionAssociations: [
-        {
-          function: checkAuthFunction,
-          eventType: FunctionEventType.VIEWER_REQUEST,
-        },
-      ],
-      edgeLambdas: [checkOriginAuthEdge],
-      cachePolicy: apiOriginCachePolicy,
-      // https://stackoverflow.com/questions/71367982/cloudfront-gives-403-when-origin-request-policy-include-all-headers-querystri
-      originRequestPolicy: OriginRequestPolicy.ALL_VIEWER_EXCEPT_HOST_HEADER,
-      responseHeadersPolicy: ResponseHeadersPolicy.SECURITY_HEADERS,
-    });
-
     distribution.addBehavior("/signin", dummyorigin, {
       viewerProtocolPolicy: ViewerProtocolPolicy.REDIRECT_TO_HTTPS,
       cachePolicy: CachePolicy.CACHING_DISABLED,
@@ -383,17 +434,115 @@ export class FileShareServiceStack extends cdk.Stack {
               fileshareServiceUrl,
             ],
           allowedHeaders: ['*'],
+          // browser needs the etag of each uploaded part to complete a multipart upload
+          exposedHeaders: ['ETag'],
+        },
+      ],
+      lifecycleRules: [
+        {
+          // archives of shared folders are not needed after their shares expired (7 days at most)
+          prefix: 'archives/',
+          expiration: Duration.days(8),
+          abortIncompleteMultipartUploadAfter: Duration.days(1),
+        },
+        {
+          // overwritten versions can be shared for 30 days, objects deleted by the sweeper are removed for good
+          // once no share can download their versions anymore
+          noncurrentVersionExpiration: Duration.days(30),
+          expiredObjectDeleteMarker: true,
         },
       ],
     });
 
+    /**
+     * Secret of the HMAC, which keys the shares by their access key
+     */
+    const accessKeySecret = new Secret(this, props.appPrefix + '-access-key-secret', {
+      secretName: props.appPrefix + '-access-key-secret',
+      generateSecretString: {
+        passwordLength: 64,
+        excludePunctuation: true,
+      },
+      removalPolicy: cdk.RemovalPolicy.DESTROY,
+    });
+
+    /**
+     * Download Distribution
+     */
+    // downloads are signed for cloudfront instead of presigned by s3, if the public key and the secret of the
+    // private key are given by context, e.g. cdk deploy -c downloadSigner=cloudfront
+    // -c cloudfrontPublicKey="$(cat public_key.pem)" -c cloudfrontPrivateKeySecretName=<secret of private_key.pem>
+    const downloadSigner = this.node.tryGetContext('downloadSigner') ?? 's3';
+    const downloadEnvironment: { [key: string]: string } = {
+      'DOWNLOAD_SIGNER': downloadSigner,
+    };
+    let cloudfrontPrivateKeySecret;
+    if (downloadSigner === 'cloudfront') {
+      const downloadPublicKey = new PublicKey(this, props.appPrefix + '-download-public-key', {
+        encodedKey: this.node.tryGetContext('cloudfrontPublicKey'),
+      });
+      const downloadKeyGroup = new KeyGroup(this, props.appPrefix + '-download-key-group', {
+        items: [downloadPublicKey],
+      });
+      // urls of pinned shares download the version given by their query
+      const downloadCachePolicy = new CachePolicy(this, "downloadCachePolicy", {
+        cachePolicyName: props.appPrefix + '-download-cache-policy',
+        comment: "download cache policy in distritbution",
+        defaultTtl: Duration.days(1),
+        minTtl: Duration.seconds(0),
+        maxTtl: Duration.days(7),
+        enableAcceptEncodingBrotli: true,
+        enableAcceptEncodingGzip: true,
+        cookieBehavior: CacheCookieBehavior.none(),
+        queryStringBehavior: CacheQueryStringBehavior.allowList('versionId'),
+      });
+      fileShareAssetBucket.grantRead(this.cloudfrontOAI);
+      const downloadDistribution = new Distribution(
+        this,
+        `${props.appPrefix}-download-distribution`,
+        {
+          comment: `${props.appPrefix}-download-distribution`,
+          defaultBehavior: {
+            origin: new S3Origin(fileShareAssetBucket, {
+              originAccessIdentity: this.cloudfrontOAI,
+            }),
+            viewerProtocolPolicy: ViewerProtocolPolicy.REDIRECT_TO_HTTPS,
+            allowedMethods: AllowedMethods.ALLOW_GET_HEAD,
+            trustedKeyGroups: [downloadKeyGroup],
+            cachePolicy: downloadCachePolicy,
+            responseHeadersPolicy: ResponseHeadersPolicy.SECURITY_HEADERS,
+          }
+        }
+      );
+      cloudfrontPrivateKeySecret = Secret.fromSecretNameV2(this, props.appPrefix + '-cloudfront-private-key',
+        this.node.tryGetContext('cloudfrontPrivateKeySecretName'));
+      downloadEnvironment['CLOUDFRONT_DOMAIN'] = downloadDistribution.distributionDomainName;
+      downloadEnvironment['CLOUDFRONT_KEY_PAIR_ID'] = downloadPublicKey.publicKeyId;
+      downloadEnvironment['CLOUDFRONT_PRIVATE_KEY_SECRET'] = cloudfrontPrivateKeySecret.secretName;
+    }
+
+    // expired items and unused files are kept for the days of the retention policy given by context
+    // e.g. cdk deploy -c retentionPolicy='{"shareDays":30,"accessDays":365,"uploadDays":7,"fileDays":90}'
+    const retentionPolicy = this.node.tryGetContext('retentionPolicy') ?? '';
+
+    // access keys are resolved behind a rate limit per access key and per source ip, whose token buckets are kept in the table
+    // e.g. cdk deploy -c rateLimitPolicy='{"accessKey":{"perMinute":10,"burst":20},"sourceIp":{"perMinute":30,"burst":60}}'
+    const rateLimitPolicy = this.node.tryGetContext('rateLimitPolicy') ?? '';
+
     /** 
      * API Lambda Function
     */    
+    // uploads and storage are restricted by the policies of the roles given by context
+    // e.g. cdk deploy -c uploadPolicies='{"user":{"maxFileSize":104857600,"contentTypes":["image/*","application/pdf"],"quota":1073741824}}'
     const getConfigHandler = new GoLambdaFunction(this, props.appPrefix + '-get-config', {
       name: props.appPrefix + '-get-config',
       entry: LAMBDA_GET_CONFIG_LOCATION,
+      environmentVariables: {
+        'URL_TABLE': ddbTable.tableName,
+        'UPLOAD_POLICIES': this.node.tryGetContext('uploadPolicies') ?? '',
+      }
     });
+    ddbTable.grantReadData(getConfigHandler.fn);
 
     const postUploadsHandler = new GoLambdaFunction(this, props.appPrefix + '-post-uploads', {
       name: props.appPrefix + '-post-uploads',
@@ -401,20 +550,55 @@ export class FileShareServiceStack extends cdk.Stack {
       environmentVariables: {
         'URL_TABLE': ddbTable.tableName,
         'FILE_SHARE_BUCKET': fileShareAssetBucket.bucketName,
+        'UPLOAD_POLICIES': this.node.tryGetContext('uploadPolicies') ?? '',
+        'RETENTION_POLICY': retentionPolicy,
       }
     });
     fileShareAssetBucket.grantPut(postUploadsHandler.fn);
     fileShareAssetBucket.grantPutAcl(postUploadsHandler.fn);
 
+    const getUploadPartsHandler = new GoLambdaFunction(this, props.appPrefix + '-get-upload-parts', {
+      name: props.appPrefix + '-get-upload-parts',
+      entry: LAMBDA_GET_UPLOAD_PARTS_LOCATION,
+      environmentVariables: {
+        'URL_TABLE': ddbTable.tableName,
+        'FILE_SHARE_BUCKET': fileShareAssetBucket.bucketName,
+      }
+    });
+    fileShareAssetBucket.grantReadWrite(getUploadPartsHandler.fn);
+
+    const postUploadCompleteHandler = new GoLambdaFunction(this, props.appPrefix + '-post-upload-complete', {
+      name: props.appPrefix + '-post-upload-complete',
+      entry: LAMBDA_POST_UPLOAD_COMPLETE_LOCATION,
+      environmentVariables: {
+        'URL_TABLE': ddbTable.tableName,
+        'FILE_SHARE_BUCKET': fileShareAssetBucket.bucketName,
+      }
+    });
+    fileShareAssetBucket.grantReadWrite(postUploadCompleteHandler.fn);
+
+    const deleteUploadHandler = new GoLambdaFunction(this, props.appPrefix + '-delete-upload', {
+      name: props.appPrefix + '-delete-upload',
+      entry: LAMBDA_DELETE_UPLOAD_LOCATION,
+      environmentVariables: {
+        'URL_TABLE': ddbTable.tableName,
+        'FILE_SHARE_BUCKET': fileShareAssetBucket.bucketName,
+      }
+    });
+    fileShareAssetBucket.grantReadWrite(deleteUploadHandler.fn);
+
     const postDownloadsHandler = new GoLambdaFunction(this, props.appPrefix + '-post-downloads', {
       name: props.appPrefix + '-post-downloads',
       entry: LAMBDA_POST_DOWNLOADS_LOCATION,
       environmentVariables: {
         'URL_TABLE': ddbTable.tableName,
         'FILE_SHARE_BUCKET': fileShareAssetBucket.bucketName,
+        'RETENTION_POLICY': retentionPolicy,
+        ...downloadEnvironment,
       }
     });
     fileShareAssetBucket.grantRead(postDownloadsHandler.fn);
+    cloudfrontPrivateKeySecret?.grantRead(postDownloadsHandler.fn);
 
     const getDownloadHandler = new GoLambdaFunction(this, props.appPrefix + '-get-download', {
       name: props.appPrefix + '-get-download',
@@ -422,11 +606,304 @@ export class FileShareServiceStack extends cdk.Stack {
       environmentVariables: {
         'URL_TABLE': ddbTable.tableName,
         'FILE_SHARE_BUCKET': fileShareAssetBucket.bucketName,
+        'RETENTION_POLICY': retentionPolicy,
+        'RATE_LIMIT_POLICY': rateLimitPolicy,
+        ...downloadEnvironment,
       }
     })
+    // downloads return a short-lived url of the preview of the shared file
+    fileShareAssetBucket.grantRead(getDownloadHandler.fn, 'previews/*');
+    cloudfrontPrivateKeySecret?.grantRead(getDownloadHandler.fn);
+    ddbTable.grantFullAccess(postUploadsHandler.fn);
+    ddbTable.grantFullAccess(getUploadPartsHandler.fn);
+    ddbTable.grantFullAccess(postUploadCompleteHandler.fn);
+    ddbTable.grantFullAccess(deleteUploadHandler.fn);
     ddbTable.grantFullAccess(postDownloadsHandler.fn);
     ddbTable.grantFullAccess(getDownloadHandler.fn);
 
+    // content of shares is streamed by a function url, because the http api limits the responses of lambda to 6 MB.
+    // The function url is reached over the distribution like the api, its lambda verifies the id token of the user.
+    const getDownloadContentHandler = new GoLambdaFunction(this, props.appPrefix + '-get-download-content', {
+      name: props.appPrefix + '-get-download-content',
+      entry: LAMBDA_GET_DOWNLOAD_CONTENT_LOCATION,
+      timeout: Duration.minutes(15),
+      environmentVariables: {
+        'URL_TABLE': ddbTable.tableName,
+        'FILE_SHARE_BUCKET': fileShareAssetBucket.bucketName,
+        'RETENTION_POLICY': retentionPolicy,
+        'RATE_LIMIT_POLICY': rateLimitPolicy,
+        'JWKS_URL': `https://cognito-idp.${this.region}.amazonaws.com/${this.cognito.userPool.userPoolId}/.well-known/jwks.json`,
+        'ISS': `https://cognito-idp.${this.region}.amazonaws.com/${this.cognito.userPool.userPoolId}`,
+        'COGNITO_USER_POOL_CLIENT_ID': this.cognito.userPoolClient.userPoolClientId,
+      }
+    })
+    ddbTable.grantFullAccess(getDownloadContentHandler.fn);
+    fileShareAssetBucket.grantRead(getDownloadContentHandler.fn);
+    const getDownloadContentUrl = getDownloadContentHandler.fn.addFunctionUrl({
+      authType: FunctionUrlAuthType.NONE,
+      invokeMode: InvokeMode.RESPONSE_STREAM,
+    });
+
+    // content path, which must precede the api path
+    distribution.addBehavior("/api/downloads/*/content", new HttpOrigin(Fn.select(2, Fn.split('/', getDownloadContentUrl.url))), {
+      viewerProtocolPolicy: ViewerProtocolPolicy.REDIRECT_TO_HTTPS,
+      allowedMethods: AllowedMethods.ALLOW_GET_HEAD_OPTIONS,
+      // ranges of the content are sent as they are requested
+      compress: false,
+      functionAssociations: [
+        {
+          function: checkAuthFunction,
+          eventType: FunctionEventType.VIEWER_REQUEST,
+        },
+      ],
+      edgeLambdas: [checkOriginAuthEdge],
+      cachePolicy: apiOriginCachePolicy,
+      originRequestPolicy: OriginRequestPolicy.ALL_VIEWER_EXCEPT_HOST_HEADER,
+      responseHeadersPolicy: ResponseHeadersPolicy.SECURITY_HEADERS,
+    });
+
+    // api path
+    distribution.addBehavior("/api/*", new HttpOrigin(`${httpApi.httpApiId}.execute-api.${this.region}.${this.urlSuffix}`), {
+      viewerProtocolPolicy: ViewerProtocolPolicy.REDIRECT_TO_HTTPS,
+      allowedMethods: AllowedMethods.ALLOW_ALL,
+      compress: true,
+      functionAssociations: [
+        {
+          function: checkAuthFunction,
+          eventType: FunctionEventType.VIEWER_REQUEST,
+        },
+      ],
+      edgeLambdas: [checkOriginAuthEdge],
+      cachePolicy: apiOriginCachePolicy,
+      // https://stackoverflow.com/questions/71367982/cloudfront-gives-403-when-origin-request-policy-include-all-headers-querystri
+      originRequestPolicy: OriginRequestPolicy.ALL_VIEWER_EXCEPT_HOST_HEADER,
+      responseHeadersPolicy: ResponseHeadersPolicy.SECURITY_HEADERS,
+    });
+
+
+    const getSharesHandler = new GoLambdaFunction(this, props.appPrefix + '-get-shares', {
+      name: props.appPrefix + '-get-shares',
+      entry: LAMBDA_GET_SHARES_LOCATION,
+      environmentVariables: {
+        'URL_TABLE': ddbTable.tableName,
+      }
+    })
+    ddbTable.grantReadData(getSharesHandler.fn);
+
+    const getShareHandler = new GoLambdaFunction(this, props.appPrefix + '-get-share', {
+      name: props.appPrefix + '-get-share',
+      entry: LAMBDA_GET_SHARE_LOCATION,
+      environmentVariables: {
+        'URL_TABLE': ddbTable.tableName,
+      }
+    })
+    ddbTable.grantReadData(getShareHandler.fn);
+
+    const deleteShareHandler = new GoLambdaFunction(this, props.appPrefix + '-delete-share', {
+      name: props.appPrefix + '-delete-share',
+      entry: LAMBDA_DELETE_SHARE_LOCATION,
+      environmentVariables: {
+        'URL_TABLE': ddbTable.tableName,
+      }
+    })
+    ddbTable.grantReadWriteData(deleteShareHandler.fn);
+
+    const getShareAccessesHandler = new GoLambdaFunction(this, props.appPrefix + '-get-share-accesses', {
+      name: props.appPrefix + '-get-share-accesses',
+      entry: LAMBDA_GET_SHARE_ACCESSES_LOCATION,
+      environmentVariables: {
+        'URL_TABLE': ddbTable.tableName,
+      }
+    })
+    ddbTable.grantReadData(getShareAccessesHandler.fn);
+
+    const getAccessesHandler = new GoLambdaFunction(this, props.appPrefix + '-get-accesses', {
+      name: props.appPrefix + '-get-accesses',
+      entry: LAMBDA_GET_ACCESSES_LOCATION,
+      environmentVariables: {
+        'URL_TABLE': ddbTable.tableName,
+      }
+    })
+    ddbTable.grantReadData(getAccessesHandler.fn);
+
+    const getFileVersionsHandler = new GoLambdaFunction(this, props.appPrefix + '-get-file-versions', {
+      name: props.appPrefix + '-get-file-versions',
+      entry: LAMBDA_GET_FILE_VERSIONS_LOCATION,
+      environmentVariables: {
+        'URL_TABLE': ddbTable.tableName,
+        'FILE_SHARE_BUCKET': fileShareAssetBucket.bucketName,
+      }
+    })
+    fileShareAssetBucket.grantRead(getFileVersionsHandler.fn);
+
+    const getQuotaHandler = new GoLambdaFunction(this, props.appPrefix + '-get-quota', {
+      name: props.appPrefix + '-get-quota',
+      entry: LAMBDA_GET_QUOTA_LOCATION,
+      environmentVariables: {
+        'URL_TABLE': ddbTable.tableName,
+      }
+    })
+    ddbTable.grantReadData(getQuotaHandler.fn);
+
+    const putQuotaHandler = new GoLambdaFunction(this, props.appPrefix + '-put-quota', {
+      name: props.appPrefix + '-put-quota',
+      entry: LAMBDA_PUT_QUOTA_LOCATION,
+      environmentVariables: {
+        'URL_TABLE': ddbTable.tableName,
+      }
+    })
+    ddbTable.grantReadWriteData(putQuotaHandler.fn);
+
+    // every api lambda keys the shares by the HMAC of their access key, its secret is read from secrets manager at cold start
+    for (const handler of [getConfigHandler, postUploadsHandler, getUploadPartsHandler, postUploadCompleteHandler,
+      deleteUploadHandler, postDownloadsHandler, getDownloadHandler, getDownloadContentHandler, getSharesHandler,
+      getShareHandler, deleteShareHandler, getShareAccessesHandler, getAccessesHandler, getFileVersionsHandler,
+      getQuotaHandler, putQuotaHandler]) {
+      handler.fn.addEnvironment('ACCESS_KEY_SECRET_NAME', accessKeySecret.secretName);
+      accessKeySecret.grantRead(handler.fn);
+    }
+
+    // migrates assets of previous table schema, invoke it once manually after deployment
+    const migrationHandler = new GoLambdaFunction(this, props.appPrefix + '-migration', {
+      name: props.appPrefix + '-migration',
+      entry: LAMBDA_MIGRATION_LOCATION,
+      environmentVariables: {
+        'URL_TABLE': ddbTable.tableName,
+        'RETENTION_POLICY': retentionPolicy,
+      }
+    })
+    ddbTable.grantFullAccess(migrationHandler.fn);
+
+    // scans every uploaded object for malware, records its checksum, size and content type and makes it available for sharing.
+    // clamd is reachable over the address given by context e.g. cdk deploy -c clamdAddress=tcp://clamd.internal:3310
+    const processorHandler = new GoLambdaFunction(this, props.appPrefix + '-processor', {
+      name: props.appPrefix + '-processor',
+      entry: LAMBDA_PROCESSOR_LOCATION,
+      timeout: Duration.minutes(15),
+      // images are decoded in memory to generate their previews
+      memorySize: 1024,
+      environmentVariables: {
+        'URL_TABLE': ddbTable.tableName,
+        'FILE_SHARE_BUCKET': fileShareAssetBucket.bucketName,
+        'CLAMD_ADDRESS': this.node.tryGetContext('clamdAddress') ?? '',
+      }
+    })
+    ddbTable.grantReadWriteData(processorHandler.fn);
+    fileShareAssetBucket.grantRead(processorHandler.fn);
+    // previews of images and pdfs are stored next to the shared files
+    fileShareAssetBucket.grantPut(processorHandler.fn, 'previews/*');
+    fileShareAssetBucket.grantDelete(processorHandler.fn, 'previews/*');
+    fileShareAssetBucket.addEventNotification(s3.EventType.OBJECT_CREATED, new LambdaDestination(processorHandler.fn));
+    // deleted files free the storage quota of their uploader
+    fileShareAssetBucket.addEventNotification(s3.EventType.OBJECT_REMOVED, new LambdaDestination(processorHandler.fn));
+
+    // prepares the zip archives of shared folders
+    const archiverHandler = new GoLambdaFunction(this, props.appPrefix + '-archiver', {
+      name: props.appPrefix + '-archiver',
+      entry: LAMBDA_ARCHIVER_LOCATION,
+      timeout: Duration.minutes(15),
+      memorySize: 512,
+      environmentVariables: {
+        'URL_TABLE': ddbTable.tableName,
+        'FILE_SHARE_BUCKET': fileShareAssetBucket.bucketName,
+      }
+    })
+    ddbTable.grantReadWriteData(archiverHandler.fn);
+    fileShareAssetBucket.grantReadWrite(archiverHandler.fn);
+    archiverHandler.fn.addEventSource(new DynamoEventSource(ddbTable, {
+      startingPosition: StartingPosition.LATEST,
+      batchSize: 1,
+      retryAttempts: 2,
+      filters: [
+        FilterCriteria.filter({
+          eventName: FilterRule.isEqual('INSERT'),
+          dynamodb: {
+            NewImage: {
+              SK: { S: FilterRule.isEqual('SHARE') },
+              State: { S: FilterRule.isEqual('PREPARING') },
+            },
+          },
+        }),
+      ],
+    }));
+
+    // aborts stale uploads, deletes recorded files which were not uploaded or shared within the file retention and
+    // sets the ttl of items written without it once a day. It only logs what it would clean up, unless it is deployed with -c sweeperDryRun=false
+    const sweeperHandler = new GoLambdaFunction(this, props.appPrefix + '-sweeper', {
+      name: props.appPrefix + '-sweeper',
+      entry: LAMBDA_SWEEPER_LOCATION,
+      timeout: Duration.minutes(15),
+      environmentVariables: {
+        'URL_TABLE': ddbTable.tableName,
+        'FILE_SHARE_BUCKET': fileShareAssetBucket.bucketName,
+        'RETENTION_POLICY': retentionPolicy,
+        'SWEEPER_DRY_RUN': String(this.node.tryGetContext('sweeperDryRun') ?? 'true'),
+      }
+    })
+    ddbTable.grantReadWriteData(sweeperHandler.fn);
+    fileShareAssetBucket.grantReadWrite(sweeperHandler.fn);
+    fileShareAssetBucket.grantDelete(sweeperHandler.fn);
+    new Rule(this, props.appPrefix + '-sweeper-schedule', {
+      schedule: Schedule.rate(Duration.days(1)),
+      targets: [new LambdaFunction(sweeperHandler.fn)],
+    });
+
+    /**
+     * Secret of the HMAC, which signs the webhook notifications
+     */
+    const webhookSecret = new Secret(this, props.appPrefix + '-webhook-secret', {
+      secretName: props.appPrefix + '-webhook-secret',
+      generateSecretString: {
+        passwordLength: 64,
+        excludePunctuation: true,
+      },
+      removalPolicy: cdk.RemovalPolicy.DESTROY,
+    });
+
+    // notifies owners about downloads of their shares, if they opted in. Notifications are sent by email over the smtp server
+    // and/or posted to the webhook given by context e.g. cdk deploy -c smtpHost=email-smtp.eu-central-1.amazonaws.com
+    // -c smtpFrom=fileshare@example.com -c smtpUsername=<user> -c smtpPasswordSecretName=<secret> -c webhookUrl=https://example.com/hook
+    const smtpPasswordSecretName = this.node.tryGetContext('smtpPasswordSecretName');
+    const notifierHandler = new GoLambdaFunction(this, props.appPrefix + '-notifier', {
+      name: props.appPrefix + '-notifier',
+      entry: LAMBDA_NOTIFIER_LOCATION,
+      timeout: Duration.minutes(1),
+      environmentVariables: {
+        'URL_TABLE': ddbTable.tableName,
+        'SMTP_HOST': this.node.tryGetContext('smtpHost') ?? '',
+        'SMTP_PORT': this.node.tryGetContext('smtpPort') ?? '',
+        'SMTP_FROM': this.node.tryGetContext('smtpFrom') ?? '',
+        'SMTP_USERNAME': this.node.tryGetContext('smtpUsername') ?? '',
+        'SMTP_PASSWORD_SECRET_NAME': smtpPasswordSecretName ?? '',
+        'WEBHOOK_URL': this.node.tryGetContext('webhookUrl') ?? '',
+        'WEBHOOK_SECRET_NAME': webhookSecret.secretName,
+      }
+    })
+    ddbTable.grantReadData(notifierHandler.fn);
+    // the secrets are read from secrets manager at cold start, so that they are not visible in the configuration of the lambda
+    webhookSecret.grantRead(notifierHandler.fn);
+    if (smtpPasswordSecretName) {
+      Secret.fromSecretNameV2(this, props.appPrefix + '-smtp-password', smtpPasswordSecretName).grantRead(notifierHandler.fn);
+    }
+    // failed deliveries are retried by the stream, the download never waits for them
+    notifierHandler.fn.addEventSource(new DynamoEventSource(ddbTable, {
+      startingPosition: StartingPosition.LATEST,
+      batchSize: 1,
+      retryAttempts: 5,
+      maxRecordAge: Duration.days(1),
+      filters: [
+        FilterCriteria.filter({
+          eventName: FilterRule.isEqual('INSERT'),
+          dynamodb: {
+            NewImage: {
+              Type: { S: FilterRule.isEqual('ACCESS') },
+              Notify: { BOOL: FilterRule.exists() },
+            },
+          },
+        }),
+      ],
+    }));
+
     /**
      * Authorizer
      */
@@ -468,6 +945,33 @@ export class FileShareServiceStack extends cdk.Stack {
       authorizer: lambdaAuthorizer,
     });
 
+    httpApi.addRoutes({
+      path: `/${apiRouteName}/uploads/{id}/parts`,
+      methods: [HttpMethod.GET],
+      integration: new HttpLambdaIntegration(props.appPrefix + '-get-upload-parts-integration', getUploadPartsHandler.fn, {
+        payloadFormatVersion: PayloadFormatVersion.VERSION_2_0
+      }),
+      authorizer: lambdaAuthorizer,
+    });
+
+    httpApi.addRoutes({
+      path: `/${apiRouteName}/uploads/{id}/complete`,
+      methods: [HttpMethod.POST],
+      integration: new HttpLambdaIntegration(props.appPrefix + '-post-upload-complete-integration', postUploadCompleteHandler.fn, {
+        payloadFormatVersion: PayloadFormatVersion.VERSION_2_0
+      }),
+      authorizer: lambdaAuthorizer,
+    });
+
+    httpApi.addRoutes({
+      path: `/${apiRouteName}/uploads/{id}`,
+      methods: [HttpMethod.DELETE],
+      integration: new HttpLambdaIntegration(props.appPrefix + '-delete-upload-integration', deleteUploadHandler.fn, {
+        payloadFormatVersion: PayloadFormatVersion.VERSION_2_0
+      }),
+      authorizer: lambdaAuthorizer,
+    });
+
     httpApi.addRoutes({
       path: `/${apiRouteName}/downloads`,
       methods: [HttpMethod.POST],
@@ -486,6 +990,78 @@ export class FileShareServiceStack extends cdk.Stack {
       authorizer: lambdaAuthorizer,
     });
     
+    httpApi.addRoutes({
+      path: `/${apiRouteName}/shares`,
+      methods: [HttpMethod.GET],
+      integration: new HttpLambdaIntegration(props.appPrefix + '-get-shares-integration', getSharesHandler.fn, {
+        payloadFormatVersion: PayloadFormatVersion.VERSION_2_0
+      }),
+      authorizer: lambdaAuthorizer,
+    });
+
+    httpApi.addRoutes({
+      path: `/${apiRouteName}/shares/{id}`,
+      methods: [HttpMethod.GET],
+      integration: new HttpLambdaIntegration(props.appPrefix + '-get-share-integration', getShareHandler.fn, {
+        payloadFormatVersion: PayloadFormatVersion.VERSION_2_0
+      }),
+      authorizer: lambdaAuthorizer,
+    });
+
+    httpApi.addRoutes({
+      path: `/${apiRouteName}/shares/{id}`,
+      methods: [HttpMethod.DELETE],
+      integration: new HttpLambdaIntegration(props.appPrefix + '-delete-share-integration', deleteShareHandler.fn, {
+        payloadFormatVersion: PayloadFormatVersion.VERSION_2_0
+      }),
+      authorizer: lambdaAuthorizer,
+    });
+
+    httpApi.addRoutes({
+      path: `/${apiRouteName}/shares/{id}/accesses`,
+      methods: [HttpMethod.GET],
+      integration: new HttpLambdaIntegration(props.appPrefix + '-get-share-accesses-integration', getShareAccessesHandler.fn, {
+        payloadFormatVersion: PayloadFormatVersion.VERSION_2_0
+      }),
+      authorizer: lambdaAuthorizer,
+    });
+
+    httpApi.addRoutes({
+      path: `/${apiRouteName}/accesses`,
+      methods: [HttpMethod.GET],
+      integration: new HttpLambdaIntegration(props.appPrefix + '-get-accesses-integration', getAccessesHandler.fn, {
+        payloadFormatVersion: PayloadFormatVersion.VERSION_2_0
+      }),
+      authorizer: lambdaAuthorizer,
+    });
+
+    httpApi.addRoutes({
+      path: `/${apiRouteName}/files/versions`,
+      methods: [HttpMethod.GET],
+      integration: new HttpLambdaIntegration(props.appPrefix + '-get-file-versions-integration', getFileVersionsHandler.fn, {
+        payloadFormatVersion: PayloadFormatVersion.VERSION_2_0
+      }),
+      authorizer: lambdaAuthorizer,
+    });
+
+    httpApi.addRoutes({
+      path: `/${apiRouteName}/quotas/{username}`,
+      methods: [HttpMethod.GET],
+      integration: new HttpLambdaIntegration(props.appPrefix + '-get-quota-integration', getQuotaHandler.fn, {
+        payloadFormatVersion: PayloadFormatVersion.VERSION_2_0
+      }),
+      authorizer: lambdaAuthorizer,
+    });
+
+    httpApi.addRoutes({
+      path: `/${apiRouteName}/quotas/{username}`,
+      methods: [HttpMethod.PUT],
+      integration: new HttpLambdaIntegration(props.appPrefix + '-put-quota-integration', putQuotaHandler.fn, {
+        payloadFormatVersion: PayloadFormatVersion.VERSION_2_0
+      }),
+      authorizer: lambdaAuthorizer,
+    });
+    
     new cdk.CfnOutput(this, 'FileShareSerivceUrl', { value: fileshareServiceUrl});
   }
 }
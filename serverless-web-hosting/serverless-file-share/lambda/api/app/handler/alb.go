@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+)
+
+// header of the claims of the user, which are signed by the load balancer after its oidc authentication
+const ALB_OIDC_DATA_HEADER string = "x-amzn-oidc-data"
+
+// header, to which the load balancer appends the address of the client
+const ALB_FORWARDED_FOR_HEADER string = "x-forwarded-for"
+
+// public keys of the load balancers are published per region and key id. Key ids, of which no key is
+// found, are not fetched again for the miss ttl, so that forged tokens do not flood the endpoint.
+const (
+	ALB_PUBLIC_KEY_URL      string        = "https://public-keys.auth.elb.%s.amazonaws.com/%s"
+	ALB_PUBLIC_KEY_TIMEOUT  time.Duration = 5 * time.Second
+	ALB_PUBLIC_KEY_MISS_TTL time.Duration = time.Minute
+)
+
+var albKeyIdPattern = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+
+// albVerifier verifies the user claims, which are signed by given load balancer. The public keys are cached
+// per key id for the lifetime of the lambda. A key is fetched once, while concurrent requests wait for it.
+type albVerifier struct {
+	arn    string
+	region string
+	keyUrl string
+	client *http.Client
+	mu     sync.Mutex
+	keys   map[string]*ecdsa.PublicKey
+	// failed fetches of key ids until their miss ttl passed, and running fetches of key ids
+	misses  map[string]albKeyMiss
+	fetches map[string]*albKeyFetch
+}
+
+type albKeyMiss struct {
+	err error
+	at  time.Time
+}
+
+// fetch of a public key, done is closed when key or err is set
+type albKeyFetch struct {
+	done chan struct{}
+	key  *ecdsa.PublicKey
+	err  error
+}
+
+func newAlbVerifier(arn string) *albVerifier {
+	// arn:aws:elasticloadbalancing:<region>:<account>:loadbalancer/app/<name>/<id>
+	var region string
+	if parts := strings.Split(arn, ":"); len(parts) > 3 {
+		region = parts[3]
+	}
+	return &albVerifier{
+		arn:     arn,
+		region:  region,
+		keyUrl:  ALB_PUBLIC_KEY_URL,
+		client:  &http.Client{Timeout: ALB_PUBLIC_KEY_TIMEOUT},
+		keys:    map[string]*ecdsa.PublicKey{},
+		misses:  map[string]albKeyMiss{},
+		fetches: map[string]*albKeyFetch{},
+	}
+}
+
+// returns the identity of the user, who is authenticated by the load balancer. Requests are only accepted,
+// if the load balancer is configured, because clients can send the header if it does not authenticate.
+func (v *albVerifier) identity(token string) (*entities.Identity, error) {
+	if len(v.arn) == 0 {
+		return nil, errors.New("load balancer is not configured")
+	}
+	if len(token) == 0 {
+		return nil, errors.New("user claims of load balancer are missing")
+	}
+	// the load balancer pads the segments of its tokens, which jwt does not decode by default. The padding is
+	// stripped for decoding, while the signature is verified against the segments as they are signed.
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, errors.New("user claims of load balancer are malformed")
+	}
+	unpadded := make([]string, len(segments))
+	for i, segment := range segments {
+		unpadded[i] = strings.TrimRight(segment, "=")
+	}
+	claims := jwt.MapClaims{}
+	parsed, _, err := jwt.NewParser().ParseUnverified(strings.Join(unpadded, "."), claims)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Method != jwt.SigningMethodES256 {
+		return nil, fmt.Errorf("signing method %s is invalid", parsed.Method.Alg())
+	}
+	if signer, _ := parsed.Header["signer"].(string); signer != v.arn {
+		return nil, errors.New("user claims are not signed by the load balancer")
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	key, err := v.publicKey(kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := parsed.Method.Verify(strings.Join(segments[:2], "."), unpadded[2], key); err != nil {
+		return nil, err
+	}
+	if err := claims.Valid(); err != nil {
+		return nil, err
+	}
+	return contextIdentity(claims, CLAIM_USERNAME, CLAIM_IS_ADMIN)
+}
+
+// returns the public key of the key id. The lock is not held while the key is fetched, so that requests
+// signed with cached keys are not blocked by the fetch of another key.
+func (v *albVerifier) publicKey(kid string) (*ecdsa.PublicKey, error) {
+	if !albKeyIdPattern.MatchString(kid) {
+		return nil, errors.New("key id is invalid")
+	}
+	v.mu.Lock()
+	if key, ok := v.keys[kid]; ok {
+		v.mu.Unlock()
+		return key, nil
+	}
+	if miss, ok := v.misses[kid]; ok && time.Since(miss.at) < ALB_PUBLIC_KEY_MISS_TTL {
+		v.mu.Unlock()
+		return nil, miss.err
+	}
+	fetch, running := v.fetches[kid]
+	if !running {
+		fetch = &albKeyFetch{done: make(chan struct{})}
+		v.fetches[kid] = fetch
+	}
+	v.mu.Unlock()
+	if running {
+		<-fetch.done
+		return fetch.key, fetch.err
+	}
+
+	fetch.key, fetch.err = v.fetchPublicKey(kid)
+	v.mu.Lock()
+	delete(v.fetches, kid)
+	now := time.Now()
+	if fetch.err != nil {
+		// expired misses are dropped, so that forged key ids do not pile up
+		for missedKid, miss := range v.misses {
+			if now.Sub(miss.at) >= ALB_PUBLIC_KEY_MISS_TTL {
+				delete(v.misses, missedKid)
+			}
+		}
+		v.misses[kid] = albKeyMiss{err: fetch.err, at: now}
+	} else {
+		v.keys[kid] = fetch.key
+	}
+	v.mu.Unlock()
+	close(fetch.done)
+	return fetch.key, fetch.err
+}
+
+func (v *albVerifier) fetchPublicKey(kid string) (*ecdsa.PublicKey, error) {
+	res, err := v.client.Get(fmt.Sprintf(v.keyUrl, v.region, kid))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("public key %s is not found, status %d", kid, res.StatusCode)
+	}
+	pem, err := io.ReadAll(io.LimitReader(res.Body, 4096))
+	if err != nil {
+		return nil, err
+	}
+	return jwt.ParseECPublicKeyFromPEM(pem)
+}
+
+// returns the request of the load balancer as request of the rest api. The load balancer passes the query
+// as it is sent by the client, while the rest api passes it decoded.
+func albToProxyRequest(req events.ALBTargetGroupRequest) events.APIGatewayProxyRequest {
+	var query map[string]string
+	if req.QueryStringParameters != nil {
+		query = make(map[string]string, len(req.QueryStringParameters))
+		for name, value := range req.QueryStringParameters {
+			query[queryUnescape(name)] = queryUnescape(value)
+		}
+	}
+	var multiValueQuery map[string][]string
+	if req.MultiValueQueryStringParameters != nil {
+		multiValueQuery = make(map[string][]string, len(req.MultiValueQueryStringParameters))
+		for name, values := range req.MultiValueQueryStringParameters {
+			for _, value := range values {
+				multiValueQuery[queryUnescape(name)] = append(multiValueQuery[queryUnescape(name)], queryUnescape(value))
+			}
+		}
+	}
+	return events.APIGatewayProxyRequest{
+		HTTPMethod:                      req.HTTPMethod,
+		Path:                            req.Path,
+		Headers:                         req.Headers,
+		MultiValueHeaders:               req.MultiValueHeaders,
+		QueryStringParameters:           query,
+		MultiValueQueryStringParameters: multiValueQuery,
+		Body:                            req.Body,
+		IsBase64Encoded:                 req.IsBase64Encoded,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Identity: events.APIGatewayRequestIdentity{SourceIP: albSourceIp(req)},
+		},
+	}
+}
+
+// returns the address of the client, which the load balancer appends to the X-Forwarded-For header. The
+// addresses before it are sent by the client and cannot be trusted.
+func albSourceIp(req events.ALBTargetGroupRequest) string {
+	var forwardedFor string
+	for name, values := range req.MultiValueHeaders {
+		if strings.EqualFold(name, ALB_FORWARDED_FOR_HEADER) && len(values) > 0 {
+			forwardedFor = values[len(values)-1]
+		}
+	}
+	for name, value := range req.Headers {
+		if strings.EqualFold(name, ALB_FORWARDED_FOR_HEADER) {
+			forwardedFor = value
+		}
+	}
+	addresses := strings.Split(forwardedFor, ",")
+	return strings.TrimSpace(addresses[len(addresses)-1])
+}
+
+// returns the response for the load balancer, which only accepts multi value headers if they are enabled
+// for the target group, which is the case if the request has multi value headers
+func albFromProxyResponse(res events.APIGatewayProxyResponse, multiValueHeaders bool) events.ALBTargetGroupResponse {
+	albResponse := events.ALBTargetGroupResponse{
+		StatusCode:        res.StatusCode,
+		StatusDescription: fmt.Sprintf("%d %s", res.StatusCode, http.StatusText(res.StatusCode)),
+		Body:              res.Body,
+		IsBase64Encoded:   res.IsBase64Encoded,
+	}
+	if multiValueHeaders {
+		albResponse.MultiValueHeaders = res.MultiValueHeaders
+		return albResponse
+	}
+	albResponse.Headers = make(map[string]string, len(res.MultiValueHeaders))
+	for name, values := range res.MultiValueHeaders {
+		albResponse.Headers[name] = strings.Join(values, ",")
+	}
+	return albResponse
+}
+
+func queryUnescape(value string) string {
+	unescaped, err := url.QueryUnescape(value)
+	if err != nil {
+		return value
+	}
+	return unescaped
+}
@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeAlbKeys publishes the public keys of its key ids like the key endpoint of the load balancers
+type fakeAlbKeys struct {
+	server  *httptest.Server
+	keys    map[string]*ecdsa.PublicKey
+	fetches sync.Map
+	// fetches of key ids block until their channel is closed
+	release map[string]chan struct{}
+}
+
+func newFakeAlbKeys(t *testing.T, kids ...string) *fakeAlbKeys {
+	t.Helper()
+	fake := &fakeAlbKeys{keys: map[string]*ecdsa.PublicKey{}, release: map[string]chan struct{}{}}
+	for _, kid := range kids {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		fake.keys[kid] = &key.PublicKey
+	}
+	fake.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		kid := strings.TrimPrefix(r.URL.Path, "/eu-central-1/")
+		count, _ := fake.fetches.LoadOrStore(kid, new(int32))
+		atomic.AddInt32(count.(*int32), 1)
+		if release, ok := fake.release[kid]; ok {
+			<-release
+		}
+		key, ok := fake.keys[kid]
+		if !ok {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		pem.Encode(w, &pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}))
+	t.Cleanup(fake.server.Close)
+	return fake
+}
+
+func (f *fakeAlbKeys) fetched(kid string) int {
+	count, ok := f.fetches.Load(kid)
+	if !ok {
+		return 0
+	}
+	return int(atomic.LoadInt32(count.(*int32)))
+}
+
+func (f *fakeAlbKeys) verifier() *albVerifier {
+	v := newAlbVerifier("arn:aws:elasticloadbalancing:eu-central-1:123456789012:loadbalancer/app/fileshare/1234567890abcdef")
+	v.keyUrl = f.server.URL + "/%s/%s"
+	return v
+}
+
+func TestAlbPublicKeyIsFetchedOnceConcurrently(t *testing.T) {
+	fake := newFakeAlbKeys(t, "key-1")
+	fake.release["key-1"] = make(chan struct{})
+	v := fake.verifier()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key, err := v.publicKey("key-1")
+			if err == nil && !key.Equal(fake.keys["key-1"]) {
+				t.Errorf("got another key")
+			}
+			errs <- err
+		}()
+	}
+	for fake.fetched("key-1") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(fake.release["key-1"])
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if fake.fetched("key-1") != 1 {
+		t.Errorf("key is fetched %d times, want once", fake.fetched("key-1"))
+	}
+}
+
+func TestAlbPublicKeyIsNotBlockedByFetchOfOtherKey(t *testing.T) {
+	fake := newFakeAlbKeys(t, "key-1", "key-2")
+	v := fake.verifier()
+	if _, err := v.publicKey("key-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fake.release["key-2"] = make(chan struct{})
+	defer close(fake.release["key-2"])
+	go v.publicKey("key-2")
+	for fake.fetched("key-2") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := v.publicKey("key-1")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("cached key waits for the fetch of another key")
+	}
+}
+
+func TestAlbPublicKeyMissIsCached(t *testing.T) {
+	fake := newFakeAlbKeys(t, "key-1")
+	v := fake.verifier()
+
+	for i := 0; i < 5; i++ {
+		_, err := v.publicKey("unknown")
+		if err == nil || !strings.Contains(err.Error(), "status 403") {
+			t.Fatalf("got error %v, want the miss of the key", err)
+		}
+	}
+	if fake.fetched("unknown") != 1 {
+		t.Errorf("missing key is fetched %d times, want once", fake.fetched("unknown"))
+	}
+	// after the miss ttl, the key is fetched again
+	v.mu.Lock()
+	miss := v.misses["unknown"]
+	miss.at = miss.at.Add(-ALB_PUBLIC_KEY_MISS_TTL)
+	v.misses["unknown"] = miss
+	v.mu.Unlock()
+	if _, err := v.publicKey("unknown"); err == nil {
+		t.Fatalf("unknown key is found")
+	}
+	if fake.fetched("unknown") != 2 {
+		t.Errorf("missing key is fetched %d times, want twice", fake.fetched("unknown"))
+	}
+}
+
+func TestAlbPublicKeyRejectsInvalidKeyId(t *testing.T) {
+	fake := newFakeAlbKeys(t, "key-1")
+	v := fake.verifier()
+
+	for _, kid := range []string{"", "../key-1", "key-1/..", "key 1"} {
+		if _, err := v.publicKey(kid); err == nil {
+			t.Errorf("key id %q is accepted", kid)
+		}
+	}
+}
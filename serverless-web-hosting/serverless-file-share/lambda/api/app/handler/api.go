@@ -3,56 +3,189 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/awslabs/aws-lambda-go-api-proxy/core"
 	fiberadapter "github.com/awslabs/aws-lambda-go-api-proxy/fiber"
-	appResponse "github.com/unitypark/serverless-file-share/lambda/api/app/response"
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
 
 	"go.uber.org/zap"
 )
 
 type FiberLambdaHandler interface {
-	// You can define multiple lambda handlers invoked by other events like  CloudWatch, SQS etc.
+	// Handle accepts requests of the http api with payload version 1.0 and 2.0, of the rest api and of
+	// application load balancers and returns the response in the format of the event
+	Handle(ctx context.Context, event json.RawMessage) (interface{}, error)
 	HandleAPIGatewayV2HTTPRequest(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error)
+	HandleAPIGatewayProxyRequest(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+	HandleALBTargetGroupRequest(ctx context.Context, req events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error)
 }
 
 type fiberLambdaHandler struct {
 	serviceName  *string
 	fiberadapter *fiberadapter.FiberLambda
+	albVerifier  *albVerifier
 }
 
-func NewApiHandler(serviceName string, h *fiberadapter.FiberLambda) FiberLambdaHandler {
+// fields, which tell the kinds of events apart
+type eventProbe struct {
+	Version        string `json:"version"`
+	HTTPMethod     string `json:"httpMethod"`
+	RequestContext struct {
+		ELB *events.ELBContext `json:"elb"`
+	} `json:"requestContext"`
+}
+
+func NewApiHandler(serviceName string, h *fiberadapter.FiberLambda, config *appConfig.Config) FiberLambdaHandler {
 	return &fiberLambdaHandler{
 		serviceName:  &serviceName,
 		fiberadapter: h,
+		albVerifier:  newAlbVerifier(config.AlbArn),
+	}
+}
+
+func (h *fiberLambdaHandler) Handle(ctx context.Context, event json.RawMessage) (interface{}, error) {
+	probe := eventProbe{}
+	err := json.Unmarshal(event, &probe)
+	if err != nil {
+		zap.L().Error("event is malformed", zap.Error(err))
+		return nil, err
+	}
+	switch {
+	case probe.RequestContext.ELB != nil:
+		req := events.ALBTargetGroupRequest{}
+		err = json.Unmarshal(event, &req)
+		if err != nil {
+			return nil, err
+		}
+		return h.HandleALBTargetGroupRequest(ctx, req)
+	case probe.Version == "2.0":
+		req := events.APIGatewayV2HTTPRequest{}
+		err = json.Unmarshal(event, &req)
+		if err != nil {
+			return nil, err
+		}
+		return h.HandleAPIGatewayV2HTTPRequest(ctx, req)
+	case len(probe.HTTPMethod) > 0:
+		req := events.APIGatewayProxyRequest{}
+		err = json.Unmarshal(event, &req)
+		if err != nil {
+			return nil, err
+		}
+		return h.HandleAPIGatewayProxyRequest(ctx, req)
 	}
+	zap.L().Error("event is not an http request")
+	return nil, errors.New("event is not an http request")
 }
 
 // Handler will deal with Fiber working with Lambda
 func (h *fiberLambdaHandler) HandleAPIGatewayV2HTTPRequest(ctx context.Context, req events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
 	zap.L().Info(fmt.Sprintf("%s handler is invoked", *h.serviceName))
-	zap.L().Info(fmt.Sprintf("incoming api request %v", req))
+	zap.L().Info("incoming api request", zap.String("method", req.RequestContext.HTTP.Method), zap.String("path", req.RawPath))
 
-	var response events.APIGatewayV2HTTPResponse
+	req.Headers = withIdentity(req.Headers, identityHeader(identityFromV2(req.RequestContext)))
 	response, err := h.fiberadapter.ProxyWithContextV2(ctx, req)
+	logResponse(response.StatusCode, err)
+	return response, err
+}
+
+func (h *fiberLambdaHandler) HandleAPIGatewayProxyRequest(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	zap.L().Info(fmt.Sprintf("%s handler is invoked", *h.serviceName))
+	zap.L().Info("incoming api request", zap.String("method", req.HTTPMethod), zap.String("path", req.Path))
+
+	header := identityHeader(identityFromV1(req.RequestContext))
+	req.Headers = withIdentity(req.Headers, header)
+	req.MultiValueHeaders = withMultiValueIdentity(req.MultiValueHeaders, header)
+	response, err := h.fiberadapter.ProxyWithContext(ctx, req)
+	logResponse(response.StatusCode, err)
+	return response, err
+}
+
+func (h *fiberLambdaHandler) HandleALBTargetGroupRequest(ctx context.Context, req events.ALBTargetGroupRequest) (events.ALBTargetGroupResponse, error) {
+	zap.L().Info(fmt.Sprintf("%s handler is invoked", *h.serviceName))
+	zap.L().Info("incoming load balancer request", zap.String("method", req.HTTPMethod), zap.String("path", req.Path))
+
+	proxyRequest := albToProxyRequest(req)
+	header := identityHeader(h.albVerifier.identity(headerValue(req.Headers, req.MultiValueHeaders, ALB_OIDC_DATA_HEADER)))
+	proxyRequest.Headers = withIdentity(proxyRequest.Headers, header)
+	proxyRequest.MultiValueHeaders = withMultiValueIdentity(proxyRequest.MultiValueHeaders, header)
+	response, err := h.fiberadapter.ProxyWithContext(ctx, proxyRequest)
+	logResponse(response.StatusCode, err)
+	return albFromProxyResponse(response, req.MultiValueHeaders != nil), err
+}
+
+// returns the value of the identity header, which is empty if the caller is not identified. Such requests are
+// rejected by the authorizer middleware of the api routes.
+func identityHeader(identity *entities.Identity, err error) string {
 	if err != nil {
-		zap.L().Error("handler terminates with error", zap.Error(err))
+		zap.L().Warn("caller is not identified", zap.Error(err))
+		return ""
 	}
+	return identity.Encode()
+}
 
-	appRes := new(appResponse.Response)
-	err = json.Unmarshal([]byte(response.Body), appRes)
-	if err != nil {
-		zap.L().Error("handler terminates with error", zap.Error(err))
+// removes the headers, which are only set by the handler and the adapter, from the headers sent by the client
+// and sets the identity header
+func withIdentity(headers map[string]string, identityHeader string) map[string]string {
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	for name := range headers {
+		if isReservedHeader(name) {
+			delete(headers, name)
+		}
+	}
+	if len(identityHeader) > 0 {
+		headers[entities.IDENTITY_HEADER] = identityHeader
+	}
+	return headers
+}
+
+// like withIdentity for multi value headers, which are only used by the adapter if they are sent
+func withMultiValueIdentity(headers map[string][]string, identityHeader string) map[string][]string {
+	if headers == nil {
+		return nil
+	}
+	for name := range headers {
+		if isReservedHeader(name) {
+			delete(headers, name)
+		}
+	}
+	if len(identityHeader) > 0 {
+		headers[entities.IDENTITY_HEADER] = []string{identityHeader}
 	}
-	zap.L().Info("attaching user context to response")
-	appRes.Data.User.Username = req.RequestContext.Authorizer.Lambda["username"].(string)
-	appRes.Data.User.IsAdmin = req.RequestContext.Authorizer.Lambda["isAdmin"].(bool)
+	return headers
+}
 
-	out, _ := json.Marshal(appRes)
-	response.Body = string(out)
-	zap.L().Info("user context is attached to response")
+func isReservedHeader(name string) bool {
+	return strings.EqualFold(name, entities.IDENTITY_HEADER) ||
+		strings.EqualFold(name, core.APIGwContextHeader) ||
+		strings.EqualFold(name, core.APIGwStageVarsHeader)
+}
 
-	zap.L().Info("handler terminates successfully", zap.Any("response", response))
-	return response, err
+// returns the first value of given header, the load balancer sends either single or multi value headers
+func headerValue(headers map[string]string, multiValueHeaders map[string][]string, name string) string {
+	for key, values := range multiValueHeaders {
+		if strings.EqualFold(key, name) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+func logResponse(statusCode int, err error) {
+	if err != nil {
+		zap.L().Error("handler terminates with error", zap.Error(err))
+		return
+	}
+	zap.L().Info("handler terminates successfully", zap.Int("statusCode", statusCode))
 }
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+)
+
+// keys of the context, which is returned by the lambda authorizer
+const (
+	CONTEXT_USERNAME string = "username"
+	CONTEXT_IS_ADMIN string = "isAdmin"
+)
+
+// claims of the id token, which identify the user like in the lambda authorizer
+const (
+	CLAIM_USERNAME string = "email"
+	CLAIM_IS_ADMIN string = "custom:isAdmin"
+)
+
+// returns the identity of the caller of the http api with payload version 2.0. Callers, which are authorized
+// by IAM, are identified by their user id and are never admins.
+func identityFromV2(requestContext events.APIGatewayV2HTTPRequestContext) (*entities.Identity, error) {
+	authorizer := requestContext.Authorizer
+	switch {
+	case authorizer == nil:
+		return nil, errors.New("authorizer context is missing")
+	case authorizer.Lambda != nil:
+		return contextIdentity(authorizer.Lambda, CONTEXT_USERNAME, CONTEXT_IS_ADMIN)
+	case authorizer.JWT != nil:
+		claims := make(map[string]interface{}, len(authorizer.JWT.Claims))
+		for name, value := range authorizer.JWT.Claims {
+			claims[name] = value
+		}
+		return contextIdentity(claims, CLAIM_USERNAME, CLAIM_IS_ADMIN)
+	case authorizer.IAM != nil:
+		return newIdentity(authorizer.IAM.UserID, false)
+	}
+	return nil, errors.New("authorizer context is empty")
+}
+
+// returns the identity of the caller of the rest api or of the http api with payload version 1.0
+func identityFromV1(requestContext events.APIGatewayProxyRequestContext) (*entities.Identity, error) {
+	authorizer := requestContext.Authorizer
+	if lambda, ok := authorizer["lambda"].(map[string]interface{}); ok {
+		return contextIdentity(lambda, CONTEXT_USERNAME, CONTEXT_IS_ADMIN)
+	}
+	if jwt, ok := authorizer["jwt"].(map[string]interface{}); ok {
+		claims, _ := jwt["claims"].(map[string]interface{})
+		return contextIdentity(claims, CLAIM_USERNAME, CLAIM_IS_ADMIN)
+	}
+	if iam, ok := authorizer["iam"].(map[string]interface{}); ok {
+		userId, _ := iam["userId"].(string)
+		return newIdentity(userId, false)
+	}
+	// the rest api passes the claims of cognito user pool authorizers and the flat context of lambda authorizers
+	if claims, ok := authorizer["claims"].(map[string]interface{}); ok {
+		return contextIdentity(claims, CLAIM_USERNAME, CLAIM_IS_ADMIN)
+	}
+	if _, ok := authorizer[CONTEXT_USERNAME]; ok {
+		return contextIdentity(authorizer, CONTEXT_USERNAME, CONTEXT_IS_ADMIN)
+	}
+	if len(requestContext.Identity.UserArn) > 0 {
+		return newIdentity(requestContext.Identity.User, false)
+	}
+	return nil, errors.New("authorizer context is missing")
+}
+
+// returns the identity of given context or claims. The admin flag may be sent as boolean or as string,
+// because the rest api and the claims of id tokens stringify it.
+func contextIdentity(context map[string]interface{}, usernameKey, isAdminKey string) (*entities.Identity, error) {
+	username, _ := context[usernameKey].(string)
+	var isAdmin bool
+	switch value := context[isAdminKey].(type) {
+	case bool:
+		isAdmin = value
+	case string:
+		isAdmin, _ = strconv.ParseBool(value)
+	}
+	return newIdentity(username, isAdmin)
+}
+
+func newIdentity(username string, isAdmin bool) (*entities.Identity, error) {
+	if len(username) == 0 {
+		return nil, errors.New("username is missing in authorizer context")
+	}
+	return &entities.Identity{
+		Username: username,
+		IsAdmin:  isAdmin,
+	}, nil
+}
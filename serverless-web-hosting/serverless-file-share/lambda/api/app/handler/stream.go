@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/gofiber/fiber/v2"
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	"github.com/valyala/fasthttp"
+	"go.uber.org/zap"
+)
+
+// StreamLambdaHandler serves the requests of a function url, whose invoke mode is RESPONSE_STREAM. Responses
+// are streamed to the client while they are written, so that they are not limited by the payload size of lambda.
+type StreamLambdaHandler interface {
+	Handle(ctx context.Context, req *events.LambdaFunctionURLRequest) (*events.LambdaFunctionURLStreamingResponse, error)
+}
+
+type streamLambdaHandler struct {
+	serviceName   string
+	app           *fiber.App
+	tokenVerifier *tokenVerifier
+}
+
+func NewStreamHandler(serviceName string, app *fiber.App, config *appConfig.Config) StreamLambdaHandler {
+	return &streamLambdaHandler{
+		serviceName:   serviceName,
+		app:           app,
+		tokenVerifier: newTokenVerifier(config.JwksUrl, config.TokenIss, config.TokenAud),
+	}
+}
+
+func (h *streamLambdaHandler) Handle(ctx context.Context, req *events.LambdaFunctionURLRequest) (*events.LambdaFunctionURLStreamingResponse, error) {
+	zap.L().Info(fmt.Sprintf("%s handler is invoked", h.serviceName))
+	zap.L().Info("incoming function url request", zap.String("method", req.RequestContext.HTTP.Method), zap.String("path", req.RawPath))
+
+	body := []byte(req.Body)
+	if req.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(req.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode body: %v", err)
+		}
+		body = decoded
+	}
+	uri := req.RawPath
+	if len(req.RawQueryString) > 0 {
+		uri += "?" + req.RawQueryString
+	}
+	request := fasthttp.AcquireRequest()
+	defer fasthttp.ReleaseRequest(request)
+	request.Header.SetMethod(req.RequestContext.HTTP.Method)
+	request.SetRequestURI(uri)
+	request.SetHost(req.RequestContext.DomainName)
+	// function urls pass the cookies apart from the headers
+	headers := withIdentity(req.Headers, identityHeader(h.tokenVerifier.identity(req.Cookies)))
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	if len(req.Cookies) > 0 {
+		request.Header.Set(fiber.HeaderCookie, strings.Join(req.Cookies, "; "))
+	}
+	request.SetBody(body)
+
+	fctx := new(fasthttp.RequestCtx)
+	fctx.Init(request, &net.TCPAddr{IP: net.ParseIP(req.RequestContext.HTTP.SourceIP)}, nil)
+	h.app.Handler()(fctx)
+
+	statusCode := fctx.Response.StatusCode()
+	response := &events.LambdaFunctionURLStreamingResponse{
+		StatusCode: statusCode,
+		Headers:    map[string]string{},
+	}
+	fctx.Response.Header.VisitAll(func(key, value []byte) {
+		name := string(key)
+		if strings.EqualFold(name, fiber.HeaderSetCookie) {
+			response.Cookies = append(response.Cookies, string(value))
+		} else if previous, ok := response.Headers[name]; ok {
+			response.Headers[name] = previous + "," + string(value)
+		} else {
+			response.Headers[name] = string(value)
+		}
+	})
+	// the body is read from the object, while lambda sends it to the client
+	reader, writer := io.Pipe()
+	go func() {
+		err := fctx.Response.BodyWriteTo(writer)
+		writer.CloseWithError(err)
+		logResponse(statusCode, err)
+	}()
+	response.Body = reader
+	return response, nil
+}
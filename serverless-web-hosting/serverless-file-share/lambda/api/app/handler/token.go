@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/jwks"
+)
+
+// cookie of the id token, which is set by the authorization at the edge of the distribution
+const ID_TOKEN_COOKIE string = "idToken"
+
+// tokenVerifier identifies the callers of a function url, which is not protected by the lambda authorizer of the
+// http api, by the id token in their cookies. The keys of the user pool are cached like by the authorizer.
+type tokenVerifier struct {
+	jwksUrl  string
+	issuer   string
+	audience string
+	keys     *jwks.Cache
+}
+
+func newTokenVerifier(jwksUrl, issuer, audience string) *tokenVerifier {
+	return &tokenVerifier{
+		jwksUrl:  jwksUrl,
+		issuer:   issuer,
+		audience: audience,
+		keys:     jwks.New(jwksUrl, jwks.DEFAULT_TTL, jwks.DEFAULT_REFRESH_INTERVAL),
+	}
+}
+
+// returns the identity of the user of the id token in given cookies
+func (v *tokenVerifier) identity(cookies []string) (*entities.Identity, error) {
+	if len(v.jwksUrl) == 0 {
+		return nil, errors.New("user pool is not configured")
+	}
+	request := http.Request{Header: http.Header{"Cookie": cookies}}
+	cookie, err := request.Cookie(ID_TOKEN_COOKIE)
+	if err != nil {
+		return nil, errors.New("id token is missing")
+	}
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(cookie.Value, claims, v.keys.Keyfunc, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+	if !claims.VerifyExpiresAt(now, true) || !claims.VerifyIssuedAt(now, true) {
+		return nil, errors.New("id token is expired")
+	}
+	if !claims.VerifyIssuer(v.issuer, true) || !claims.VerifyAudience(v.audience, true) {
+		return nil, errors.New("id token is not issued for the file share")
+	}
+	if use, _ := claims["token_use"].(string); use != "id" {
+		return nil, errors.New("token is not an id token")
+	}
+	return contextIdentity(claims, CLAIM_USERNAME, CLAIM_IS_ADMIN)
+}
@@ -0,0 +1,72 @@
+package response
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Access is the presenter object of a single download of a share
+type Access struct {
+	ShareId    string `json:"shareId"`
+	Path       string `json:"path,omitempty"`
+	Filename   string `json:"filename,omitempty"`
+	AccessedAt string `json:"accessedAt"`
+	AccessedBy string `json:"accessedBy"`
+}
+
+// AccessesSuccessResponse returns a page of downloads and the cursor of the next page
+func AccessesSuccessResponse(data []entities.Asset, cursor string) *fiber.Map {
+	accesses := make([]Access, 0, len(data))
+	for i := range data {
+		accesses = append(accesses, toAccess(&data[i]))
+	}
+	return &fiber.Map{
+		"data": fiber.Map{
+			"accesses": accesses,
+			"cursor":   cursor,
+		},
+		"error": nil,
+	}
+}
+
+// AccessesCsv returns a page of downloads as csv with a header line
+func AccessesCsv(data []entities.Asset) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w := csv.NewWriter(buf)
+	err := w.Write([]string{"shareId", "path", "filename", "accessedAt", "accessedBy"})
+	if err != nil {
+		return nil, err
+	}
+	for i := range data {
+		access := toAccess(&data[i])
+		err = w.Write([]string{access.ShareId, csvCell(access.Path), csvCell(access.Filename), access.AccessedAt, csvCell(access.AccessedBy)})
+		if err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// prevents that a cell is evaluated as formula, when the export is opened in a spreadsheet
+func csvCell(value string) string {
+	if len(value) > 0 && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func toAccess(data *entities.Asset) Access {
+	return Access{
+		ShareId:    data.ShareId(),
+		Path:       data.Path,
+		Filename:   data.Filename,
+		AccessedAt: data.AccessedAt,
+		AccessedBy: data.AccessedBy,
+	}
+}
@@ -11,34 +11,78 @@ type User struct {
 	IsAdmin  bool   `json:"isAdmin,omitempty"`
 }
 
-// Asset is the presenter object which will be passed in the response by Handler
-type Asset struct {
-	Url       string `json:"url,omitempty"`
-	Filename  string `json:"filename,omitempty"`
-	AccessKey string `json:"accessKey,omitempty"`
-	User      User   `json:"user,omitempty"`
+type Part struct {
+	PartNumber int32  `json:"partNumber"`
+	ETag       string `json:"etag,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	Url        string `json:"url,omitempty"`
 }
 
-type Response struct {
-	Data  Asset  `json:"data"`
-	Error string `json:"error"`
+// Asset is the presenter object which will be passed in the response by Handler
+type Asset struct {
+	Url          string `json:"url,omitempty"`
+	Filename     string `json:"filename,omitempty"`
+	AccessKey    string `json:"accessKey,omitempty"`
+	ShareId      string `json:"shareId,omitempty"`
+	Path         string `json:"path,omitempty"`
+	VersionId    string `json:"versionId,omitempty"`
+	ExpiringAt   string `json:"expiringAt,omitempty"`
+	MaxDownloads int    `json:"maxDownloads,omitempty"`
+	OneTime      bool   `json:"oneTime,omitempty"`
+	State        string `json:"state,omitempty"`
+	UploadId     string `json:"uploadId,omitempty"`
+	FileSize     int64  `json:"fileSize,omitempty"`
+	PartSize     int64  `json:"partSize,omitempty"`
+	PartCount    int32  `json:"partCount,omitempty"`
+	Parts        []Part `json:"parts,omitempty"`
+	ContentType  string `json:"contentType,omitempty"`
+	PreviewUrl   string `json:"previewUrl,omitempty"`
+	// form fields of a presigned post
+	Fields map[string]string `json:"fields,omitempty"`
 }
 
 func UrlSuccessResponse(data *entities.Asset) *fiber.Map {
 	return &fiber.Map{
 		"data": Asset{
-			Url:       data.Url,
-			Filename:  data.Filename,
-			AccessKey: data.AccessKey,
-			User: User{
-				Username: "",
-				IsAdmin:  false,
-			},
+			Url:          data.Url,
+			Filename:     data.Filename,
+			AccessKey:    data.AccessKey,
+			ShareId:      data.ShareId(),
+			Path:         data.Path,
+			VersionId:    data.VersionId,
+			ExpiringAt:   data.ExpiringAt,
+			MaxDownloads: data.MaxDownloads,
+			OneTime:      data.OneTime,
+			State:        data.State,
+			UploadId:     data.UploadId,
+			FileSize:     data.FileSize,
+			PartSize:     data.PartSize,
+			PartCount:    data.PartCount,
+			Parts:        toParts(data.Parts),
+			ContentType:  data.ContentType,
+			PreviewUrl:   data.PreviewUrl,
+			Fields:       data.Fields,
 		},
 		"error": nil,
 	}
 }
 
+func toParts(parts []entities.Part) []Part {
+	if len(parts) == 0 {
+		return nil
+	}
+	res := make([]Part, 0, len(parts))
+	for _, part := range parts {
+		res = append(res, Part{
+			PartNumber: part.PartNumber,
+			ETag:       part.ETag,
+			Size:       part.Size,
+			Url:        part.Url,
+		})
+	}
+	return res
+}
+
 // UrlErrorResponse is the ErrorResponse that will be passed in the response by Handler
 func UrlErrorResponse(err error) *fiber.Map {
 	return &fiber.Map{
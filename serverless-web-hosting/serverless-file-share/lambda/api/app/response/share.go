@@ -0,0 +1,76 @@
+package response
+
+import (
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Share is the presenter object of a share, which is managed by its creator
+type Share struct {
+	Id            string `json:"id"`
+	Path          string `json:"path"`
+	VersionId     string `json:"versionId,omitempty"`
+	Filename      string `json:"filename"`
+	State         string `json:"state,omitempty"`
+	CreatedAt     string `json:"createdAt"`
+	ExpiringAt    string `json:"expiringAt"`
+	RevokedAt     string `json:"revokedAt,omitempty"`
+	DownloadCount int    `json:"downloadCount"`
+	MaxDownloads  int    `json:"maxDownloads,omitempty"`
+	Protected     bool   `json:"protected"`
+	LockedUntil   string `json:"lockedUntil,omitempty"`
+	Notify        bool   `json:"notify"`
+	OneTime       bool   `json:"oneTime,omitempty"`
+	DeleteObject  bool   `json:"deleteObject,omitempty"`
+	ConsumedAt    string `json:"consumedAt,omitempty"`
+	ObjectDeleted bool   `json:"objectDeleted,omitempty"`
+	NotBefore     string `json:"notBefore,omitempty"`
+	IpAddress     string `json:"ipAddress,omitempty"`
+}
+
+func ShareSuccessResponse(data *entities.Asset) *fiber.Map {
+	return &fiber.Map{
+		"data":  toShare(data),
+		"error": nil,
+	}
+}
+
+// SharesSuccessResponse returns a page of shares and the cursor of the next page
+func SharesSuccessResponse(data []entities.Asset, cursor string) *fiber.Map {
+	shares := make([]Share, 0, len(data))
+	for i := range data {
+		shares = append(shares, toShare(&data[i]))
+	}
+	return &fiber.Map{
+		"data": fiber.Map{
+			"shares": shares,
+			"cursor": cursor,
+		},
+		"error": nil,
+	}
+}
+
+func toShare(data *entities.Asset) Share {
+	return Share{
+		Id:            data.ShareId(),
+		Path:          data.Path,
+		VersionId:     data.VersionId,
+		Filename:      data.Filename,
+		State:         data.State,
+		CreatedAt:     data.CreatedAt,
+		ExpiringAt:    data.ExpiringAt,
+		RevokedAt:     data.RevokedAt,
+		DownloadCount: data.DownloadCount,
+		MaxDownloads:  data.MaxDownloads,
+		Protected:     data.PassphraseHash != "",
+		LockedUntil:   data.LockedUntil,
+		Notify:        data.Notify,
+		OneTime:       data.OneTime,
+		DeleteObject:  data.DeleteObject,
+		ConsumedAt:    data.ConsumedAt,
+		ObjectDeleted: data.ObjectDeletedAt != "",
+		NotBefore:     data.NotBefore,
+		IpAddress:     data.IpAddress,
+	}
+}
@@ -0,0 +1,45 @@
+package response
+
+import (
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Usage is the presenter object of the storage of a user. Quota is unlimited if it is zero.
+type Usage struct {
+	Username  string `json:"username"`
+	UsedBytes int64  `json:"usedBytes"`
+	Quota     int64  `json:"quota"`
+	UpdatedAt string `json:"updatedAt,omitempty"`
+}
+
+func UsageSuccessResponse(data *entities.Asset) *fiber.Map {
+	return &fiber.Map{
+		"data":  toUsage(data),
+		"error": nil,
+	}
+}
+
+// ConfigSuccessResponse returns the configuration of the caller, who is identified by the authorizer
+func ConfigSuccessResponse(identity *entities.Identity, usage *entities.Asset) *fiber.Map {
+	return &fiber.Map{
+		"data": fiber.Map{
+			"user": User{
+				Username: identity.Username,
+				IsAdmin:  identity.IsAdmin,
+			},
+			"usage": toUsage(usage),
+		},
+		"error": nil,
+	}
+}
+
+func toUsage(data *entities.Asset) Usage {
+	return Usage{
+		Username:  data.Username,
+		UsedBytes: data.UsedBytes,
+		Quota:     data.Quota,
+		UpdatedAt: data.UpdatedAt,
+	}
+}
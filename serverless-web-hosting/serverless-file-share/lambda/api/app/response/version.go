@@ -0,0 +1,38 @@
+package response
+
+import (
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/blobstore"
+	"github.com/unitypark/serverless-file-share/lambda/api/types"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Version is the presenter object of a version of a file, which can be shared by its id
+type Version struct {
+	VersionId    string `json:"versionId"`
+	Size         int64  `json:"size"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified"`
+	IsLatest     bool   `json:"isLatest"`
+}
+
+// VersionsSuccessResponse returns the versions of the file at given path, newest first
+func VersionsSuccessResponse(path string, data []blobstore.ObjectInfo) *fiber.Map {
+	versions := make([]Version, 0, len(data))
+	for _, version := range data {
+		versions = append(versions, Version{
+			VersionId:    version.VersionId,
+			Size:         version.Size,
+			ETag:         version.ETag,
+			LastModified: version.LastModified.UTC().Format(types.TIME_FORMAT),
+			IsLatest:     version.IsLatest,
+		})
+	}
+	return &fiber.Map{
+		"data": fiber.Map{
+			"path":     path,
+			"versions": versions,
+		},
+		"error": nil,
+	}
+}
@@ -0,0 +1,119 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/unitypark/serverless-file-share/lambda/api/app/response"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/service"
+	"github.com/unitypark/serverless-file-share/lambda/api/types"
+	"go.uber.org/zap"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// export formats of the audit trail
+const (
+	FORMAT_JSON string = "json"
+	FORMAT_CSV  string = "csv"
+)
+
+// header of the cursor of the next page, if the audit trail is exported as csv
+const NEXT_CURSOR_HEADER string = "X-Next-Cursor"
+
+// ErrForbidden is returned, if the user is not allowed to call the route
+var ErrForbidden = service.ErrForbidden
+
+func GetShareAccesses(fileShareService service.FileShareService) fiber.Handler {
+	zap.L().Debug("routing request to GET /api/shares/:id/accesses")
+	return func(c *fiber.Ctx) error {
+		shareId := c.Params("id")
+		if len(shareId) == 0 {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(response.UrlErrorResponse(errors.New("path parameter is empty")))
+		}
+		limit, from, to, err := getAccessesQuery(c)
+		if err != nil {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+
+		accesses, cursor, err := fileShareService.ListAccesses(shareId, identity(c).Username, from, to, limit, c.Query("cursor"))
+		if err != nil {
+			c.Status(errorStatus(err))
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+		return sendAccesses(c, accesses, cursor)
+	}
+}
+
+func GetAccesses(fileShareService service.FileShareService) fiber.Handler {
+	zap.L().Debug("routing request to GET /api/accesses")
+	return func(c *fiber.Ctx) error {
+		if !identity(c).IsAdmin {
+			c.Status(errorStatus(ErrForbidden))
+			return c.JSON(response.UrlErrorResponse(fmt.Errorf("%w: audit trail of all shares is only visible to admins", ErrForbidden)))
+		}
+		limit, from, to, err := getAccessesQuery(c)
+		if err != nil {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+
+		accesses, cursor, err := fileShareService.ListAllAccesses(from, to, limit, c.Query("cursor"))
+		if err != nil {
+			c.Status(errorStatus(err))
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+		return sendAccesses(c, accesses, cursor)
+	}
+}
+
+// returns page size and time range of the audit trail. Without from and to, the whole trail is returned.
+func getAccessesQuery(c *fiber.Ctx) (int, time.Time, time.Time, error) {
+	var (
+		from = time.Unix(0, 0).UTC()
+		to   = entities.GetCurrentUTCTime()
+	)
+	limit, err := getPageSize(c)
+	if err != nil {
+		return 0, from, to, err
+	}
+	if format := c.Query("format", FORMAT_JSON); format != FORMAT_JSON && format != FORMAT_CSV {
+		return 0, from, to, fmt.Errorf("format must be %s or %s", FORMAT_JSON, FORMAT_CSV)
+	}
+	if value := c.Query("from"); len(value) > 0 {
+		from, err = time.Parse(types.TIME_FORMAT, value)
+		if err != nil {
+			return 0, from, to, fmt.Errorf("from must be formatted as %s", types.TIME_FORMAT)
+		}
+	}
+	if value := c.Query("to"); len(value) > 0 {
+		to, err = time.Parse(types.TIME_FORMAT, value)
+		if err != nil {
+			return 0, from, to, fmt.Errorf("to must be formatted as %s", types.TIME_FORMAT)
+		}
+	}
+	return limit, from, to, nil
+}
+
+func sendAccesses(c *fiber.Ctx, accesses []entities.Asset, cursor string) error {
+	if c.Query("format", FORMAT_JSON) == FORMAT_CSV {
+		out, err := response.AccessesCsv(accesses)
+		if err != nil {
+			c.Status(http.StatusInternalServerError)
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+		c.Set(NEXT_CURSOR_HEADER, cursor)
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="accesses.csv"`)
+		c.Set(fiber.HeaderContentType, "text/csv")
+		c.Status(http.StatusOK)
+		return c.Send(out)
+	}
+	c.Status(http.StatusOK)
+	zap.L().Debug("returning context", zap.Any("fiber.context", c))
+	return c.JSON(response.AccessesSuccessResponse(accesses, cursor))
+}
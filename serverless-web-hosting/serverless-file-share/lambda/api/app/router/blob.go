@@ -0,0 +1,146 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unitypark/serverless-file-share/lambda/api/app/response"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/blobstore"
+	"go.uber.org/zap"
+)
+
+// local uploads are sent as parts of at least 16 MiB, the default body limit of fiber is 4 MiB
+const BODY_LIMIT_IN_BYTES int = 64 * 1024 * 1024
+
+// LocalBlobRouter serves the presigned urls of the local blob store, so that the frontend can up- and download
+// files without s3. Nothing is registered, if the files are stored in s3.
+func LocalBlobRouter(app fiber.Router, blobStore blobstore.BlobStore) {
+	localStore, ok := blobStore.(*blobstore.LocalStore)
+	if !ok {
+		return
+	}
+	app.Get(blobstore.LOCAL_ROUTE+"*", GetBlob(localStore))
+	app.Put(blobstore.LOCAL_ROUTE+"*", PutBlob(localStore))
+	app.Post(blobstore.LOCAL_ROUTE, PostBlob(localStore))
+}
+
+func GetBlob(localStore *blobstore.LocalStore) fiber.Handler {
+	zap.L().Debug("routing request to GET " + blobstore.LOCAL_ROUTE)
+	return func(c *fiber.Ctx) error {
+		key, err := verifyBlobUrl(c, localStore, http.MethodGet)
+		if err != nil {
+			return sendBlobError(c, err)
+		}
+		object, err := localStore.Head(key)
+		if err != nil {
+			return sendBlobError(c, err)
+		}
+		// urls of a pinned version fail like in s3, once the object is overwritten
+		body, err := localStore.GetVersion(key, c.Query(blobstore.QUERY_VERSION_ID))
+		if err != nil {
+			return sendBlobError(c, err)
+		}
+		c.Set(fiber.HeaderContentType, object.ContentType)
+		c.Set(fiber.HeaderETag, object.ETag)
+		c.Status(http.StatusOK)
+		return c.SendStream(body, int(object.Size))
+	}
+}
+
+func PutBlob(localStore *blobstore.LocalStore) fiber.Handler {
+	zap.L().Debug("routing request to PUT " + blobstore.LOCAL_ROUTE)
+	return func(c *fiber.Ctx) error {
+		key, err := verifyBlobUrl(c, localStore, http.MethodPut)
+		if err != nil {
+			return sendBlobError(c, err)
+		}
+		var etag string
+		if uploadId := c.Query(blobstore.QUERY_UPLOAD_ID); uploadId != "" {
+			partNumber, err := strconv.Atoi(c.Query(blobstore.QUERY_PART_NUMBER))
+			if err != nil {
+				return sendBlobError(c, blobstore.ErrInvalidSignature)
+			}
+			etag, err = localStore.PutPart(key, uploadId, int32(partNumber), bytes.NewReader(c.Body()))
+			if err != nil {
+				return sendBlobError(c, err)
+			}
+		} else {
+			etag, err = localStore.Put(key, bytes.NewReader(c.Body()))
+			if err != nil {
+				return sendBlobError(c, err)
+			}
+		}
+		// the frontend reads the etag of every part to complete the upload, like with s3
+		c.Set(fiber.HeaderETag, etag)
+		c.Set(fiber.HeaderAccessControlExposeHeaders, fiber.HeaderETag)
+		return c.SendStatus(http.StatusOK)
+	}
+}
+
+func PostBlob(localStore *blobstore.LocalStore) fiber.Handler {
+	zap.L().Debug("routing request to POST " + blobstore.LOCAL_ROUTE)
+	return func(c *fiber.Ctx) error {
+		form, err := c.MultipartForm()
+		if err != nil {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+		files := form.File[blobstore.FIELD_FILE]
+		if len(files) != 1 {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(response.UrlErrorResponse(errors.New("form must contain a single file")))
+		}
+		fields := map[string]string{}
+		for name, values := range form.Value {
+			if len(values) > 0 {
+				fields[name] = values[0]
+			}
+		}
+		err = localStore.VerifyPost(fields, files[0].Size)
+		if err != nil {
+			return sendBlobError(c, err)
+		}
+		file, err := files[0].Open()
+		if err != nil {
+			return sendBlobError(c, err)
+		}
+		defer file.Close()
+		etag, err := localStore.Put(fields[blobstore.FIELD_KEY], file)
+		if err != nil {
+			return sendBlobError(c, err)
+		}
+		c.Set(fiber.HeaderETag, etag)
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// returns the key of the requested object, if the url is signed by the local store
+func verifyBlobUrl(c *fiber.Ctx, localStore *blobstore.LocalStore, method string) (string, error) {
+	key, err := url.PathUnescape(c.Params("*"))
+	if err != nil {
+		return "", blobstore.ErrInvalidKey
+	}
+	query, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+	if err != nil {
+		return "", blobstore.ErrInvalidSignature
+	}
+	return key, localStore.Verify(method, key, query)
+}
+
+func sendBlobError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, blobstore.ErrInvalidSignature), errors.Is(err, blobstore.ErrPolicyViolation):
+		c.Status(http.StatusForbidden)
+	case errors.Is(err, blobstore.ErrInvalidKey):
+		c.Status(http.StatusBadRequest)
+	case errors.Is(err, blobstore.ErrNotFound):
+		c.Status(http.StatusNotFound)
+	default:
+		c.Status(http.StatusInternalServerError)
+	}
+	return c.JSON(response.UrlErrorResponse(err))
+}
@@ -3,9 +3,12 @@ package router
 import (
 	"errors"
 	"fmt"
+	"mime"
 	"net/http"
+	"strconv"
 
 	"github.com/unitypark/serverless-file-share/lambda/api/app/response"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/blobstore"
 	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
 	"github.com/unitypark/serverless-file-share/lambda/api/internal/service"
 	"go.uber.org/zap"
@@ -13,52 +16,162 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
+// defaults of the share options, if they are not given by the sharer
 const (
 	DOWNLOAD_URL_EXPIRING_TIME_IN_MINUTES int = 1440
+	DOWNLOAD_COUNT                        int = 100
 	UPLOAD_URL_EXPIRING_TIME_IN_MINUTES   int = 10
 )
 
-func FileShareRouter(app fiber.Router, fileShareService service.FileShareService) {
+// header of the passphrase of a protected share, it is not sent in query to keep it out of access logs
+const PASSPHRASE_HEADER string = "X-Share-Passphrase"
+
+// page size of listings
+const (
+	DEFAULT_PAGE_SIZE int = 20
+	MAX_PAGE_SIZE     int = 100
+)
+
+// FileShareRouter routes the api of the file share. Access keys are resolved behind the rate limiter. The content
+// of shares is routed apart by ContentRouter, because responses of the http api are limited to 6 MB.
+func FileShareRouter(app fiber.Router, fileShareService service.FileShareService, rateLimiter fiber.Handler) {
 	app.Get("/api/config", GetConfig(fileShareService))
 	app.Post("/api/uploads", PostUploadUrl(fileShareService))
+	app.Get("/api/uploads/:id/parts", GetUploadParts(fileShareService))
+	app.Post("/api/uploads/:id/complete", PostUploadComplete(fileShareService))
+	app.Delete("/api/uploads/:id", DeleteUpload(fileShareService))
 	app.Post("/api/downloads", PostDownloadUrl(fileShareService))
-	app.Get("/api/downloads/:key", GetDownloadUrl(fileShareService))
+	app.Get("/api/downloads/:key", rateLimiter, GetDownloadUrl(fileShareService))
+	app.Get("/api/files/versions", GetFileVersions(fileShareService))
+	app.Get("/api/shares", GetShares(fileShareService))
+	app.Get("/api/shares/:id", GetShare(fileShareService))
+	app.Delete("/api/shares/:id", DeleteShare(fileShareService))
+	app.Get("/api/shares/:id/accesses", GetShareAccesses(fileShareService))
+	app.Get("/api/accesses", GetAccesses(fileShareService))
+	app.Get("/api/quotas/:username", GetQuota(fileShareService))
+	app.Put("/api/quotas/:username", PutQuota(fileShareService))
+}
+
+// ContentRouter routes the content of shares, which is only served by handlers streaming their responses
+func ContentRouter(app fiber.Router, fileShareService service.FileShareService, rateLimiter fiber.Handler) {
+	app.Get("/api/downloads/:key/content", rateLimiter, GetDownloadContent(fileShareService))
 }
 
 func GetConfig(fileShareService service.FileShareService) fiber.Handler {
 	zap.L().Debug("routing request to GET /api/config")
 	return func(c *fiber.Ctx) error {
+		caller := identity(c)
+		usage, err := fileShareService.GetUsage(caller)
+		if err != nil {
+			c.Status(errorStatus(err))
+			return c.JSON(response.UrlErrorResponse(err))
+		}
 		c.Status(http.StatusOK)
-		zap.L().Debug("returning context", zap.Any("fiber.context", c))
-		return c.JSON(response.UrlSuccessResponse(new(entities.Asset)))
+		return c.JSON(response.ConfigSuccessResponse(caller, usage))
 	}
 }
 
 func PostUploadUrl(fileShareService service.FileShareService) fiber.Handler {
 	zap.L().Debug("routing request to POST /api/uploads")
 	return func(c *fiber.Ctx) error {
-		var requestBody entities.PostDownloadRequest
+		var requestBody entities.PostUploadRequest
 		err := c.BodyParser(&requestBody)
 		if err != nil {
 			c.Status(http.StatusBadRequest)
 			return c.JSON(response.UrlErrorResponse(err))
 		}
 		if requestBody.Path == "" {
-			c.Status(http.StatusInternalServerError)
+			c.Status(http.StatusBadRequest)
+			return c.JSON(response.UrlErrorResponse(
+				errors.New("please specify path of the file in body")))
+		}
+		if requestBody.Size <= 0 {
+			c.Status(http.StatusBadRequest)
 			return c.JSON(response.UrlErrorResponse(
-				errors.New("please specify converting url in body")))
+				errors.New("please specify file size in body")))
 		}
-		if requestBody.Username == "" {
-			c.Status(http.StatusInternalServerError)
+		if requestBody.ContentType == "" {
+			c.Status(http.StatusBadRequest)
 			return c.JSON(response.UrlErrorResponse(
-				errors.New("please specify username in body")))
+				errors.New("please specify content type in body")))
 		}
 		zap.L().Info(fmt.Sprintf("retrieved path from body: %s", requestBody.Path))
-		zap.L().Info(fmt.Sprintf("retrieved username from body: %s", requestBody.Username))
 
-		result, err := fileShareService.CreateUploadUrl(requestBody.Path, UPLOAD_URL_EXPIRING_TIME_IN_MINUTES)
+		result, err := fileShareService.CreateUploadUrl(requestBody.Path, identity(c), requestBody.Size, requestBody.ContentType, UPLOAD_URL_EXPIRING_TIME_IN_MINUTES)
 		if err != nil {
-			c.Status(http.StatusInternalServerError)
+			c.Status(errorStatus(err))
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+		c.Status(http.StatusOK)
+		zap.L().Debug("returning context", zap.Any("fiber.context", c))
+		return c.JSON(response.UrlSuccessResponse(result))
+	}
+}
+
+func GetUploadParts(fileShareService service.FileShareService) fiber.Handler {
+	zap.L().Debug("routing request to GET /api/uploads/:id/parts")
+	return func(c *fiber.Ctx) error {
+		uploadId := c.Params("id")
+		if len(uploadId) == 0 {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(response.UrlErrorResponse(errors.New("path parameter is empty")))
+		}
+		zap.L().Debug(fmt.Sprintf("retrieved path parameter: %s", uploadId))
+
+		result, err := fileShareService.GetUploadParts(uploadId, identity(c), UPLOAD_URL_EXPIRING_TIME_IN_MINUTES)
+		if err != nil {
+			c.Status(errorStatus(err))
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+		c.Status(http.StatusOK)
+		zap.L().Debug("returning context", zap.Any("fiber.context", c))
+		return c.JSON(response.UrlSuccessResponse(result))
+	}
+}
+
+func PostUploadComplete(fileShareService service.FileShareService) fiber.Handler {
+	zap.L().Debug("routing request to POST /api/uploads/:id/complete")
+	return func(c *fiber.Ctx) error {
+		uploadId := c.Params("id")
+		if len(uploadId) == 0 {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(response.UrlErrorResponse(errors.New("path parameter is empty")))
+		}
+		zap.L().Debug(fmt.Sprintf("retrieved path parameter: %s", uploadId))
+		// parts are optional, uploaded parts in s3 are used without them
+		var requestBody entities.CompleteUploadRequest
+		if len(c.Body()) > 0 {
+			err := c.BodyParser(&requestBody)
+			if err != nil {
+				c.Status(http.StatusBadRequest)
+				return c.JSON(response.UrlErrorResponse(err))
+			}
+		}
+
+		result, err := fileShareService.CompleteUpload(uploadId, identity(c), requestBody.Parts)
+		if err != nil {
+			c.Status(errorStatus(err))
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+		c.Status(http.StatusOK)
+		zap.L().Debug("returning context", zap.Any("fiber.context", c))
+		return c.JSON(response.UrlSuccessResponse(result))
+	}
+}
+
+func DeleteUpload(fileShareService service.FileShareService) fiber.Handler {
+	zap.L().Debug("routing request to DELETE /api/uploads/:id")
+	return func(c *fiber.Ctx) error {
+		uploadId := c.Params("id")
+		if len(uploadId) == 0 {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(response.UrlErrorResponse(errors.New("path parameter is empty")))
+		}
+		zap.L().Debug(fmt.Sprintf("retrieved path parameter: %s", uploadId))
+
+		result, err := fileShareService.AbortUpload(uploadId, identity(c))
+		if err != nil {
+			c.Status(errorStatus(err))
 			return c.JSON(response.UrlErrorResponse(err))
 		}
 		c.Status(http.StatusOK)
@@ -72,19 +185,15 @@ func GetDownloadUrl(fileShareService service.FileShareService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		accessKey := c.Params("key")
 		if len(accessKey) == 0 {
-			c.Status(http.StatusInternalServerError)
+			c.Status(http.StatusBadRequest)
 			return c.JSON(response.UrlErrorResponse(errors.New("path parameter is empty")))
 		}
 		zap.L().Debug(fmt.Sprintf("retrieved path parameter: %s", accessKey))
-		username := c.Query("id")
-		if len(username) == 0 {
-			c.Status(http.StatusInternalServerError)
-			return c.JSON(response.UrlErrorResponse(errors.New("query user is empty")))
-		}
+		username := identity(c).Username
 
-		result, err := fileShareService.GetUrl(accessKey, username)
+		result, err := fileShareService.GetUrl(accessKey, username, c.Get(PASSPHRASE_HEADER))
 		if err != nil {
-			c.Status(http.StatusInternalServerError)
+			c.Status(errorStatus(err))
 			return c.JSON(response.UrlErrorResponse(err))
 		}
 		zap.L().Debug(fmt.Sprintf("result: %v", result))
@@ -95,6 +204,56 @@ func GetDownloadUrl(fileShareService service.FileShareService) fiber.Handler {
 	}
 }
 
+// GetDownloadContent streams the object of a share through the api, for clients which cannot reach the bucket.
+// It answers conditional and range requests, so that clients can resume their downloads.
+func GetDownloadContent(fileShareService service.FileShareService) fiber.Handler {
+	zap.L().Debug("routing request to GET /api/downloads/:key/content")
+	return func(c *fiber.Ctx) error {
+		accessKey := c.Params("key")
+		if len(accessKey) == 0 {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(response.UrlErrorResponse(errors.New("path parameter is empty")))
+		}
+		zap.L().Debug(fmt.Sprintf("retrieved path parameter: %s", accessKey))
+
+		content, err := fileShareService.GetContent(entities.ContentRequest{
+			AccessKey:   accessKey,
+			Passphrase:  c.Get(PASSPHRASE_HEADER),
+			IfNoneMatch: c.Get(fiber.HeaderIfNoneMatch),
+			IfRange:     c.Get(fiber.HeaderIfRange),
+			Range:       c.Get(fiber.HeaderRange),
+		}, identity(c).Username)
+		if err != nil {
+			if errors.Is(err, service.ErrRangeNotSatisfiable) && content != nil {
+				c.Set(fiber.HeaderContentRange, fmt.Sprintf("%s */%d", blobstore.RANGE_UNIT, content.Object.Size))
+			}
+			c.Status(errorStatus(err))
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+		// every download is revalidated, so that it is counted
+		c.Set(fiber.HeaderETag, content.Object.ETag)
+		c.Set(fiber.HeaderCacheControl, "private, no-cache")
+		c.Set(fiber.HeaderAcceptRanges, blobstore.RANGE_UNIT)
+		if content.Body == nil {
+			return c.SendStatus(http.StatusNotModified)
+		}
+		contentType := content.Object.ContentType
+		if contentType == "" {
+			contentType = fiber.MIMEOctetStream
+		}
+		c.Set(fiber.HeaderContentType, contentType)
+		c.Set(fiber.HeaderContentDisposition, contentDisposition(content.Share.Filename))
+		c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+		if content.Range != nil {
+			c.Set(fiber.HeaderContentRange, content.Range.ContentRange(content.Object.Size))
+			c.Status(http.StatusPartialContent)
+			return c.SendStream(content.Body, int(content.Range.Length))
+		}
+		c.Status(http.StatusOK)
+		return c.SendStream(content.Body, int(content.Object.Size))
+	}
+}
+
 func PostDownloadUrl(fileShareService service.FileShareService) fiber.Handler {
 	zap.L().Debug("routing request to POST /api/downloads")
 	return func(c *fiber.Ctx) error {
@@ -105,21 +264,22 @@ func PostDownloadUrl(fileShareService service.FileShareService) fiber.Handler {
 			return c.JSON(response.UrlErrorResponse(err))
 		}
 		if requestBody.Path == "" {
-			c.Status(http.StatusInternalServerError)
-			return c.JSON(response.UrlErrorResponse(
-				errors.New("please specify converting url in body")))
-		}
-		if requestBody.Username == "" {
-			c.Status(http.StatusInternalServerError)
+			c.Status(http.StatusBadRequest)
 			return c.JSON(response.UrlErrorResponse(
-				errors.New("please specify username in body")))
+				errors.New("please specify path of the shared file or folder in body")))
 		}
 		zap.L().Info(fmt.Sprintf("retrieved path from body: %s", requestBody.Path))
-		zap.L().Info(fmt.Sprintf("retrieved username from body: %s", requestBody.Username))
 
-		result, err := fileShareService.CreateDownloadUrl(requestBody.Path, requestBody.Username, DOWNLOAD_URL_EXPIRING_TIME_IN_MINUTES)
+		if requestBody.ExpiresIn == 0 {
+			requestBody.ExpiresIn = DOWNLOAD_URL_EXPIRING_TIME_IN_MINUTES
+		}
+		if requestBody.MaxDownloads == 0 {
+			requestBody.MaxDownloads = DOWNLOAD_COUNT
+		}
+
+		result, err := fileShareService.CreateDownloadUrl(requestBody, identity(c))
 		if err != nil {
-			c.Status(http.StatusInternalServerError)
+			c.Status(errorStatus(err))
 			return c.JSON(response.UrlErrorResponse(err))
 		}
 		c.Status(http.StatusOK)
@@ -127,3 +287,137 @@ func PostDownloadUrl(fileShareService service.FileShareService) fiber.Handler {
 		return c.JSON(response.UrlSuccessResponse(result))
 	}
 }
+
+func GetFileVersions(fileShareService service.FileShareService) fiber.Handler {
+	zap.L().Debug("routing request to GET /api/files/versions")
+	return func(c *fiber.Ctx) error {
+		path := c.Query("path")
+		if len(path) == 0 {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(response.UrlErrorResponse(errors.New("path query parameter is empty")))
+		}
+
+		versions, err := fileShareService.ListFileVersions(path, identity(c))
+		if err != nil {
+			c.Status(errorStatus(err))
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+		c.Status(http.StatusOK)
+		return c.JSON(response.VersionsSuccessResponse(path, versions))
+	}
+}
+
+func GetShares(fileShareService service.FileShareService) fiber.Handler {
+	zap.L().Debug("routing request to GET /api/shares")
+	return func(c *fiber.Ctx) error {
+		username := identity(c).Username
+		limit, err := getPageSize(c)
+		if err != nil {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+
+		shares, cursor, err := fileShareService.ListShares(username, limit, c.Query("cursor"))
+		if err != nil {
+			c.Status(errorStatus(err))
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+		c.Status(http.StatusOK)
+		zap.L().Debug("returning context", zap.Any("fiber.context", c))
+		return c.JSON(response.SharesSuccessResponse(shares, cursor))
+	}
+}
+
+func GetShare(fileShareService service.FileShareService) fiber.Handler {
+	zap.L().Debug("routing request to GET /api/shares/:id")
+	return func(c *fiber.Ctx) error {
+		shareId := c.Params("id")
+		if len(shareId) == 0 {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(response.UrlErrorResponse(errors.New("path parameter is empty")))
+		}
+		username := identity(c).Username
+
+		result, err := fileShareService.GetShare(shareId, username)
+		if err != nil {
+			c.Status(errorStatus(err))
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+		c.Status(http.StatusOK)
+		zap.L().Debug("returning context", zap.Any("fiber.context", c))
+		return c.JSON(response.ShareSuccessResponse(result))
+	}
+}
+
+func DeleteShare(fileShareService service.FileShareService) fiber.Handler {
+	zap.L().Debug("routing request to DELETE /api/shares/:id")
+	return func(c *fiber.Ctx) error {
+		shareId := c.Params("id")
+		if len(shareId) == 0 {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(response.UrlErrorResponse(errors.New("path parameter is empty")))
+		}
+		username := identity(c).Username
+
+		result, err := fileShareService.RevokeShare(shareId, username)
+		if err != nil {
+			c.Status(errorStatus(err))
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+		c.Status(http.StatusOK)
+		zap.L().Debug("returning context", zap.Any("fiber.context", c))
+		return c.JSON(response.ShareSuccessResponse(result))
+	}
+}
+
+// returns the page size of a listing from the limit query
+func getPageSize(c *fiber.Ctx) (int, error) {
+	limit := c.Query("limit")
+	if len(limit) == 0 {
+		return DEFAULT_PAGE_SIZE, nil
+	}
+	pageSize, err := strconv.Atoi(limit)
+	if err != nil || pageSize <= 0 || pageSize > MAX_PAGE_SIZE {
+		return 0, fmt.Errorf("limit must be between 1 and %d", MAX_PAGE_SIZE)
+	}
+	return pageSize, nil
+}
+
+// returns the Content-Disposition header of an attachment with given filename, non-ascii filenames are
+// encoded as defined by RFC 6266
+func contentDisposition(filename string) string {
+	if value := mime.FormatMediaType("attachment", map[string]string{"filename": filename}); value != "" {
+		return value
+	}
+	return "attachment"
+}
+
+// returns the http status of given error of the service
+func errorStatus(err error) int {
+	if errors.Is(err, service.ErrInvalidInput) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, service.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, service.ErrWrongPassphrase) {
+		return http.StatusUnauthorized
+	}
+	if errors.Is(err, service.ErrLocked) {
+		return http.StatusLocked
+	}
+	if errors.Is(err, service.ErrConsumed) || errors.Is(err, service.ErrExpired) || errors.Is(err, service.ErrRevoked) {
+		return http.StatusGone
+	}
+	if errors.Is(err, service.ErrRangeNotSatisfiable) {
+		return http.StatusRequestedRangeNotSatisfiable
+	}
+	if errors.Is(err, service.ErrPreparing) || errors.Is(err, service.ErrNotAvailable) || errors.Is(err, service.ErrQuarantined) ||
+		errors.Is(err, service.ErrNotInProgress) || errors.Is(err, service.ErrInactive) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, ErrForbidden) || errors.Is(err, service.ErrQuotaExceeded) {
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
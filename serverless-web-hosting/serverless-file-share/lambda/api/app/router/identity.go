@@ -0,0 +1,46 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/unitypark/serverless-file-share/lambda/api/app/response"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	"go.uber.org/zap"
+)
+
+// key of the fiber locals, which holds the identity of the caller
+const IDENTITY_LOCAL string = "identity"
+
+// Authorizer reads the identity of the caller into the fiber locals. The identity is taken from the context of the
+// authorizer by the lambda handler, which attaches it to the request. Requests without identity are rejected.
+func Authorizer() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		identity, err := entities.DecodeIdentity(c.Get(entities.IDENTITY_HEADER))
+		if err != nil {
+			zap.L().Warn("request is not authorized", zap.Error(err))
+			c.Status(http.StatusUnauthorized)
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+		c.Locals(IDENTITY_LOCAL, identity)
+		return c.Next()
+	}
+}
+
+// LocalAuthorizer attaches given identity to every request, so that the api can be run locally without authorizer.
+func LocalAuthorizer(identity entities.Identity) fiber.Handler {
+	header := identity.Encode()
+	return func(c *fiber.Ctx) error {
+		c.Request().Header.Set(entities.IDENTITY_HEADER, header)
+		return c.Next()
+	}
+}
+
+// returns the identity of the caller, which is set by the authorizer middleware
+func identity(c *fiber.Ctx) *entities.Identity {
+	identity, ok := c.Locals(IDENTITY_LOCAL).(*entities.Identity)
+	if !ok {
+		return new(entities.Identity)
+	}
+	return identity
+}
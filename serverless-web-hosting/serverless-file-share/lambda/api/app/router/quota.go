@@ -0,0 +1,69 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/unitypark/serverless-file-share/lambda/api/app/response"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/service"
+	"go.uber.org/zap"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func GetQuota(fileShareService service.FileShareService) fiber.Handler {
+	zap.L().Debug("routing request to GET /api/quotas/:username")
+	return func(c *fiber.Ctx) error {
+		if !identity(c).IsAdmin {
+			c.Status(errorStatus(ErrForbidden))
+			return c.JSON(response.UrlErrorResponse(fmt.Errorf("%w: quotas are only visible to admins", ErrForbidden)))
+		}
+		username, err := url.PathUnescape(c.Params("username"))
+		if err != nil || len(username) == 0 {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(response.UrlErrorResponse(errors.New("path parameter is empty")))
+		}
+
+		result, err := fileShareService.GetQuota(username)
+		if err != nil {
+			c.Status(errorStatus(err))
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+		c.Status(http.StatusOK)
+		zap.L().Debug("returning context", zap.Any("fiber.context", c))
+		return c.JSON(response.UsageSuccessResponse(result))
+	}
+}
+
+func PutQuota(fileShareService service.FileShareService) fiber.Handler {
+	zap.L().Debug("routing request to PUT /api/quotas/:username")
+	return func(c *fiber.Ctx) error {
+		if !identity(c).IsAdmin {
+			c.Status(errorStatus(ErrForbidden))
+			return c.JSON(response.UrlErrorResponse(fmt.Errorf("%w: quotas are only set by admins", ErrForbidden)))
+		}
+		username, err := url.PathUnescape(c.Params("username"))
+		if err != nil || len(username) == 0 {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(response.UrlErrorResponse(errors.New("path parameter is empty")))
+		}
+		var requestBody entities.PutQuotaRequest
+		err = c.BodyParser(&requestBody)
+		if err != nil {
+			c.Status(http.StatusBadRequest)
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+
+		result, err := fileShareService.SetQuota(username, requestBody.Quota)
+		if err != nil {
+			c.Status(errorStatus(err))
+			return c.JSON(response.UrlErrorResponse(err))
+		}
+		c.Status(http.StatusOK)
+		zap.L().Debug("returning context", zap.Any("fiber.context", c))
+		return c.JSON(response.UsageSuccessResponse(result))
+	}
+}
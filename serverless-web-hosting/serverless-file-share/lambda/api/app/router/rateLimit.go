@@ -0,0 +1,105 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/awslabs/aws-lambda-go-api-proxy/core"
+	"github.com/gofiber/fiber/v2"
+	"github.com/unitypark/serverless-file-share/lambda/api/app/response"
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/ratelimit"
+	"go.uber.org/zap"
+)
+
+// header, which the distribution sets to the address and port of the viewer, e.g. 198.51.100.10:46532. The source
+// ip of the request context is the address of the edge location for requests over the distribution.
+const CLOUDFRONT_VIEWER_ADDRESS_HEADER string = "CloudFront-Viewer-Address"
+
+// source ip in the request context of the http api (payload 2.0) and of the rest api (payload 1.0), which is
+// attached to the request by the adapter
+type gatewayContext struct {
+	HTTP struct {
+		SourceIP string `json:"sourceIp"`
+	} `json:"http"`
+	Identity struct {
+		SourceIP string `json:"sourceIp"`
+	} `json:"identity"`
+}
+
+type rateLimitBucket struct {
+	key   string
+	limit appConfig.RateLimit
+}
+
+// RateLimiter throttles the requests, which resolve the access key of the route, per source ip and per access
+// key. Throttled requests are answered with 429 and the seconds until they may be sent again. Requests pass,
+// if the limiter fails, so that downloads do not depend on the limiter.
+func RateLimiter(limiter ratelimit.Limiter, policy appConfig.RateLimitPolicy) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		buckets := []rateLimitBucket{}
+		// requests of unknown source ips would share one bucket, they are only throttled per access key
+		if ip := sourceIp(c); ip != "" {
+			buckets = append(buckets, rateLimitBucket{ratelimit.SourceIpBucket(ip), policy.SourceIp})
+		}
+		buckets = append(buckets, rateLimitBucket{ratelimit.AccessKeyBucket(c.Params("key")), policy.AccessKey})
+		for _, bucket := range buckets {
+			retryAfter, err := limiter.Take(bucket.key, bucket.limit)
+			if err != nil {
+				zap.L().Warn("rate limit is not checked", zap.String("bucket", bucket.key), zap.Error(err))
+				continue
+			}
+			if retryAfter > 0 {
+				zap.L().Info("request is throttled", zap.String("bucket", bucket.key), zap.Duration("retryAfter", retryAfter))
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				c.Set(fiber.HeaderRetryAfter, strconv.Itoa(seconds))
+				c.Status(http.StatusTooManyRequests)
+				return c.JSON(response.UrlErrorResponse(fmt.Errorf("%w: retry after %s", ratelimit.ErrTooManyRequests, time.Duration(seconds)*time.Second)))
+			}
+		}
+		return c.Next()
+	}
+}
+
+// returns the address of the viewer of the distribution, or the source ip of the request context of the api
+// gateway or the load balancer, or the remote address of the request, if it is not sent through the adapter. The
+// context cannot be sent by clients, because the handler removes it from their headers. It returns an empty ip,
+// if the context has none, because the remote address is the same for all requests of the adapter.
+func sourceIp(c *fiber.Ctx) string {
+	header := c.Get(core.APIGwContextHeader)
+	if header == "" {
+		return c.IP()
+	}
+	if ip := viewerIp(c.Get(CLOUDFRONT_VIEWER_ADDRESS_HEADER)); ip != "" {
+		return ip
+	}
+	context := gatewayContext{}
+	if err := json.Unmarshal([]byte(header), &context); err != nil {
+		return ""
+	}
+	if context.HTTP.SourceIP != "" {
+		return context.HTTP.SourceIP
+	}
+	return context.Identity.SourceIP
+}
+
+// returns the ip of the viewer address of the distribution, whose port follows the last colon. Ipv6 addresses
+// may be enclosed in brackets. It returns an empty ip, if the address is malformed.
+func viewerIp(address string) string {
+	separator := strings.LastIndex(address, ":")
+	if separator < 0 {
+		return ""
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(address[:separator], "["), "]")
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
@@ -0,0 +1,92 @@
+package router
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/awslabs/aws-lambda-go-api-proxy/core"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestViewerIp(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{address: "198.51.100.10:46532", want: "198.51.100.10"},
+		{address: "2001:db8::1:46532", want: "2001:db8::1"},
+		{address: "[2001:db8::1]:46532", want: "2001:db8::1"},
+		{address: "2001:DB8:0:0:0:0:0:1:46532", want: "2001:db8::1"},
+		{address: "198.51.100.10", want: ""},
+		{address: "example.com:443", want: ""},
+		{address: "", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			if got := viewerIp(tt.address); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceIp(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{
+			name: "viewer of the distribution",
+			headers: map[string]string{
+				core.APIGwContextHeader:          `{"http":{"sourceIp":"130.176.1.1"}}`,
+				CLOUDFRONT_VIEWER_ADDRESS_HEADER: "198.51.100.10:46532",
+			},
+			want: "198.51.100.10",
+		},
+		{
+			name:    "http api",
+			headers: map[string]string{core.APIGwContextHeader: `{"http":{"sourceIp":"198.51.100.11"}}`},
+			want:    "198.51.100.11",
+		},
+		{
+			name: "load balancer with malformed viewer address",
+			headers: map[string]string{
+				core.APIGwContextHeader:          `{"identity":{"sourceIp":"198.51.100.12"}}`,
+				CLOUDFRONT_VIEWER_ADDRESS_HEADER: "unknown",
+			},
+			want: "198.51.100.12",
+		},
+		{
+			name:    "context without source ip",
+			headers: map[string]string{core.APIGwContextHeader: `{}`},
+			want:    "",
+		},
+		{
+			name:    "without adapter",
+			headers: map[string]string{},
+			want:    "0.0.0.0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				return c.SendString(sourceIp(c))
+			})
+			req := httptest.NewRequest("GET", "/", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			body, _ := io.ReadAll(res.Body)
+			if got := string(body); got != tt.want {
+				t.Errorf("got source ip %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
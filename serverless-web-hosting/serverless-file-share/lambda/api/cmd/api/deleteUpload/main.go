@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/aws/aws-lambda-go/lambda"
+	fiberadapter "github.com/awslabs/aws-lambda-go-api-proxy/fiber"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/unitypark/serverless-file-share/lambda/api/app/handler"
+	"github.com/unitypark/serverless-file-share/lambda/api/app/router"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/blobstore"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/client"
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	zapLogger "github.com/unitypark/serverless-file-share/lambda/api/internal/logger"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/repository"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/service"
+	"go.uber.org/zap"
+)
+
+const serviceName string = "DeleteUpload"
+
+var (
+	config        *appConfig.Config
+	fiberApp      *fiber.App
+	fiberLambda   *fiberadapter.FiberLambda
+	lambdaHandler handler.FiberLambdaHandler
+)
+
+func init() {
+	config = appConfig.New()
+	zapLogger.Init(config.Env)
+
+	fiberApp = fiber.New(fiber.Config{BodyLimit: router.BODY_LIMIT_IN_BYTES})
+	fiberApp.Use(cors.New())
+	fiberApp.Use(logger.New())
+	if config.Env == appConfig.Local {
+		fiberApp.Use(router.LocalAuthorizer(entities.Identity{
+			Username: config.LocalUsername,
+			IsAdmin:  config.LocalIsAdmin,
+		}))
+	}
+	fiberApp.Use("/api", router.Authorizer())
+
+	fiberLambda = fiberadapter.New(fiberApp)
+	lambdaHandler = handler.NewApiHandler(serviceName, fiberLambda, config)
+	zap.L().Info("lambda cold start")
+}
+
+func main() {
+	var (
+		dynamodbClient, _ = client.Connect(config)
+		repo              = repository.NewRepository(dynamodbClient, config.RetentionPolicy)
+		blobStore         = blobstore.New(config)
+		fileShareService  = service.NewFileShareService(config, repo, blobStore)
+	)
+	fiberApp.Delete("/api/uploads/:id", router.DeleteUpload(fileShareService))
+
+	if config.Env == appConfig.Local {
+		router.LocalBlobRouter(fiberApp, blobStore)
+		zap.L().Debug("start local server on port 8080", zap.Error(fiberApp.Listen(":8080")))
+	} else {
+		zap.L().Debug("start lambda for production")
+		// Make the handler available for Remote Procedure Call by AWS Lambda
+		lambda.Start(lambdaHandler.Handle)
+	}
+}
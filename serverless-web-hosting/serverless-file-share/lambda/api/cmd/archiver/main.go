@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/blobstore"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/client"
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	zapLogger "github.com/unitypark/serverless-file-share/lambda/api/internal/logger"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/repository"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/service"
+	appTypes "github.com/unitypark/serverless-file-share/lambda/api/types"
+	"go.uber.org/zap"
+)
+
+var (
+	config         *appConfig.Config
+	archiveService service.ArchiveService
+)
+
+func init() {
+	config = appConfig.New()
+	zapLogger.Init(config.Env)
+	zap.L().Info("lambda cold start")
+}
+
+// Prepares the zip archives of shared folders. It is triggered by the table stream, whenever a share of a folder
+// is created, or run locally with the share id as argument.
+func main() {
+	dynamodbClient, err := client.Connect(config)
+	if err != nil {
+		zap.L().Fatal("failed to connect to dynamodb", zap.Error(err))
+	}
+	archiveService = service.NewArchiveService(config, repository.NewRepository(dynamodbClient, config.RetentionPolicy), blobstore.New(config))
+
+	if config.Env == appConfig.Local {
+		if len(os.Args) < 2 {
+			zap.L().Fatal("share id is missing")
+		}
+		err = archiveService.PrepareArchive(os.Args[1])
+		zap.L().Info("archiver terminates", zap.Error(err))
+	} else {
+		lambda.Start(handler)
+	}
+}
+
+func handler(ctx context.Context, event events.DynamoDBEvent) error {
+	for _, record := range event.Records {
+		pk := record.Change.Keys[appTypes.PK].String()
+		if record.EventName != string(events.DynamoDBOperationTypeInsert) || !strings.HasPrefix(pk, appTypes.KEY_PREFIX) {
+			continue
+		}
+		err := archiveService.PrepareArchive(strings.TrimPrefix(pk, appTypes.KEY_PREFIX))
+		if err != nil {
+			zap.L().Error("archiver terminates with error", zap.Error(err))
+			return err
+		}
+	}
+	return nil
+}
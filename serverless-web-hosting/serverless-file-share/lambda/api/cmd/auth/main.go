@@ -12,14 +12,15 @@ import (
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	jwt "github.com/golang-jwt/jwt/v4"
-	"github.com/lestrrat/go-jwx/jwk"
 	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/jwks"
 	zapLogger "github.com/unitypark/serverless-file-share/lambda/api/internal/logger"
 	"go.uber.org/zap"
 )
 
 var (
 	config                 *appConfig.Config
+	jwksCache              *jwks.Cache
 	accessTokenCookieRegex = regexp.MustCompile(`accessToken=(.+?)(;)`)
 	idTokenCookieRegex     = regexp.MustCompile(`idToken=(.+?)(;)`)
 )
@@ -27,6 +28,8 @@ var (
 func init() {
 	config = appConfig.New()
 	zapLogger.Init(config.Env)
+	// keys of the user pool are cached for the lifetime of the lambda instead of being fetched for every token
+	jwksCache = jwks.New(config.JwksUrl, jwks.DEFAULT_TTL, jwks.DEFAULT_REFRESH_INTERVAL)
 	zap.L().Info("lambda cold start")
 }
 
@@ -48,9 +51,15 @@ func handler(ctx context.Context, req events.APIGatewayV2CustomAuthorizerV2Reque
 	err = validateToken(*accessToken)
 	if err != nil {
 		zap.L().Error("authorizatoin failed", zap.Error(err))
-		return generateResponse(false, idToken), nil
+		return generateResponse(false, nil), nil
 	}
-	return generateResponse(true, idToken), nil
+	// the id token is parsed once, its claims give the identity of the user
+	parsedIdToken, err := parseToken(*idToken)
+	if err != nil {
+		zap.L().Error("authorizatoin failed, invalid id token", zap.Error(err))
+		return generateResponse(false, nil), nil
+	}
+	return generateResponse(true, parsedIdToken.Claims.(jwt.MapClaims)), nil
 }
 
 func getToken(regex *regexp.Regexp, authHeader string) (*string, error) {
@@ -64,22 +73,7 @@ func getToken(regex *regexp.Regexp, authHeader string) (*string, error) {
 }
 
 func parseToken(token string) (*jwt.Token, error) {
-	return jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		set, err := jwk.FetchHTTP(config.JwksUrl)
-		if err != nil {
-			return nil, err
-		}
-
-		keyID, ok := token.Header["kid"].(string)
-		if !ok {
-			return nil, errors.New("expecting JWT header to have string kid")
-		}
-
-		if key := set.LookupKeyID(keyID); len(key) == 1 {
-			return key[0].Materialize()
-		}
-		return nil, errors.New("unable to find key")
-	})
+	return jwt.Parse(token, jwksCache.Keyfunc, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}))
 }
 
 func findAuthHeader(headers map[string]string, authHeaderNames []string) string {
@@ -94,14 +88,14 @@ func findAuthHeader(headers map[string]string, authHeaderNames []string) string
 }
 
 // Help function to generate an IAM policy
-func generateResponse(isAuthorized bool, idToken *string) events.APIGatewayV2CustomAuthorizerSimpleResponse {
+func generateResponse(isAuthorized bool, idClaims jwt.MapClaims) events.APIGatewayV2CustomAuthorizerSimpleResponse {
 	if isAuthorized {
-		parsedIdToken, _ := parseToken(*idToken)
+		customIsAdmin, _ := idClaims["custom:isAdmin"].(string)
 		return events.APIGatewayV2CustomAuthorizerSimpleResponse{
 			IsAuthorized: isAuthorized,
 			Context: map[string]interface{}{
-				"username": parsedIdToken.Claims.(jwt.MapClaims)["email"],
-				"isAdmin":  isAdmin(parsedIdToken.Claims.(jwt.MapClaims)["custom:isAdmin"].(string)),
+				"username": idClaims["email"],
+				"isAdmin":  isAdmin(customIsAdmin),
 			},
 		}
 	} else {
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/client"
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	zapLogger "github.com/unitypark/serverless-file-share/lambda/api/internal/logger"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/repository"
+	"go.uber.org/zap"
+)
+
+var (
+	config *appConfig.Config
+)
+
+type MigrationResult struct {
+	MigratedShares int `json:"migratedShares"`
+}
+
+func init() {
+	config = appConfig.New()
+	zapLogger.Init(config.Env)
+	zap.L().Info("lambda cold start")
+}
+
+// Migrates assets, which were stored with the path as partition key, into items keyed by the access key.
+// It is invoked once manually after deployment, or run locally against the table.
+func main() {
+	if config.Env == appConfig.Local {
+		res, err := handler(context.Background())
+		zap.L().Info("migration terminates", zap.Any("result", res), zap.Error(err))
+	} else {
+		lambda.Start(handler)
+	}
+}
+
+func handler(ctx context.Context) (MigrationResult, error) {
+	dynamodbClient, err := client.Connect(config)
+	if err != nil {
+		return MigrationResult{}, err
+	}
+	repo := repository.NewMigrationRepository(dynamodbClient, config.RetentionPolicy)
+	migrated, err := repo.MigrateLegacyAssets()
+	if err != nil {
+		zap.L().Error("migration terminates with error", zap.Error(err))
+	}
+	return MigrationResult{MigratedShares: migrated}, err
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/client"
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	zapLogger "github.com/unitypark/serverless-file-share/lambda/api/internal/logger"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/notifier"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/repository"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/service"
+	appTypes "github.com/unitypark/serverless-file-share/lambda/api/types"
+	"go.uber.org/zap"
+)
+
+// downloads, whose owners could not be notified within this time, are not notified anymore
+const MAX_NOTIFICATION_AGE time.Duration = 24 * time.Hour
+
+var (
+	config              *appConfig.Config
+	notificationService service.NotificationService
+)
+
+func init() {
+	config = appConfig.New()
+	zapLogger.Init(config.Env)
+	zap.L().Info("lambda cold start")
+}
+
+// Notifies the owners of shares about their downloads. It is triggered by the table stream, whenever a share
+// is downloaded, and the stream retries failed deliveries. Locally, it notifies about a download of the share
+// with the share id as argument.
+func main() {
+	dynamodbClient, err := client.Connect(config)
+	if err != nil {
+		zap.L().Fatal("failed to connect to dynamodb", zap.Error(err))
+	}
+	notificationService = service.NewNotificationService(repository.NewRepository(dynamodbClient, config.RetentionPolicy), notifier.New(config))
+
+	if config.Env == appConfig.Local {
+		if len(os.Args) < 2 {
+			zap.L().Fatal("share id is missing")
+		}
+		share := new(entities.Asset)
+		share.PK = appTypes.KEY_PREFIX + os.Args[1]
+		access := new(entities.Asset)
+		access.InitNewAccessAsset(share, "local", entities.GetCurrentUTCTime())
+		err = notificationService.NotifyAccess(access)
+		zap.L().Info("notifier terminates", zap.Error(err))
+	} else {
+		lambda.Start(handler)
+	}
+}
+
+func handler(ctx context.Context, event events.DynamoDBEvent) error {
+	for _, record := range event.Records {
+		image := record.Change.NewImage
+		if record.EventName != string(events.DynamoDBOperationTypeInsert) || image[appTypes.ATTRIBUTE_TYPE].String() != appTypes.TYPE_ACCESS {
+			continue
+		}
+		access := new(entities.Asset)
+		access.PK = image[appTypes.PK].String()
+		access.SK = image[appTypes.SK].String()
+		access.AccessedBy = image[appTypes.ATTRIBUTE_ACCESSED_BY].String()
+		access.AccessedAt = image[appTypes.ATTRIBUTE_ACCESSED_AT].String()
+		// notifications of old downloads are not useful anymore, e.g. after the notifier was down for a long time
+		accessedAt, err := time.Parse(appTypes.TIME_FORMAT, access.AccessedAt)
+		if err == nil && time.Since(accessedAt) > MAX_NOTIFICATION_AGE {
+			zap.L().Warn("dropping notification of old download", zap.String("accessId", access.AccessId()))
+			continue
+		}
+		err = notificationService.NotifyAccess(access)
+		if err != nil {
+			zap.L().Error("notifier terminates with error", zap.Error(err))
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/blobstore"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/client"
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	zapLogger "github.com/unitypark/serverless-file-share/lambda/api/internal/logger"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/repository"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/service"
+	appTypes "github.com/unitypark/serverless-file-share/lambda/api/types"
+	"go.uber.org/zap"
+)
+
+// prefix of the names of s3 events, which are sent when objects are deleted
+const OBJECT_REMOVED_EVENT string = "ObjectRemoved:"
+
+var (
+	config            *appConfig.Config
+	processingService service.ProcessingService
+)
+
+func init() {
+	config = appConfig.New()
+	zapLogger.Init(config.Env)
+	zap.L().Info("lambda cold start")
+}
+
+// Processes every object uploaded into or deleted from the file share bucket. It is triggered by s3 events,
+// or run locally with the path of the object as argument.
+func main() {
+	dynamodbClient, err := client.Connect(config)
+	if err != nil {
+		zap.L().Fatal("failed to connect to dynamodb", zap.Error(err))
+	}
+	processingService, err = service.NewProcessingService(config, repository.NewRepository(dynamodbClient, config.RetentionPolicy), blobstore.New(config))
+	if err != nil {
+		zap.L().Fatal("failed to create processing service", zap.Error(err))
+	}
+
+	if config.Env == appConfig.Local {
+		if len(os.Args) < 2 {
+			zap.L().Fatal("path is missing")
+		}
+		_, err = processingService.ProcessObject(os.Args[1], "")
+		zap.L().Info("processor terminates", zap.Error(err))
+	} else {
+		lambda.Start(handler)
+	}
+}
+
+func handler(ctx context.Context, event events.S3Event) error {
+	for _, record := range event.Records {
+		path := record.S3.Object.URLDecodedKey
+		// archives of shared folders and previews of files are generated by the file share and are not shared
+		// on their own
+		if strings.HasPrefix(path, appTypes.ARCHIVE_PREFIX) || strings.HasPrefix(path, appTypes.PREVIEW_PREFIX) || strings.HasSuffix(path, "/") {
+			continue
+		}
+		if strings.HasPrefix(record.EventName, OBJECT_REMOVED_EVENT) {
+			err := processingService.RemoveObject(path)
+			if err != nil {
+				zap.L().Error("processor terminates with error", zap.Error(err))
+				return err
+			}
+			continue
+		}
+		_, err := processingService.ProcessObject(path, record.S3.Object.VersionID)
+		if err != nil {
+			zap.L().Error("processor terminates with error", zap.Error(err))
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/blobstore"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/client"
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	zapLogger "github.com/unitypark/serverless-file-share/lambda/api/internal/logger"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/repository"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/service"
+	"go.uber.org/zap"
+)
+
+var (
+	config         *appConfig.Config
+	sweeperService service.SweeperService
+)
+
+func init() {
+	config = appConfig.New()
+	zapLogger.Init(config.Env)
+	zap.L().Info("lambda cold start")
+}
+
+// Cleans up expired uploads and unused files according to the retention policy. It is triggered by a schedule,
+// or run locally once. With SWEEPER_DRY_RUN=true, it only logs what it would clean up.
+func main() {
+	dynamodbClient, err := client.Connect(config)
+	if err != nil {
+		zap.L().Fatal("failed to connect to dynamodb", zap.Error(err))
+	}
+	sweeperService = service.NewSweeperService(config, repository.NewRepository(dynamodbClient, config.RetentionPolicy), blobstore.New(config))
+
+	if config.Env == appConfig.Local {
+		result, err := sweeperService.Sweep(config.SweeperDryRun)
+		zap.L().Info("sweeper terminates", zap.Any("result", result), zap.Error(err))
+	} else {
+		lambda.Start(handler)
+	}
+}
+
+func handler(ctx context.Context, event events.CloudWatchEvent) (*service.SweepResult, error) {
+	return sweeperService.Sweep(config.SweeperDryRun)
+}
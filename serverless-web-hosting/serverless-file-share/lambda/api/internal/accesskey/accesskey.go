@@ -0,0 +1,55 @@
+package accesskey
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// access keys are drawn from crypto/rand and encoded url-safe without padding
+const KEY_LENGTH_IN_BYTES int = 24
+
+// legacy access keys are the decimal FNV-64 hash of a ulid
+const MAX_LEGACY_KEY_LENGTH int = 20
+
+// Hasher derives the share id, which is stored at rest instead of the access key itself.
+// Without the secret, the access key of a share cannot be recovered from the table.
+type Hasher struct {
+	secret []byte
+}
+
+func NewHasher(secret string) *Hasher {
+	return &Hasher{secret: []byte(secret)}
+}
+
+// New returns a random access key with 192 bits of entropy
+func New() (string, error) {
+	b := make([]byte, KEY_LENGTH_IN_BYTES)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ShareId returns the HMAC-SHA256 of given access key
+func (h *Hasher) ShareId(accessKey string) string {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(accessKey))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// IsLegacy returns true, if given access key has the format of the keys issued before,
+// which were stored as they are
+func IsLegacy(accessKey string) bool {
+	if len(accessKey) == 0 || len(accessKey) > MAX_LEGACY_KEY_LENGTH {
+		return false
+	}
+	for _, c := range accessKey {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,85 @@
+package blobstore
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNotFound is returned, if the requested object or upload does not exist
+	ErrNotFound = errors.New("object not found")
+	// ErrPolicyViolation is returned, if a posted file does not match the policy of its presigned post
+	ErrPolicyViolation = errors.New("policy violation")
+)
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string
+	ContentType  string
+	LastModified time.Time
+	// version of the object in the versioned bucket, IsLatest is only set by ListVersions
+	VersionId string
+	IsLatest  bool
+}
+
+// Part is an uploaded part of a multipart upload
+type Part struct {
+	PartNumber int32
+	ETag       string
+	Size       int64
+}
+
+// BlobStore stores the shared files. Clients up- and download the files directly over presigned urls.
+type BlobStore interface {
+	PresignGet(key string, expires time.Duration) (string, error)
+	// PresignGetVersion presigns the download of given version, the latest version is downloaded if it is empty
+	PresignGetVersion(key, versionId string, expires time.Duration) (string, error)
+	PresignPut(key string, expires time.Duration) (string, error)
+	PresignPost(policy PostPolicy) (*PresignedPost, error)
+	Head(key string) (*ObjectInfo, error)
+	HeadVersion(key, versionId string) (*ObjectInfo, error)
+	// PutObject writes objects, which are generated by the file share itself
+	PutObject(key, contentType string, body io.ReadSeeker) error
+	Delete(key string) error
+	// DeleteVersion deletes given version for good, other versions of the object are kept
+	DeleteVersion(key, versionId string) error
+	Get(key string) (io.ReadCloser, error)
+	GetVersion(key, versionId string) (io.ReadCloser, error)
+	// GetRange returns given range of the version, the whole version is returned if the range is nil
+	GetRange(key, versionId string, byteRange *ByteRange) (io.ReadCloser, error)
+	// List calls fn for every object under given prefix
+	List(prefix string, fn func(object ObjectInfo) error) error
+	// ListVersions returns the versions of the object at given key, newest first. Deleted versions are not listed.
+	ListVersions(key string) ([]ObjectInfo, error)
+
+	CreateMultipartUpload(key, contentType string) (string, error)
+	PresignUploadPart(key, uploadId string, partNumber int32, expires time.Duration) (string, error)
+	UploadPart(key, uploadId string, partNumber int32, body io.ReadSeeker) (string, error)
+	ListParts(key, uploadId string) ([]Part, error)
+	CompleteMultipartUpload(key, uploadId string, parts []Part) error
+	AbortMultipartUpload(key, uploadId string) error
+}
+
+var store BlobStore
+
+// New returns the s3 bucket of the file share in production, and a directory on the local disk otherwise
+func New(config *appConfig.Config) BlobStore {
+	if store != nil {
+		return store
+	}
+	switch config.Env {
+	case appConfig.Local:
+		zap.L().Info("creating local blob store", zap.String("root", config.LocalBlobRoot))
+		store = NewLocalStore(config.LocalBlobRoot, config.LocalBlobBaseUrl, config.LocalBlobSecret)
+	default:
+		zap.L().Info("creating s3 blob store", zap.String("bucket", config.FileshareBucketName))
+		store = NewS3Store(config.FileshareBucketName)
+	}
+	return store
+}
@@ -0,0 +1,519 @@
+package blobstore
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// route of the fiber app, which serves the presigned urls of the local store
+const LOCAL_ROUTE string = "/blobs/"
+
+// query parameters of the presigned urls of the local store
+const (
+	QUERY_EXPIRES     string = "X-Expires"
+	QUERY_SIGNATURE   string = "X-Signature"
+	QUERY_UPLOAD_ID   string = "uploadId"
+	QUERY_PART_NUMBER string = "partNumber"
+	QUERY_VERSION_ID  string = "versionId"
+)
+
+// form field of the signature of a presigned post of the local store
+const FIELD_SIGNATURE string = "x-signature"
+
+// parts of multipart uploads are kept in this directory of the root until the upload is completed
+const MULTIPART_DIR string = ".multipart"
+
+var (
+	// ErrInvalidSignature is returned, if a url of the local store is not signed by it or is expired
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrInvalidKey is returned, if a key would leave the root of the local store
+	ErrInvalidKey = errors.New("invalid key")
+)
+
+// LocalStore keeps the objects as files under its root directory. Its presigned urls are signed with HMAC
+// and served by the fiber app, so that the file share runs without aws. It keeps only the latest version of
+// an object, whose version id is the md5 of its content.
+type LocalStore struct {
+	root    string
+	baseUrl string
+	secret  []byte
+}
+
+func NewLocalStore(root, baseUrl, secret string) *LocalStore {
+	return &LocalStore{
+		root:    root,
+		baseUrl: strings.TrimSuffix(baseUrl, "/"),
+		secret:  []byte(secret),
+	}
+}
+
+func (s *LocalStore) PresignGet(key string, expires time.Duration) (string, error) {
+	return s.PresignGetVersion(key, "", expires)
+}
+
+func (s *LocalStore) PresignGetVersion(key, versionId string, expires time.Duration) (string, error) {
+	return s.presign("GET", key, versionId, "", 0, expires)
+}
+
+func (s *LocalStore) PresignPut(key string, expires time.Duration) (string, error) {
+	return s.presign("PUT", key, "", "", 0, expires)
+}
+
+func (s *LocalStore) PresignPost(policy PostPolicy) (*PresignedPost, error) {
+	_, err := s.objectPath(policy.Key)
+	if err != nil {
+		return nil, err
+	}
+	form, encoded, err := policy.encode(time.Now(), nil)
+	if err != nil {
+		return nil, err
+	}
+	form[FIELD_SIGNATURE] = base64.RawURLEncoding.EncodeToString(s.signPolicy(encoded))
+	return &PresignedPost{
+		Url:    s.baseUrl + LOCAL_ROUTE,
+		Fields: form,
+	}, nil
+}
+
+func (s *LocalStore) Head(key string) (*ObjectInfo, error) {
+	name, err := s.objectPath(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("cannot find object %s: %w", key, ErrNotFound)
+		}
+		return nil, err
+	}
+	etag, err := fileETag(name)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:          key,
+		Size:         info.Size(),
+		ETag:         etag,
+		ContentType:  mime.TypeByExtension(path.Ext(key)),
+		LastModified: info.ModTime().UTC(),
+		VersionId:    strings.Trim(etag, `"`),
+	}, nil
+}
+
+// HeadVersion returns ErrNotFound, if the object has changed since given version
+func (s *LocalStore) HeadVersion(key, versionId string) (*ObjectInfo, error) {
+	object, err := s.Head(key)
+	if err != nil {
+		return nil, err
+	}
+	if versionId != "" && object.VersionId != versionId {
+		return nil, fmt.Errorf("cannot find version %s of object %s: %w", versionId, key, ErrNotFound)
+	}
+	return object, nil
+}
+
+func (s *LocalStore) Delete(key string) error {
+	name, err := s.objectPath(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// DeleteVersion deletes the object, if it was not changed since given version
+func (s *LocalStore) DeleteVersion(key, versionId string) error {
+	object, err := s.Head(key)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if object.VersionId != versionId {
+		return nil
+	}
+	return s.Delete(key)
+}
+
+func (s *LocalStore) Get(key string) (io.ReadCloser, error) {
+	return s.GetVersion(key, "")
+}
+
+// GetVersion returns ErrNotFound, if the object has changed since given version
+func (s *LocalStore) GetVersion(key, versionId string) (io.ReadCloser, error) {
+	return s.GetRange(key, versionId, nil)
+}
+
+func (s *LocalStore) GetRange(key, versionId string, byteRange *ByteRange) (io.ReadCloser, error) {
+	if versionId != "" {
+		_, err := s.HeadVersion(key, versionId)
+		if err != nil {
+			return nil, err
+		}
+	}
+	name, err := s.objectPath(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("cannot find object %s: %w", key, ErrNotFound)
+		}
+		return nil, err
+	}
+	if byteRange == nil {
+		return f, nil
+	}
+	_, err = f.Seek(byteRange.Offset, io.SeekStart)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &rangeReader{Reader: io.LimitReader(f, byteRange.Length), Closer: f}, nil
+}
+
+// rangeReader reads a range of a file and closes the file
+type rangeReader struct {
+	io.Reader
+	io.Closer
+}
+
+// Put writes the object with given key, it is called by the fiber app for presigned put urls
+func (s *LocalStore) Put(key string, body io.Reader) (string, error) {
+	name, err := s.objectPath(key)
+	if err != nil {
+		return "", err
+	}
+	return writeFile(name, body)
+}
+
+// PutObject writes the object with given key, whose content type is given by the extension of the key
+func (s *LocalStore) PutObject(key, contentType string, body io.ReadSeeker) error {
+	_, err := s.Put(key, body)
+	return err
+}
+
+func (s *LocalStore) List(prefix string, fn func(object ObjectInfo) error) error {
+	keys := []string{}
+	err := filepath.WalkDir(s.root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name == s.uploadDir("") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, name)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	// objects are listed in the order of their keys like in s3
+	sort.Strings(keys)
+	for _, key := range keys {
+		info, err := s.Head(key)
+		if err != nil {
+			return err
+		}
+		err = fn(*info)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *LocalStore) ListVersions(key string) ([]ObjectInfo, error) {
+	object, err := s.Head(key)
+	if errors.Is(err, ErrNotFound) {
+		return []ObjectInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	object.IsLatest = true
+	return []ObjectInfo{*object}, nil
+}
+
+func (s *LocalStore) CreateMultipartUpload(key, contentType string) (string, error) {
+	_, err := s.objectPath(key)
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, 16)
+	_, err = rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	uploadId := hex.EncodeToString(b)
+	dir := s.uploadDir(uploadId)
+	err = os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return "", err
+	}
+	// the key of the upload is kept, so that the parts cannot be completed into another key
+	err = os.WriteFile(filepath.Join(dir, "key"), []byte(key), 0o644)
+	if err != nil {
+		return "", err
+	}
+	return uploadId, nil
+}
+
+func (s *LocalStore) PresignUploadPart(key, uploadId string, partNumber int32, expires time.Duration) (string, error) {
+	return s.presign("PUT", key, "", uploadId, partNumber, expires)
+}
+
+func (s *LocalStore) UploadPart(key, uploadId string, partNumber int32, body io.ReadSeeker) (string, error) {
+	return s.PutPart(key, uploadId, partNumber, body)
+}
+
+// PutPart writes a part of a multipart upload, it is called by the fiber app for presigned upload part urls
+func (s *LocalStore) PutPart(key, uploadId string, partNumber int32, body io.Reader) (string, error) {
+	err := s.checkUpload(key, uploadId)
+	if err != nil {
+		return "", err
+	}
+	return writeFile(s.partPath(uploadId, partNumber), body)
+}
+
+func (s *LocalStore) ListParts(key, uploadId string) ([]Part, error) {
+	err := s.checkUpload(key, uploadId)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(s.uploadDir(uploadId))
+	if err != nil {
+		return nil, err
+	}
+	parts := []Part{}
+	for _, entry := range entries {
+		partNumber, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), "part-"))
+		if err != nil || !strings.HasPrefix(entry.Name(), "part-") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		etag, err := fileETag(s.partPath(uploadId, int32(partNumber)))
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, Part{PartNumber: int32(partNumber), ETag: etag, Size: info.Size()})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+func (s *LocalStore) CompleteMultipartUpload(key, uploadId string, parts []Part) error {
+	uploaded, err := s.ListParts(key, uploadId)
+	if err != nil {
+		return err
+	}
+	etags := make(map[int32]string, len(uploaded))
+	for _, part := range uploaded {
+		etags[part.PartNumber] = part.ETag
+	}
+	readers := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		if etags[part.PartNumber] != part.ETag {
+			return fmt.Errorf("etag of part %d does not match", part.PartNumber)
+		}
+		f, err := os.Open(s.partPath(uploadId, part.PartNumber))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		readers = append(readers, f)
+	}
+	name, err := s.objectPath(key)
+	if err != nil {
+		return err
+	}
+	_, err = writeFile(name, io.MultiReader(readers...))
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(s.uploadDir(uploadId))
+}
+
+func (s *LocalStore) AbortMultipartUpload(key, uploadId string) error {
+	err := s.checkUpload(key, uploadId)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(s.uploadDir(uploadId))
+}
+
+// Verify checks the signature and the expiry of a presigned url of the local store
+func (s *LocalStore) Verify(method, key string, query url.Values) error {
+	expires, err := strconv.ParseInt(query.Get(QUERY_EXPIRES), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return fmt.Errorf("%w: url is expired", ErrInvalidSignature)
+	}
+	partNumber, _ := strconv.Atoi(query.Get(QUERY_PART_NUMBER))
+	signature, err := base64.RawURLEncoding.DecodeString(query.Get(QUERY_SIGNATURE))
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	expected := s.sign(method, key, query.Get(QUERY_VERSION_ID), query.Get(QUERY_UPLOAD_ID), int32(partNumber), expires)
+	if !hmac.Equal(signature, expected) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// VerifyPost checks the signature of a presigned post of the local store and its policy against the posted form
+func (s *LocalStore) VerifyPost(fields map[string]string, size int64) error {
+	signature, err := base64.RawURLEncoding.DecodeString(fields[FIELD_SIGNATURE])
+	if err != nil || !hmac.Equal(signature, s.signPolicy(fields[FIELD_POLICY])) {
+		return ErrInvalidSignature
+	}
+	return checkPostPolicy(fields[FIELD_POLICY], fields, size, time.Now())
+}
+
+func (s *LocalStore) presign(method, key, versionId, uploadId string, partNumber int32, expires time.Duration) (string, error) {
+	_, err := s.objectPath(key)
+	if err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(expires).Unix()
+	query := url.Values{}
+	query.Set(QUERY_EXPIRES, strconv.FormatInt(expiresAt, 10))
+	if versionId != "" {
+		query.Set(QUERY_VERSION_ID, versionId)
+	}
+	if uploadId != "" {
+		query.Set(QUERY_UPLOAD_ID, uploadId)
+		query.Set(QUERY_PART_NUMBER, strconv.Itoa(int(partNumber)))
+	}
+	query.Set(QUERY_SIGNATURE, base64.RawURLEncoding.EncodeToString(s.sign(method, key, versionId, uploadId, partNumber, expiresAt)))
+	return s.baseUrl + LOCAL_ROUTE + escapeKey(key) + "?" + query.Encode(), nil
+}
+
+func (s *LocalStore) sign(method, key, versionId, uploadId string, partNumber int32, expiresAt int64) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%d\n%d", method, key, versionId, uploadId, partNumber, expiresAt)
+	return mac.Sum(nil)
+}
+
+func (s *LocalStore) signPolicy(policy string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "POST\n%s", policy)
+	return mac.Sum(nil)
+}
+
+// returns the file of given key, keys must stay within the root
+func (s *LocalStore) objectPath(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if key == "" || strings.HasSuffix(key, "/") || cleaned != "/"+key || strings.HasPrefix(key, MULTIPART_DIR+"/") {
+		return "", fmt.Errorf("%w: %s", ErrInvalidKey, key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStore) uploadDir(uploadId string) string {
+	if uploadId == "" {
+		return filepath.Join(s.root, MULTIPART_DIR)
+	}
+	return filepath.Join(s.root, MULTIPART_DIR, filepath.Base(uploadId))
+}
+
+func (s *LocalStore) partPath(uploadId string, partNumber int32) string {
+	return filepath.Join(s.uploadDir(uploadId), fmt.Sprintf("part-%05d", partNumber))
+}
+
+func (s *LocalStore) checkUpload(key, uploadId string) error {
+	uploadKey, err := os.ReadFile(filepath.Join(s.uploadDir(uploadId), "key"))
+	if err != nil || string(uploadKey) != key {
+		return fmt.Errorf("cannot find upload %s: %w", uploadId, ErrNotFound)
+	}
+	return nil
+}
+
+// writes the file atomically and returns its etag
+func writeFile(name string, body io.Reader) (string, error) {
+	err := os.MkdirAll(filepath.Dir(name), 0o755)
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	hash := md5.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), body)
+	if err != nil {
+		tmp.Close()
+		return "", err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return "", err
+	}
+	err = os.Rename(tmp.Name(), name)
+	if err != nil {
+		return "", err
+	}
+	return `"` + hex.EncodeToString(hash.Sum(nil)) + `"`, nil
+}
+
+// returns the md5 of the file as quoted etag like s3 does for single part objects
+func fileETag(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := md5.New()
+	_, err = io.Copy(hash, f)
+	if err != nil {
+		return "", err
+	}
+	return `"` + hex.EncodeToString(hash.Sum(nil)) + `"`, nil
+}
+
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	return strings.Join(segments, "/")
+}
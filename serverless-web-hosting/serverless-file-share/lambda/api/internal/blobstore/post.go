@@ -0,0 +1,128 @@
+package blobstore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// form fields of a presigned post
+const (
+	FIELD_KEY          string = "key"
+	FIELD_CONTENT_TYPE string = "Content-Type"
+	FIELD_POLICY       string = "policy"
+	// the file must be the last field of the form
+	FIELD_FILE string = "file"
+)
+
+// PostPolicy restricts the single upload, which is allowed by a presigned post
+type PostPolicy struct {
+	Key string
+	// content type of the object, the client may only change it within the prefix
+	ContentType       string
+	ContentTypePrefix string
+	MaxContentLength  int64
+	Expires           time.Duration
+}
+
+// PresignedPost is posted by the client as multipart form with the file as last field
+type PresignedPost struct {
+	Url    string            `json:"url"`
+	Fields map[string]string `json:"fields"`
+}
+
+type postPolicyDocument struct {
+	Expiration string        `json:"expiration"`
+	Conditions []interface{} `json:"conditions"`
+}
+
+// returns the form fields of the policy and the base64 encoded policy document, which is signed by the store.
+// Given fields are added to the form and to the conditions, conditions are only added to the policy.
+func (p PostPolicy) encode(now time.Time, fields map[string]string, extraConditions ...interface{}) (map[string]string, string, error) {
+	all := map[string]string{
+		FIELD_KEY:          p.Key,
+		FIELD_CONTENT_TYPE: p.ContentType,
+	}
+	conditions := []interface{}{
+		[]interface{}{"eq", "$" + FIELD_KEY, p.Key},
+		[]interface{}{"starts-with", "$" + FIELD_CONTENT_TYPE, p.ContentTypePrefix},
+		[]interface{}{"content-length-range", 1, p.MaxContentLength},
+	}
+	for name, value := range fields {
+		all[name] = value
+		conditions = append(conditions, map[string]string{name: value})
+	}
+	conditions = append(conditions, extraConditions...)
+	document, err := json.Marshal(postPolicyDocument{
+		Expiration: now.Add(p.Expires).UTC().Format("2006-01-02T15:04:05.000Z"),
+		Conditions: conditions,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	policy := base64.StdEncoding.EncodeToString(document)
+	all[FIELD_POLICY] = policy
+	return all, policy, nil
+}
+
+// checks the fields and the size of a posted file against the encoded policy document
+func checkPostPolicy(policy string, fields map[string]string, size int64, now time.Time) error {
+	raw, err := base64.StdEncoding.DecodeString(policy)
+	if err != nil {
+		return fmt.Errorf("%w: policy is malformed", ErrPolicyViolation)
+	}
+	document := postPolicyDocument{}
+	err = json.Unmarshal(raw, &document)
+	if err != nil {
+		return fmt.Errorf("%w: policy is malformed", ErrPolicyViolation)
+	}
+	expiration, err := time.Parse(time.RFC3339, document.Expiration)
+	if err != nil || now.After(expiration) {
+		return fmt.Errorf("%w: policy is expired", ErrPolicyViolation)
+	}
+	for _, condition := range document.Conditions {
+		switch c := condition.(type) {
+		case map[string]interface{}:
+			for name, value := range c {
+				if fields[name] != fmt.Sprint(value) {
+					return fmt.Errorf("%w: field %s does not match", ErrPolicyViolation, name)
+				}
+			}
+		case []interface{}:
+			err = checkPostCondition(c, fields, size)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: condition is malformed", ErrPolicyViolation)
+		}
+	}
+	return nil
+}
+
+func checkPostCondition(condition []interface{}, fields map[string]string, size int64) error {
+	if len(condition) != 3 {
+		return fmt.Errorf("%w: condition is malformed", ErrPolicyViolation)
+	}
+	operator, _ := condition[0].(string)
+	switch operator {
+	case "eq", "starts-with":
+		name, _ := condition[1].(string)
+		value, _ := condition[2].(string)
+		field := fields[strings.TrimPrefix(name, "$")]
+		if (operator == "eq" && field != value) || !strings.HasPrefix(field, value) {
+			return fmt.Errorf("%w: field %s does not match", ErrPolicyViolation, strings.TrimPrefix(name, "$"))
+		}
+	case "content-length-range":
+		min, _ := condition[1].(float64)
+		max, _ := condition[2].(float64)
+		if size < int64(min) || size > int64(max) {
+			return fmt.Errorf("%w: file size must be between %d and %d bytes", ErrPolicyViolation, int64(min), int64(max))
+		}
+	default:
+		return fmt.Errorf("%w: condition %s is not supported", ErrPolicyViolation, operator)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package blobstore
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidRange is returned, if no byte of the requested range is within the object
+var ErrInvalidRange = errors.New("range not satisfiable")
+
+// unit of the ranges, which are supported in Range headers
+const RANGE_UNIT string = "bytes"
+
+// ByteRange is a range of the bytes of an object
+type ByteRange struct {
+	Offset int64
+	Length int64
+}
+
+// Header returns the range as value of the Range header of a request
+func (r *ByteRange) Header() string {
+	return fmt.Sprintf("%s=%d-%d", RANGE_UNIT, r.Offset, r.Offset+r.Length-1)
+}
+
+// ContentRange returns the value of the Content-Range header of a response, which sends the range of an object
+// with given size
+func (r *ByteRange) ContentRange(size int64) string {
+	return fmt.Sprintf("%s %d-%d/%d", RANGE_UNIT, r.Offset, r.Offset+r.Length-1, size)
+}
+
+// ParseRange returns the range of an object with given size, which is requested by the Range header of a request
+// (https://www.rfc-editor.org/rfc/rfc9110#name-range). Nil is returned, if the whole object is sent, because the
+// header is missing, malformed or requests multiple ranges. ErrInvalidRange is returned, if the range starts
+// after the end of the object.
+func ParseRange(header string, size int64) (*ByteRange, error) {
+	header = strings.TrimSpace(header)
+	if !strings.HasPrefix(header, RANGE_UNIT+"=") || strings.Contains(header, ",") {
+		return nil, nil
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(header, RANGE_UNIT+"="))
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok {
+		return nil, nil
+	}
+	// suffix range of the last bytes, e.g. bytes=-500
+	if first == "" {
+		length, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || length < 0 {
+			return nil, nil
+		}
+		if length == 0 || size == 0 {
+			return nil, ErrInvalidRange
+		}
+		if length > size {
+			length = size
+		}
+		return &ByteRange{Offset: size - length, Length: length}, nil
+	}
+	offset, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || offset < 0 {
+		return nil, nil
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < offset {
+			return nil, nil
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+	if offset >= size {
+		return nil, ErrInvalidRange
+	}
+	return &ByteRange{Offset: offset, Length: end - offset + 1}, nil
+}
+
+// MatchesETag returns true, if given value of an If-None-Match header lists the etag of an object. Weak
+// etags are compared by their value, as required for If-None-Match.
+func MatchesETag(header, etag string) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,377 @@
+package blobstore
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	goConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// presigned posts are signed with signature version 4 of this service
+const S3_SIGNING_SERVICE string = "s3"
+
+type s3Store struct {
+	bucket      string
+	region      string
+	credentials aws.CredentialsProvider
+	client      *s3.Client
+	presigner   *s3.PresignClient
+}
+
+func NewS3Store(bucket string) BlobStore {
+	cfg, err := goConfig.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		log.Panic(err)
+	}
+	client := s3.NewFromConfig(cfg)
+	return &s3Store{
+		bucket:      bucket,
+		region:      cfg.Region,
+		credentials: cfg.Credentials,
+		client:      client,
+		presigner:   s3.NewPresignClient(client),
+	}
+}
+
+func (s *s3Store) PresignGet(key string, expires time.Duration) (string, error) {
+	return s.PresignGetVersion(key, "", expires)
+}
+
+func (s *s3Store) PresignGetVersion(key, versionId string, expires time.Duration) (string, error) {
+	res, err := s.presigner.PresignGetObject(context.TODO(), &s3.GetObjectInput{
+		Bucket:    &s.bucket,
+		Key:       &key,
+		VersionId: optional(versionId),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate a pre-signed url: %v", err)
+	}
+	return res.URL, nil
+}
+
+func (s *s3Store) PresignPut(key string, expires time.Duration) (string, error) {
+	res, err := s.presigner.PresignPutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket: &s.bucket,
+		Key:    &key,
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate a pre-signed url: %v", err)
+	}
+	return res.URL, nil
+}
+
+// PresignPost signs the policy with signature version 4, the sdk does not presign posts
+// (https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-HTTPPOSTConstructPolicy.html)
+func (s *s3Store) PresignPost(policy PostPolicy) (*PresignedPost, error) {
+	creds, err := s.credentials.Retrieve(context.TODO())
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve credentials: %v", err)
+	}
+	now := time.Now().UTC()
+	date := now.Format("20060102")
+	fields := map[string]string{
+		"x-amz-algorithm":  "AWS4-HMAC-SHA256",
+		"x-amz-credential": strings.Join([]string{creds.AccessKeyID, date, s.region, S3_SIGNING_SERVICE, "aws4_request"}, "/"),
+		"x-amz-date":       now.Format("20060102T150405Z"),
+	}
+	if creds.SessionToken != "" {
+		fields["x-amz-security-token"] = creds.SessionToken
+	}
+	form, encoded, err := policy.encode(now, fields, map[string]string{"bucket": s.bucket})
+	if err != nil {
+		return nil, err
+	}
+	signingKey := []byte("AWS4" + creds.SecretAccessKey)
+	for _, scope := range []string{date, s.region, S3_SIGNING_SERVICE, "aws4_request"} {
+		signingKey = hmacSha256(signingKey, scope)
+	}
+	form["x-amz-signature"] = hex.EncodeToString(hmacSha256(signingKey, encoded))
+	return &PresignedPost{
+		Url:    fmt.Sprintf("https://%s.s3.%s.amazonaws.com/", s.bucket, s.region),
+		Fields: form,
+	}, nil
+}
+
+func (s *s3Store) Head(key string) (*ObjectInfo, error) {
+	return s.HeadVersion(key, "")
+}
+
+func (s *s3Store) HeadVersion(key, versionId string) (*ObjectInfo, error) {
+	res, err := s.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+		Bucket:    &s.bucket,
+		Key:       &key,
+		VersionId: optional(versionId),
+	})
+	if err != nil {
+		var notFound *s3Types.NotFound
+		var apiErr smithy.APIError
+		if errors.As(err, &notFound) || (errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchVersion") {
+			return nil, fmt.Errorf("cannot find object %s: %w", key, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to head object %s: %v", key, err)
+	}
+	return &ObjectInfo{
+		Key:          key,
+		Size:         res.ContentLength,
+		ETag:         aws.ToString(res.ETag),
+		ContentType:  aws.ToString(res.ContentType),
+		LastModified: aws.ToTime(res.LastModified),
+		VersionId:    aws.ToString(res.VersionId),
+	}, nil
+}
+
+func (s *s3Store) PutObject(key, contentType string, body io.ReadSeeker) error {
+	_, err := s.client.PutObject(context.TODO(), &s3.PutObjectInput{
+		Bucket:      &s.bucket,
+		Key:         &key,
+		ContentType: optional(contentType),
+		Body:        body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put object %s: %v", key, err)
+	}
+	return nil
+}
+
+func (s *s3Store) Delete(key string) error {
+	_, err := s.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket: &s.bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete object %s: %v", key, err)
+	}
+	return nil
+}
+
+func (s *s3Store) DeleteVersion(key, versionId string) error {
+	if versionId == "" {
+		return fmt.Errorf("version of object %s is missing", key)
+	}
+	_, err := s.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+		Bucket:    &s.bucket,
+		Key:       &key,
+		VersionId: &versionId,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete version %s of object %s: %v", versionId, key, err)
+	}
+	return nil
+}
+
+func (s *s3Store) Get(key string) (io.ReadCloser, error) {
+	return s.GetVersion(key, "")
+}
+
+func (s *s3Store) GetVersion(key, versionId string) (io.ReadCloser, error) {
+	return s.GetRange(key, versionId, nil)
+}
+
+func (s *s3Store) GetRange(key, versionId string, byteRange *ByteRange) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket:    &s.bucket,
+		Key:       &key,
+		VersionId: optional(versionId),
+	}
+	if byteRange != nil {
+		input.Range = aws.String(byteRange.Header())
+	}
+	res, err := s.client.GetObject(context.TODO(), input)
+	if err != nil {
+		var noSuchKey *s3Types.NoSuchKey
+		var apiErr smithy.APIError
+		if errors.As(err, &noSuchKey) || (errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchVersion") {
+			return nil, fmt.Errorf("cannot find object %s: %w", key, ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to get object %s: %v", key, err)
+	}
+	return res.Body, nil
+}
+
+func (s *s3Store) List(prefix string, fn func(object ObjectInfo) error) error {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: &s.bucket,
+		Prefix: &prefix,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return fmt.Errorf("failed to list objects of %s: %v", prefix, err)
+		}
+		for _, object := range page.Contents {
+			err = fn(ObjectInfo{
+				Key:          aws.ToString(object.Key),
+				Size:         object.Size,
+				ETag:         aws.ToString(object.ETag),
+				LastModified: aws.ToTime(object.LastModified),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *s3Store) ListVersions(key string) ([]ObjectInfo, error) {
+	versions := []ObjectInfo{}
+	input := &s3.ListObjectVersionsInput{
+		Bucket: &s.bucket,
+		Prefix: &key,
+	}
+	for {
+		page, err := s.client.ListObjectVersions(context.TODO(), input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list versions of %s: %v", key, err)
+		}
+		// versions of other keys, which start with the key, are listed as well
+		for _, version := range page.Versions {
+			if aws.ToString(version.Key) != key {
+				continue
+			}
+			versions = append(versions, ObjectInfo{
+				Key:          key,
+				Size:         version.Size,
+				ETag:         aws.ToString(version.ETag),
+				LastModified: aws.ToTime(version.LastModified),
+				VersionId:    aws.ToString(version.VersionId),
+				IsLatest:     version.IsLatest,
+			})
+		}
+		if !page.IsTruncated {
+			break
+		}
+		input.KeyMarker = page.NextKeyMarker
+		input.VersionIdMarker = page.NextVersionIdMarker
+	}
+	sort.SliceStable(versions, func(i, j int) bool { return versions[i].LastModified.After(versions[j].LastModified) })
+	return versions, nil
+}
+
+func (s *s3Store) CreateMultipartUpload(key, contentType string) (string, error) {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: &s.bucket,
+		Key:    &key,
+	}
+	if contentType != "" {
+		input.ContentType = &contentType
+	}
+	res, err := s.client.CreateMultipartUpload(context.TODO(), input)
+	if err != nil {
+		return "", fmt.Errorf("failed to create multipart upload: %v", err)
+	}
+	return aws.ToString(res.UploadId), nil
+}
+
+func (s *s3Store) PresignUploadPart(key, uploadId string, partNumber int32, expires time.Duration) (string, error) {
+	res, err := s.presigner.PresignUploadPart(context.TODO(), &s3.UploadPartInput{
+		Bucket:     &s.bucket,
+		Key:        &key,
+		UploadId:   &uploadId,
+		PartNumber: partNumber,
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate a pre-signed url: %v", err)
+	}
+	return res.URL, nil
+}
+
+func (s *s3Store) UploadPart(key, uploadId string, partNumber int32, body io.ReadSeeker) (string, error) {
+	res, err := s.client.UploadPart(context.TODO(), &s3.UploadPartInput{
+		Bucket:     &s.bucket,
+		Key:        &key,
+		UploadId:   &uploadId,
+		PartNumber: partNumber,
+		Body:       body,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload part %d: %v", partNumber, err)
+	}
+	return aws.ToString(res.ETag), nil
+}
+
+func (s *s3Store) ListParts(key, uploadId string) ([]Part, error) {
+	parts := []Part{}
+	paginator := s3.NewListPartsPaginator(s.client, &s3.ListPartsInput{
+		Bucket:   &s.bucket,
+		Key:      &key,
+		UploadId: &uploadId,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			return nil, fmt.Errorf("failed to list uploaded parts: %v", err)
+		}
+		for _, part := range page.Parts {
+			parts = append(parts, Part{
+				PartNumber: part.PartNumber,
+				ETag:       aws.ToString(part.ETag),
+				Size:       part.Size,
+			})
+		}
+	}
+	return parts, nil
+}
+
+func (s *s3Store) CompleteMultipartUpload(key, uploadId string, parts []Part) error {
+	completedParts := make([]s3Types.CompletedPart, 0, len(parts))
+	for _, part := range parts {
+		completedParts = append(completedParts, s3Types.CompletedPart{
+			PartNumber: part.PartNumber,
+			ETag:       aws.String(part.ETag),
+		})
+	}
+	_, err := s.client.CompleteMultipartUpload(context.TODO(), &s3.CompleteMultipartUploadInput{
+		Bucket:          &s.bucket,
+		Key:             &key,
+		UploadId:        &uploadId,
+		MultipartUpload: &s3Types.CompletedMultipartUpload{Parts: completedParts},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %v", err)
+	}
+	return nil
+}
+
+func (s *s3Store) AbortMultipartUpload(key, uploadId string) error {
+	_, err := s.client.AbortMultipartUpload(context.TODO(), &s3.AbortMultipartUploadInput{
+		Bucket:   &s.bucket,
+		Key:      &key,
+		UploadId: &uploadId,
+	})
+	if err != nil {
+		var noSuchUpload *s3Types.NoSuchUpload
+		if errors.As(err, &noSuchUpload) {
+			return fmt.Errorf("cannot find upload %s: %w", uploadId, ErrNotFound)
+		}
+		return fmt.Errorf("failed to abort multipart upload: %v", err)
+	}
+	return nil
+}
+
+// returns nil for an empty string, so that the parameter is not sent
+func optional(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
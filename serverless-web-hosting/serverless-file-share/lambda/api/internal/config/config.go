@@ -2,6 +2,9 @@ package config
 
 import (
 	"os"
+	"strconv"
+
+	"github.com/unitypark/serverless-file-share/lambda/api/types"
 )
 
 type Environment string
@@ -15,21 +18,102 @@ const (
 const (
 	LocalTableName                  = "FileShare"
 	LocalBucketName                 = "LocalTestBucket"
+	LocalAccessKeySecret            = "LocalAccessKeySecret"
+	LocalBlobRoot                   = ".blobs"
+	LocalBlobBaseUrl                = "http://localhost:8080"
+	LocalBlobSecret                 = "LocalBlobSecret"
+	LocalUsername                   = "local"
 	EnvName                         = "env"
 	ENV_URL_TABLE                   = "URL_TABLE"
 	ENV_FILE_SHARE_BUCKET           = "FILE_SHARE_BUCKET"
 	ENV_JWKS_URL                    = "JWKS_URL"
 	ENV_TOKEN_ISSUER                = "ISS"
 	ENV_COGNITO_USER_POOL_CLIENT_ID = "COGNITO_USER_POOL_CLIENT_ID"
+	ENV_MAX_DOWNLOAD_COUNT          = "MAX_DOWNLOAD_COUNT"
+	ENV_MAX_DOWNLOAD_EXPIRING_TIME  = "MAX_DOWNLOAD_EXPIRING_TIME_IN_MINUTES"
+	ENV_ACCESS_KEY_SECRET           = "ACCESS_KEY_SECRET"
+	ENV_ACCESS_KEY_SECRET_NAME      = "ACCESS_KEY_SECRET_NAME"
+	ENV_ALLOW_LEGACY_ACCESS_KEYS    = "ALLOW_LEGACY_ACCESS_KEYS"
+	ENV_CLAMD_ADDRESS               = "CLAMD_ADDRESS"
+	ENV_LOCAL_BLOB_ROOT             = "LOCAL_BLOB_ROOT"
+	ENV_LOCAL_BLOB_BASE_URL         = "LOCAL_BLOB_BASE_URL"
+	ENV_LOCAL_BLOB_SECRET           = "LOCAL_BLOB_SECRET"
+	ENV_LOCAL_USERNAME              = "LOCAL_USERNAME"
+	ENV_LOCAL_IS_ADMIN              = "LOCAL_IS_ADMIN"
+	ENV_UPLOAD_POLICIES             = "UPLOAD_POLICIES"
+	ENV_SMTP_HOST                   = "SMTP_HOST"
+	ENV_SMTP_PORT                   = "SMTP_PORT"
+	ENV_SMTP_USERNAME               = "SMTP_USERNAME"
+	ENV_SMTP_PASSWORD               = "SMTP_PASSWORD"
+	ENV_SMTP_PASSWORD_SECRET_NAME   = "SMTP_PASSWORD_SECRET_NAME"
+	ENV_SMTP_FROM                   = "SMTP_FROM"
+	ENV_WEBHOOK_URL                 = "WEBHOOK_URL"
+	ENV_WEBHOOK_SECRET              = "WEBHOOK_SECRET"
+	ENV_WEBHOOK_SECRET_NAME         = "WEBHOOK_SECRET_NAME"
+	ENV_ALB_ARN                     = "ALB_ARN"
+	ENV_RETENTION_POLICY            = "RETENTION_POLICY"
+	ENV_SWEEPER_DRY_RUN             = "SWEEPER_DRY_RUN"
+	ENV_DOWNLOAD_SIGNER             = "DOWNLOAD_SIGNER"
+	ENV_CLOUDFRONT_DOMAIN           = "CLOUDFRONT_DOMAIN"
+	ENV_CLOUDFRONT_KEY_PAIR_ID      = "CLOUDFRONT_KEY_PAIR_ID"
+	ENV_CLOUDFRONT_PRIVATE_KEY      = "CLOUDFRONT_PRIVATE_KEY"
+	ENV_CLOUDFRONT_KEY_SECRET       = "CLOUDFRONT_PRIVATE_KEY_SECRET"
+	ENV_RATE_LIMIT_POLICY           = "RATE_LIMIT_POLICY"
+)
+
+// signers of the download urls of shares
+const (
+	SignerS3         = "s3"
+	SignerCloudFront = "cloudfront"
+)
+
+// submission port of smtp servers, which support STARTTLS
+const DefaultSmtpPort = 587
+
+// upper bounds of the share options, which can be chosen by the sharer
+const (
+	DefaultMaxDownloadCount = 1000
+	// pre-signed urls with signature version 4 are valid for up to 7 days
+	DefaultMaxDownloadExpiringMinutes = 7 * 24 * 60
 )
 
 type Config struct {
-	Env                 Environment
-	DbbTableName        string
-	FileshareBucketName string
-	JwksUrl             string
-	TokenIss            string
-	TokenAud            string
+	Env                        Environment
+	DbbTableName               string
+	FileshareBucketName        string
+	JwksUrl                    string
+	TokenIss                   string
+	TokenAud                   string
+	MaxDownloadCount           int
+	MaxDownloadExpiringMinutes int
+	AccessKeySecret            string
+	AccessKeySecretName        string
+	AllowLegacyAccessKeys      bool
+	ClamdAddress               string
+	LocalBlobRoot              string
+	LocalBlobBaseUrl           string
+	LocalBlobSecret            string
+	LocalUsername              string
+	LocalIsAdmin               bool
+	UploadPolicies             map[string]UploadPolicy
+	SmtpHost                   string
+	SmtpPort                   int
+	SmtpUsername               string
+	SmtpPassword               string
+	SmtpPasswordSecretName     string
+	SmtpFrom                   string
+	WebhookUrl                 string
+	WebhookSecret              string
+	WebhookSecretName          string
+	AlbArn                     string
+	RetentionPolicy            RetentionPolicy
+	SweeperDryRun              bool
+	DownloadSigner             string
+	CloudFrontDomain           string
+	CloudFrontKeyPairId        string
+	CloudFrontPrivateKey       string
+	CloudFrontPrivateKeySecret string
+	RateLimitPolicy            RateLimitPolicy
 }
 
 func New() *Config {
@@ -46,9 +130,82 @@ func New() *Config {
 	cfg.JwksUrl = os.Getenv(ENV_JWKS_URL)
 	cfg.TokenIss = os.Getenv(ENV_TOKEN_ISSUER)
 	cfg.TokenAud = os.Getenv(ENV_COGNITO_USER_POOL_CLIENT_ID)
+	cfg.MaxDownloadCount = getIntEnv(ENV_MAX_DOWNLOAD_COUNT, DefaultMaxDownloadCount)
+	cfg.MaxDownloadExpiringMinutes = getIntEnv(ENV_MAX_DOWNLOAD_EXPIRING_TIME, DefaultMaxDownloadExpiringMinutes)
+	if cfg.MaxDownloadExpiringMinutes > DefaultMaxDownloadExpiringMinutes {
+		cfg.MaxDownloadExpiringMinutes = DefaultMaxDownloadExpiringMinutes
+	}
+	// secrets are set in the env locally, and read from secrets manager by the name or arn of their secret otherwise
+	cfg.AccessKeySecret = os.Getenv(ENV_ACCESS_KEY_SECRET)
+	cfg.AccessKeySecretName = os.Getenv(ENV_ACCESS_KEY_SECRET_NAME)
+	if len(cfg.AccessKeySecret) == 0 && len(cfg.AccessKeySecretName) == 0 && cfg.Env == Local {
+		cfg.AccessKeySecret = LocalAccessKeySecret
+	}
+	// shares created before the access keys were hashed can be looked up by their key, as long as they are live
+	cfg.AllowLegacyAccessKeys = os.Getenv(ENV_ALLOW_LEGACY_ACCESS_KEYS) != "false"
+	// uploads are scanned for malware, if clamd is reachable e.g. tcp://clamd.internal:3310
+	cfg.ClamdAddress = os.Getenv(ENV_CLAMD_ADDRESS)
+	// in local mode, files are stored on the local disk and up- and downloaded over the local server
+	cfg.LocalBlobRoot = getStringEnv(ENV_LOCAL_BLOB_ROOT, LocalBlobRoot)
+	cfg.LocalBlobBaseUrl = getStringEnv(ENV_LOCAL_BLOB_BASE_URL, LocalBlobBaseUrl)
+	cfg.LocalBlobSecret = getStringEnv(ENV_LOCAL_BLOB_SECRET, LocalBlobSecret)
+	// in local mode, there is no authorizer in front of the api and every request is sent by this user
+	cfg.LocalUsername = getStringEnv(ENV_LOCAL_USERNAME, LocalUsername)
+	cfg.LocalIsAdmin = os.Getenv(ENV_LOCAL_IS_ADMIN) == "true"
+	cfg.UploadPolicies = getUploadPolicies()
+	// owners are notified about downloads of their shares by email and/or webhook, if they are configured
+	cfg.SmtpHost = os.Getenv(ENV_SMTP_HOST)
+	cfg.SmtpPort = getIntEnv(ENV_SMTP_PORT, DefaultSmtpPort)
+	cfg.SmtpUsername = os.Getenv(ENV_SMTP_USERNAME)
+	cfg.SmtpPassword = os.Getenv(ENV_SMTP_PASSWORD)
+	cfg.SmtpPasswordSecretName = os.Getenv(ENV_SMTP_PASSWORD_SECRET_NAME)
+	cfg.SmtpFrom = os.Getenv(ENV_SMTP_FROM)
+	cfg.WebhookUrl = os.Getenv(ENV_WEBHOOK_URL)
+	cfg.WebhookSecret = os.Getenv(ENV_WEBHOOK_SECRET)
+	cfg.WebhookSecretName = os.Getenv(ENV_WEBHOOK_SECRET_NAME)
+	// the api accepts requests of this application load balancer, which authenticates the users with oidc
+	cfg.AlbArn = os.Getenv(ENV_ALB_ARN)
+	cfg.RetentionPolicy = getRetentionPolicy()
+	// the sweeper only logs, what it would delete
+	cfg.SweeperDryRun = os.Getenv(ENV_SWEEPER_DRY_RUN) == "true"
+	// shares are downloaded from s3 by presigned urls, or over cloudfront by urls signed with its key pair,
+	// whose private key is set in the env or read from secrets manager by the name or arn of its secret
+	cfg.DownloadSigner = getStringEnv(ENV_DOWNLOAD_SIGNER, SignerS3)
+	cfg.CloudFrontDomain = os.Getenv(ENV_CLOUDFRONT_DOMAIN)
+	cfg.CloudFrontKeyPairId = os.Getenv(ENV_CLOUDFRONT_KEY_PAIR_ID)
+	cfg.CloudFrontPrivateKey = os.Getenv(ENV_CLOUDFRONT_PRIVATE_KEY)
+	cfg.CloudFrontPrivateKeySecret = os.Getenv(ENV_CLOUDFRONT_KEY_SECRET)
+	cfg.RateLimitPolicy = getRateLimitPolicy()
 	return cfg
 }
 
+// returns the positive integer value of given env var, or the default value if it is not set or invalid
+func getIntEnv(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// returns the value of given env var, or the default value if it is not set
+func getStringEnv(key string, defaultValue string) string {
+	value := os.Getenv(key)
+	if len(value) == 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// UploadPolicy returns the upload policy of given role, unknown roles get the policy of users
+func (c *Config) UploadPolicy(role string) UploadPolicy {
+	policy, ok := c.UploadPolicies[role]
+	if !ok {
+		return c.UploadPolicies[types.ROLE_USER]
+	}
+	return policy
+}
+
 func (c *Config) setEnv() {
 	if inLambda() {
 		c.Env = Prod
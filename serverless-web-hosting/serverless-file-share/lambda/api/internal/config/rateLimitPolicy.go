@@ -0,0 +1,69 @@
+package config
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+)
+
+// default limits of the resolution of access keys
+const (
+	DefaultAccessKeyRequestsPerMinute = 10
+	DefaultAccessKeyBurst             = 20
+	DefaultSourceIpRequestsPerMinute  = 30
+	DefaultSourceIpBurst              = 60
+)
+
+// RateLimit is a token bucket, which holds up to Burst tokens and is refilled with PerMinute tokens per minute.
+// Every request takes a token and is throttled, while the bucket is empty. Requests are not limited, if
+// PerMinute is zero.
+type RateLimit struct {
+	PerMinute int `json:"perMinute"`
+	Burst     int `json:"burst"`
+}
+
+// RateLimitPolicy limits the requests, which resolve access keys, per access key and per source ip of the caller,
+// so that access keys cannot be guessed by brute force and a single share cannot be hammered
+type RateLimitPolicy struct {
+	AccessKey RateLimit `json:"accessKey"`
+	SourceIp  RateLimit `json:"sourceIp"`
+}
+
+// Enabled returns false, if requests are not limited
+func (l RateLimit) Enabled() bool {
+	return l.PerMinute > 0
+}
+
+// Interval returns the time, in which a single token is refilled
+func (l RateLimit) Interval() time.Duration {
+	return time.Minute / time.Duration(l.PerMinute)
+}
+
+// returns the rate limit policy, the env var overrides the defaults of the limits it contains
+// e.g. {"sourceIp":{"perMinute":120,"burst":240}}
+func getRateLimitPolicy() RateLimitPolicy {
+	policy := RateLimitPolicy{
+		AccessKey: RateLimit{PerMinute: DefaultAccessKeyRequestsPerMinute, Burst: DefaultAccessKeyBurst},
+		SourceIp:  RateLimit{PerMinute: DefaultSourceIpRequestsPerMinute, Burst: DefaultSourceIpBurst},
+	}
+	value := os.Getenv(ENV_RATE_LIMIT_POLICY)
+	if len(value) == 0 {
+		return policy
+	}
+	err := json.Unmarshal([]byte(value), &policy)
+	if err != nil {
+		// the logger is not initialized yet
+		log.Panicf("invalid %s: %v", ENV_RATE_LIMIT_POLICY, err)
+	}
+	for _, limit := range []*RateLimit{&policy.AccessKey, &policy.SourceIp} {
+		if limit.PerMinute < 0 {
+			limit.PerMinute = 0
+		}
+		// a bucket holds at least the token of a single request
+		if limit.Burst < 1 {
+			limit.Burst = 1
+		}
+	}
+	return policy
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"time"
+
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	"github.com/unitypark/serverless-file-share/lambda/api/types"
+)
+
+// default days, for which expired items and unused files are kept
+const (
+	DefaultShareRetentionDays  = 30
+	DefaultAccessRetentionDays = 365
+	DefaultUploadRetentionDays = 7
+	DefaultFileRetentionDays   = 30
+)
+
+// RetentionPolicy tells for how many days the items of the table are kept after they expired, before they are
+// deleted by the ttl of the table. Uploads, which are still in progress after UploadDays, are aborted by the sweeper.
+// Files are deleted by the sweeper FileDays after they were uploaded and all of their shares expired. Items and
+// files are kept forever, if their days are zero.
+type RetentionPolicy struct {
+	ShareDays  int `json:"shareDays"`
+	AccessDays int `json:"accessDays"`
+	UploadDays int `json:"uploadDays"`
+	FileDays   int `json:"fileDays"`
+}
+
+// Retention returns for how long items of given type are kept after they expired, zero if they are kept forever
+func (p RetentionPolicy) Retention(itemType string) time.Duration {
+	var days int
+	switch itemType {
+	case types.TYPE_SHARE:
+		days = p.ShareDays
+	case types.TYPE_ACCESS:
+		days = p.AccessDays
+	case types.TYPE_UPLOAD:
+		// aborted uploads are kept as long again, so that the sweeper aborts them before they are deleted
+		days = 2 * p.UploadDays
+	case types.TYPE_FILE:
+		days = p.FileDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Ttl returns the epoch seconds, after which given item is deleted by the ttl of the table, zero if it is kept forever
+func (p RetentionPolicy) Ttl(asset *entities.Asset) int64 {
+	retention := p.Retention(asset.Type)
+	expiredAt, ok := asset.ExpiredAt()
+	if retention <= 0 || !ok {
+		return 0
+	}
+	return expiredAt.Add(retention).Unix()
+}
+
+// returns the retention policy, the env var overrides the defaults of the days it contains e.g. {"fileDays":90}
+func getRetentionPolicy() RetentionPolicy {
+	policy := RetentionPolicy{
+		ShareDays:  DefaultShareRetentionDays,
+		AccessDays: DefaultAccessRetentionDays,
+		UploadDays: DefaultUploadRetentionDays,
+		FileDays:   DefaultFileRetentionDays,
+	}
+	value := os.Getenv(ENV_RETENTION_POLICY)
+	if len(value) == 0 {
+		return policy
+	}
+	err := json.Unmarshal([]byte(value), &policy)
+	if err != nil {
+		// the logger is not initialized yet, and files must not be deleted earlier than configured
+		log.Panicf("invalid %s: %v", ENV_RETENTION_POLICY, err)
+	}
+	for _, days := range []*int{&policy.ShareDays, &policy.AccessDays, &policy.UploadDays, &policy.FileDays} {
+		if *days < 0 {
+			*days = 0
+		}
+	}
+	return policy
+}
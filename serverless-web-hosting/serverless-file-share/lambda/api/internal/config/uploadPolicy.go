@@ -0,0 +1,79 @@
+package config
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/unitypark/serverless-file-share/lambda/api/types"
+)
+
+// default upper bounds of the file size of uploads and of the stored bytes of a user by role
+const (
+	DefaultAdminMaxFileSize int64 = 5 * 1024 * 1024 * 1024 * 1024
+	DefaultUserMaxFileSize  int64 = 5 * 1024 * 1024 * 1024
+	DefaultUserQuota        int64 = 10 * 1024 * 1024 * 1024
+)
+
+// UploadPolicy restricts the uploads of a role. ContentTypes are media types like application/pdf or wildcards
+// like image/*, every content type is allowed if it is empty. Users of the role can store up to Quota bytes,
+// unless an admin sets another quota for them. Storage is unlimited if Quota is zero.
+type UploadPolicy struct {
+	MaxFileSize  int64    `json:"maxFileSize"`
+	ContentTypes []string `json:"contentTypes"`
+	Quota        int64    `json:"quota"`
+}
+
+// ContentTypePrefix returns the prefix of the allowed content types, which matches given media type
+func (p UploadPolicy) ContentTypePrefix(mediaType string) (string, bool) {
+	if len(p.ContentTypes) == 0 {
+		return "", true
+	}
+	for _, allowed := range p.ContentTypes {
+		allowed = strings.ToLower(allowed)
+		if allowed == "*/*" || allowed == "*" {
+			return "", true
+		}
+		if strings.HasSuffix(allowed, "/*") {
+			prefix := strings.TrimSuffix(allowed, "*")
+			if strings.HasPrefix(mediaType, prefix) {
+				return prefix, true
+			}
+			continue
+		}
+		if mediaType == allowed {
+			return allowed, true
+		}
+	}
+	return "", false
+}
+
+// returns the upload policies of the roles, the env var overrides the defaults of the roles it contains
+// e.g. {"user":{"maxFileSize":104857600,"contentTypes":["image/*","application/pdf"]}}
+func getUploadPolicies() map[string]UploadPolicy {
+	policies := map[string]UploadPolicy{
+		types.ROLE_ADMIN: {MaxFileSize: DefaultAdminMaxFileSize},
+		types.ROLE_USER:  {MaxFileSize: DefaultUserMaxFileSize, Quota: DefaultUserQuota},
+	}
+	value := os.Getenv(ENV_UPLOAD_POLICIES)
+	if len(value) == 0 {
+		return policies
+	}
+	overrides := map[string]UploadPolicy{}
+	err := json.Unmarshal([]byte(value), &overrides)
+	if err != nil {
+		// the logger is not initialized yet, and uploads must not be less restricted than configured
+		log.Panicf("invalid %s: %v", ENV_UPLOAD_POLICIES, err)
+	}
+	for role, policy := range overrides {
+		if policy.MaxFileSize <= 0 || policy.MaxFileSize > DefaultAdminMaxFileSize {
+			policy.MaxFileSize = DefaultAdminMaxFileSize
+		}
+		if policy.Quota < 0 {
+			policy.Quota = 0
+		}
+		policies[role] = policy
+	}
+	return policies
+}
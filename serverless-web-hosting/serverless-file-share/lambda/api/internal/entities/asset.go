@@ -1,10 +1,9 @@
 package entities
 
 import (
-	"hash/fnv"
 	"math/rand"
 	"path/filepath"
-	"strconv"
+	"strings"
 	"time"
 
 	"github.com/oklog/ulid"
@@ -12,56 +11,291 @@ import (
 )
 
 type Asset struct {
-	PK         string `json:"pk" dynamodbav:"PK"`
-	SK         string `json:"sk" dynamodbav:"SK"`
-	AccessKey  string `json:"accessKey" dynamodbav:"AccessKey,omitempty"`
-	Filename   string `json:"filename" dynamodbav:"Filename,omitempty"`
-	Url        string `json:"url" dynamodbav:"Url,omitempty"`
-	CreatedAt  string `json:"createAt" dynamodbav:"CreatedAt,omitempty"`
-	CreatedBy  string `json:"createdBy" dynamodbav:"CreatedBy,omitempty"`
-	ExpiringAt string `json:"expiringAt" dynamodbav:"ExpiringAt,omitempty"`
-	AccessedAt string `json:"accessedAt" dynamodbav:"AccessedAt,omitempty"`
-	AccessedBy string `json:"accessedBy" dynamodbav:"AccessedBy,omitempty"`
+	PK   string `json:"pk" dynamodbav:"PK"`
+	SK   string `json:"sk" dynamodbav:"SK"`
+	Type string `json:"type" dynamodbav:"Type,omitempty"`
+	Path string `json:"path" dynamodbav:"Path,omitempty"`
+	// access key is only stored by legacy shares, new shares are keyed by the HMAC of their access key
+	AccessKey     string `json:"accessKey" dynamodbav:"AccessKey,omitempty"`
+	Filename      string `json:"filename" dynamodbav:"Filename,omitempty"`
+	Url           string `json:"url" dynamodbav:"Url,omitempty"`
+	CreatedAt     string `json:"createAt" dynamodbav:"CreatedAt,omitempty"`
+	CreatedBy     string `json:"createdBy" dynamodbav:"CreatedBy,omitempty"`
+	ExpiringAt    string `json:"expiringAt" dynamodbav:"ExpiringAt,omitempty"`
+	AccessedAt    string `json:"accessedAt" dynamodbav:"AccessedAt,omitempty"`
+	AccessedBy    string `json:"accessedBy" dynamodbav:"AccessedBy,omitempty"`
+	DownloadCount int    `json:"downloadCount" dynamodbav:"DownloadCount,omitempty"`
+	MaxDownloads  int    `json:"maxDownloads" dynamodbav:"MaxDownloads,omitempty"`
+	State         string `json:"state" dynamodbav:"State,omitempty"`
+	RevokedAt     string `json:"revokedAt" dynamodbav:"RevokedAt,omitempty"`
+	// passphrase is never stored in plain text, only its slow hash
+	PassphraseHash string `json:"-" dynamodbav:"PassphraseHash,omitempty"`
+	FailedAttempts int    `json:"failedAttempts" dynamodbav:"FailedAttempts,omitempty"`
+	LockedUntil    string `json:"lockedUntil" dynamodbav:"LockedUntil,omitempty"`
+	// owner is notified about every download of a share, accesses of such a share are marked as well
+	Notify bool `json:"notify" dynamodbav:"Notify,omitempty"`
+	// one-time share, which is consumed by its first download, and whose object is deleted once its url expired
+	OneTime         bool   `json:"oneTime" dynamodbav:"OneTime,omitempty"`
+	DeleteObject    bool   `json:"deleteObject" dynamodbav:"DeleteObject,omitempty"`
+	ConsumedAt      string `json:"consumedAt" dynamodbav:"ConsumedAt,omitempty"`
+	ObjectDeletedAt string `json:"objectDeletedAt" dynamodbav:"ObjectDeletedAt,omitempty"`
+	// conditions of the custom policy of a cloudfront signed url, the url of the share is valid from NotBefore
+	// and is only valid for callers from the cidr of IpAddress
+	NotBefore string `json:"notBefore" dynamodbav:"NotBefore,omitempty"`
+	IpAddress string `json:"ipAddress" dynamodbav:"IpAddress,omitempty"`
+	// archive of a shared folder, which is downloaded instead of the folder
+	ArchivePath string `json:"archivePath" dynamodbav:"ArchivePath,omitempty"`
+	// version of the object, to which a share is pinned, and the version of a file, which was processed last
+	VersionId string `json:"versionId" dynamodbav:"VersionId,omitempty"`
+	UploadId  string `json:"uploadId" dynamodbav:"UploadId,omitempty"`
+	// metadata of a file, which is recorded after its upload
+	ContentType string `json:"contentType" dynamodbav:"ContentType,omitempty"`
+	Sha256      string `json:"sha256" dynamodbav:"Sha256,omitempty"`
+	UploadedBy  string `json:"uploadedBy" dynamodbav:"UploadedBy,omitempty"`
+	ProcessedAt string `json:"processedAt" dynamodbav:"ProcessedAt,omitempty"`
+	ScanResult  string `json:"scanResult" dynamodbav:"ScanResult,omitempty"`
+	// bytes of pending uploads of a file, which are reserved in the usage of its owner until they are processed
+	ReservedBytes int64  `json:"-" dynamodbav:"ReservedBytes,omitempty"`
+	ReservedAt    string `json:"-" dynamodbav:"ReservedAt,omitempty"`
+	// thumbnail of an image or pdf, which is generated of the processed version of a file
+	PreviewPath string `json:"previewPath" dynamodbav:"PreviewPath,omitempty"`
+	// short-lived url of the preview of a shared file, which is only set in responses and never persisted
+	PreviewUrl string `json:"previewUrl,omitempty" dynamodbav:"-"`
+	// versions of a file, in which malware was found, are never shared
+	QuarantinedVersions []string `json:"-" dynamodbav:"QuarantinedVersions,stringset,omitempty"`
+	FileSize            int64    `json:"fileSize" dynamodbav:"FileSize,omitempty"`
+	PartSize            int64    `json:"partSize" dynamodbav:"PartSize,omitempty"`
+	PartCount           int32    `json:"partCount" dynamodbav:"PartCount,omitempty"`
+	Parts               []Part   `json:"parts" dynamodbav:"Parts,omitempty"`
+	// storage of a user, quota is only set if it differs from the quota of the user's role
+	Username  string `json:"username" dynamodbav:"Username,omitempty"`
+	UsedBytes int64  `json:"usedBytes" dynamodbav:"UsedBytes,omitempty"`
+	Quota     int64  `json:"quota" dynamodbav:"Quota,omitempty"`
+	UpdatedAt string `json:"updatedAt" dynamodbav:"UpdatedAt,omitempty"`
+	// token bucket of a rate limit, which is refilled since RefilledAt in epoch milliseconds
+	Tokens     float64 `json:"-" dynamodbav:"Tokens,omitempty"`
+	RefilledAt int64   `json:"-" dynamodbav:"RefilledAt,omitempty"`
+	// epoch seconds, after which the item is deleted by the ttl of the table
+	Ttl int64 `json:"-" dynamodbav:"TTL,omitempty"`
+	// form fields of a presigned post, which are only set in responses and never persisted
+	Fields map[string]string `json:"fields,omitempty" dynamodbav:"-"`
+}
+
+// Part is a single part of a multipart upload. Url is only set in responses and never persisted.
+type Part struct {
+	PartNumber int32  `json:"partNumber" dynamodbav:"PartNumber"`
+	ETag       string `json:"etag,omitempty" dynamodbav:"ETag,omitempty"`
+	Size       int64  `json:"size,omitempty" dynamodbav:"Size,omitempty"`
+	Url        string `json:"url,omitempty" dynamodbav:"-"`
 }
 
 type PostDownloadRequest struct {
-	Path     string `json:"path"`
-	Username string `json:"username"`
+	Path         string `json:"path"`
+	MaxDownloads int    `json:"maxDownloads"`
+	ExpiresIn    int    `json:"expiresIn"`
+	Passphrase   string `json:"passphrase"`
+	Notify       bool   `json:"notify"`
+	// version of the file to share, the current version is shared if it is empty
+	VersionId string `json:"versionId"`
+	// the share can be downloaded once, its file is deleted after the url expired if DeleteObject is set
+	OneTime      bool `json:"oneTime"`
+	DeleteObject bool `json:"deleteObject"`
+	// the url is valid from notBefore and for callers from ipAddress, if urls are signed for cloudfront
+	NotBefore string `json:"notBefore"`
+	IpAddress string `json:"ipAddress"`
+}
+
+// ContentRequest asks for the content of a share, which is streamed through the api instead of being downloaded
+// from its url. The conditions and the range are taken from the headers of the request.
+type ContentRequest struct {
+	AccessKey   string
+	Passphrase  string
+	IfNoneMatch string
+	IfRange     string
+	Range       string
+}
+
+type PostUploadRequest struct {
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType"`
+}
+
+// PutQuotaRequest sets the quota of a user in bytes, zero restores the quota of the user's role
+type PutQuotaRequest struct {
+	Quota int64 `json:"quota"`
+}
+
+type CompleteUploadRequest struct {
+	Parts []Part `json:"parts"`
 }
 
-func (u *Asset) InitNewUploadAsset(path, url string, expiringMinutes int) {
+func (u *Asset) InitNewUploadAsset(path, uploadId, username string, fileSize, partSize int64) {
 	currentUTCTime := GetCurrentUTCTime()
-	ulid := GetUlid(currentUTCTime)
 
-	u.PK = path
-	u.SK = ulid
+	u.PK = types.UPLOAD_PREFIX + uploadId
+	u.SK = types.TYPE_UPLOAD
+	u.Type = types.TYPE_UPLOAD
+	u.Path = path
 	u.Filename = filepath.Base(path)
-	u.Url = url
 	u.CreatedAt = currentUTCTime.Format(types.TIME_FORMAT)
-	u.ExpiringAt = GetExtendedTime(currentUTCTime, expiringMinutes).Format(types.TIME_FORMAT)
+	u.CreatedBy = username
+	u.State = types.STATE_IN_PROGRESS
+	u.UploadId = uploadId
+	u.FileSize = fileSize
+	u.PartSize = partSize
+	u.PartCount = int32((fileSize + partSize - 1) / partSize)
+	u.Parts = []Part{}
+}
+
+// InitNewPostAsset prepares the response of an upload by a single presigned post
+func (u *Asset) InitNewPostAsset(path, username, contentType string, fileSize int64, url string, fields map[string]string) {
+	u.Type = types.TYPE_UPLOAD
+	u.Path = path
+	u.Filename = filepath.Base(path)
+	u.CreatedAt = GetCurrentUTCTime().Format(types.TIME_FORMAT)
+	u.CreatedBy = username
+	u.State = types.STATE_IN_PROGRESS
+	u.ContentType = contentType
+	u.FileSize = fileSize
+	u.Url = url
+	u.Fields = fields
+}
+
+// InitNewUsageAsset prepares the storage usage of a user, who has not stored anything yet
+func (u *Asset) InitNewUsageAsset(username string) {
+	u.PK = types.USAGE_PREFIX + username
+	u.SK = types.TYPE_USAGE
+	u.Type = types.TYPE_USAGE
+	u.Username = username
 }
 
-func (u *Asset) InitNewDownloadAsset(path, url, username string, expiringMinutes int) {
+// InitNewRateAsset prepares the full token bucket of a rate limit, which is first taken from at given time
+func (u *Asset) InitNewRateAsset(key string, tokens float64, refilledAt time.Time) {
+	u.PK = types.RATE_PREFIX + key
+	u.SK = types.TYPE_RATE
+	u.Type = types.TYPE_RATE
+	u.Tokens = tokens
+	u.RefilledAt = refilledAt.UnixMilli()
+}
+
+// InitNewFileAsset prepares the record of a file, which is being uploaded to given path
+func (u *Asset) InitNewFileAsset(path, username string) {
+	u.PK = types.FILE_PREFIX + path
+	u.SK = types.TYPE_FILE
+	u.Type = types.TYPE_FILE
+	u.Path = path
+	u.Filename = filepath.Base(path)
+	u.CreatedAt = GetCurrentUTCTime().Format(types.TIME_FORMAT)
+	u.CreatedBy = username
+	u.State = types.STATE_UPLOADING
+}
+
+// returns the parts of the upload, which are not uploaded yet
+func (u *Asset) PendingParts() []Part {
+	uploaded := make(map[int32]bool, len(u.Parts))
+	for _, part := range u.Parts {
+		uploaded[part.PartNumber] = true
+	}
+	pending := []Part{}
+	for partNumber := int32(1); partNumber <= u.PartCount; partNumber++ {
+		if !uploaded[partNumber] {
+			pending = append(pending, Part{PartNumber: partNumber})
+		}
+	}
+	return pending
+}
+
+// InitNewDownloadAsset prepares a share keyed by given share id. The access key itself is not part of the item.
+func (u *Asset) InitNewDownloadAsset(shareId, path, url, username, passphraseHash string, expiringMinutes, maxDownloads int) {
 	currentUTCTime := GetCurrentUTCTime()
-	ulid := GetUlid(currentUTCTime)
 
-	u.PK = path
-	u.SK = ulid
-	u.AccessKey = hash(ulid)
+	u.PK = types.KEY_PREFIX + shareId
+	u.SK = types.TYPE_SHARE
+	u.Type = types.TYPE_SHARE
+	u.Path = path
 	u.Filename = filepath.Base(path)
 	u.Url = url
 	u.CreatedAt = currentUTCTime.Format(types.TIME_FORMAT)
 	u.CreatedBy = username
 	u.ExpiringAt = GetExtendedTime(currentUTCTime, expiringMinutes).Format(types.TIME_FORMAT)
-	u.AccessedAt = "INIT"
-	u.AccessedBy = "INIT"
+	u.MaxDownloads = maxDownloads
+	u.State = types.STATE_ACTIVE
+	u.PassphraseHash = passphraseHash
+}
+
+// InitArchive turns the share into a share of the folder at its path. The folder is downloaded as zip archive
+// at given path, which is prepared asynchronously.
+func (u *Asset) InitArchive(archivePath string) {
+	u.ArchivePath = archivePath
+	u.Filename = filepath.Base(strings.TrimSuffix(u.Path, "/")) + ".zip"
+	u.State = types.STATE_PREPARING
+}
+
+// IsFolder returns true, if the path of the asset is a folder
+func (u *Asset) IsFolder() bool {
+	return strings.HasSuffix(u.Path, "/")
+}
+
+// IsLocked returns true, if the share is locked after too many wrong passphrases
+func (u *Asset) IsLocked() bool {
+	if u.LockedUntil == "" {
+		return false
+	}
+	lockedUntil, err := time.Parse(types.TIME_FORMAT, u.LockedUntil)
+	if err != nil {
+		return false
+	}
+	return GetCurrentUTCTime().Before(lockedUntil)
+}
+
+// ExpiredAt returns the time, from which the item is not used anymore. Shares expire at their expiring time or
+// when they are revoked, downloads and uploads when they happen. Other items never expire.
+func (u *Asset) ExpiredAt() (time.Time, bool) {
+	var expiredAt string
+	switch u.Type {
+	case types.TYPE_SHARE:
+		expiredAt = u.ExpiringAt
+		if u.RevokedAt != "" && u.RevokedAt < u.ExpiringAt {
+			expiredAt = u.RevokedAt
+		}
+	case types.TYPE_ACCESS:
+		expiredAt = u.AccessedAt
+	case types.TYPE_UPLOAD:
+		expiredAt = u.CreatedAt
+	default:
+		return time.Time{}, false
+	}
+	t, err := time.Parse(types.TIME_FORMAT, expiredAt)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// ShareId returns the id of the share, which is the HMAC of the access key or the access key of legacy shares
+func (u *Asset) ShareId() string {
+	if !strings.HasPrefix(u.PK, types.KEY_PREFIX) {
+		return ""
+	}
+	return strings.TrimPrefix(u.PK, types.KEY_PREFIX)
+}
+
+// AccessId returns the id of an access, which is unique per download
+func (u *Asset) AccessId() string {
+	return strings.TrimPrefix(u.SK, types.ACCESS_PREFIX)
 }
 
-// generate hashed value based on given original url to be converted
-func hash(ulid string) string {
-	h := fnv.New64a()
-	h.Write([]byte(ulid))
-	return strconv.FormatUint(h.Sum64(), 10)
+// InitNewAccessAsset records a single download of given share
+func (u *Asset) InitNewAccessAsset(share *Asset, username string, accessedAt time.Time) {
+	u.PK = types.KEY_PREFIX + share.ShareId()
+	u.SK = types.ACCESS_PREFIX + GetUlid(accessedAt)
+	u.Type = types.TYPE_ACCESS
+	u.Path = share.Path
+	u.Filename = share.Filename
+	u.AccessedAt = accessedAt.Format(types.TIME_FORMAT)
+	u.AccessedBy = username
+	u.Notify = share.Notify
 }
 
 // get current location based utc time
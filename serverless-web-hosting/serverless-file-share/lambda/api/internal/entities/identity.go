@@ -0,0 +1,85 @@
+package entities
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/unitypark/serverless-file-share/lambda/api/types"
+)
+
+// header of the request, which carries the identity of the caller from the lambda handler to the fiber app.
+// The handler drops the header, if it is sent by a client.
+const IDENTITY_HEADER string = "X-FileShare-Identity"
+
+// Identity is the caller of the api, as verified by the authorizer
+type Identity struct {
+	Username string `json:"username"`
+	IsAdmin  bool   `json:"isAdmin"`
+}
+
+// Role returns the role of the user, which selects e.g. the upload policy
+func (i *Identity) Role() string {
+	if i.IsAdmin {
+		return types.ROLE_ADMIN
+	}
+	return types.ROLE_USER
+}
+
+// HomePath returns the folder of the bucket, which belongs to the user
+func (i *Identity) HomePath() string {
+	return types.USER_PREFIX + i.Username + "/"
+}
+
+// CanAccessPath returns true, if the user may upload or share given path. Admins may access the whole bucket.
+func (i *Identity) CanAccessPath(path string) bool {
+	if i.IsAdmin {
+		return true
+	}
+	if len(i.Username) == 0 || strings.Contains(i.Username, "/") || !strings.HasPrefix(path, i.HomePath()) {
+		return false
+	}
+	// the path must not climb out of the home folder
+	return !strings.Contains("/"+path+"/", "/../")
+}
+
+// PathOwner returns the user, whose home folder contains given path, or an empty name, if the path is not in a
+// home folder
+func PathOwner(path string) string {
+	if !strings.HasPrefix(path, types.USER_PREFIX) {
+		return ""
+	}
+	username, _, found := strings.Cut(strings.TrimPrefix(path, types.USER_PREFIX), "/")
+	if !found || username == "" || username == ".." || username == "." {
+		return ""
+	}
+	return username
+}
+
+// Encode returns the identity as value of the identity header. It is base64 encoded, because the values of
+// headers are split at commas by the adapter.
+func (i *Identity) Encode() string {
+	value, _ := json.Marshal(i)
+	return base64.RawURLEncoding.EncodeToString(value)
+}
+
+// DecodeIdentity returns the identity of given value of the identity header
+func DecodeIdentity(value string) (*Identity, error) {
+	if len(value) == 0 {
+		return nil, errors.New("identity is missing")
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("identity is malformed")
+	}
+	identity := new(Identity)
+	err = json.Unmarshal(raw, identity)
+	if err != nil {
+		return nil, errors.New("identity is malformed")
+	}
+	if len(identity.Username) == 0 {
+		return nil, errors.New("username is missing in identity")
+	}
+	return identity, nil
+}
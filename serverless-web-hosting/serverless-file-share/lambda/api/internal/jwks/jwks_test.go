@@ -0,0 +1,268 @@
+package jwks
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+)
+
+// fakeJwks serves the public keys of its key ids like the jwks endpoint of a user pool
+type fakeJwks struct {
+	server  *httptest.Server
+	fetches int32
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	status  int
+	// the fetch blocks until it is closed, if it is set
+	release chan struct{}
+}
+
+func newFakeJwks(t *testing.T, kids ...string) *fakeJwks {
+	t.Helper()
+	fake := &fakeJwks{keys: map[string]*rsa.PublicKey{}, status: http.StatusOK}
+	fake.rotate(t, kids...)
+	fake.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fake.fetches, 1)
+		fake.mu.Lock()
+		status, release, set := fake.status, fake.release, fake.set()
+		fake.mu.Unlock()
+		if release != nil {
+			<-release
+		}
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(fake.server.Close)
+	return fake
+}
+
+// replaces the keys by new keys of given key ids
+func (f *fakeJwks) rotate(t *testing.T, kids ...string) {
+	t.Helper()
+	keys := map[string]*rsa.PublicKey{}
+	for _, kid := range kids {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		keys[kid] = &key.PublicKey
+	}
+	f.mu.Lock()
+	f.keys = keys
+	f.mu.Unlock()
+}
+
+func (f *fakeJwks) setStatus(status int) {
+	f.mu.Lock()
+	f.status = status
+	f.mu.Unlock()
+}
+
+func (f *fakeJwks) set() map[string]interface{} {
+	keys := []map[string]string{}
+	for kid, key := range f.keys {
+		keys = append(keys, map[string]string{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": kid,
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+func (f *fakeJwks) key(kid string) *rsa.PublicKey {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.keys[kid]
+}
+
+func (f *fakeJwks) fetched() int {
+	return int(atomic.LoadInt32(&f.fetches))
+}
+
+func assertKey(t *testing.T, c *Cache, kid string, want *rsa.PublicKey) {
+	t.Helper()
+	got, err := c.PublicKey(kid)
+	if err != nil {
+		t.Fatalf("unexpected error for key %s: %v", kid, err)
+	}
+	key, ok := got.(*rsa.PublicKey)
+	if !ok || key.N.Cmp(want.N) != 0 || key.E != want.E {
+		t.Fatalf("got key %v for %s, want %v", got, kid, want)
+	}
+}
+
+func TestPublicKeyIsCached(t *testing.T) {
+	fake := newFakeJwks(t, "key-1", "key-2")
+	c := New(fake.server.URL, time.Hour, time.Minute)
+
+	assertKey(t, c, "key-1", fake.key("key-1"))
+	assertKey(t, c, "key-2", fake.key("key-2"))
+	assertKey(t, c, "key-1", fake.key("key-1"))
+	if fake.fetched() != 1 {
+		t.Errorf("keys are fetched %d times, want once", fake.fetched())
+	}
+}
+
+func TestPublicKeyIsFetchedAfterTtl(t *testing.T) {
+	fake := newFakeJwks(t, "key-1")
+	c := New(fake.server.URL, time.Hour, time.Minute)
+	assertKey(t, c, "key-1", fake.key("key-1"))
+
+	fake.rotate(t, "key-1")
+	c.fetchedAt = c.fetchedAt.Add(-time.Hour)
+	c.attemptedAt = c.attemptedAt.Add(-time.Hour)
+	assertKey(t, c, "key-1", fake.key("key-1"))
+	if fake.fetched() != 2 {
+		t.Errorf("keys are fetched %d times, want twice", fake.fetched())
+	}
+}
+
+func TestPublicKeyOfUnknownKidIsFetched(t *testing.T) {
+	fake := newFakeJwks(t, "key-1")
+	c := New(fake.server.URL, time.Hour, 0)
+	assertKey(t, c, "key-1", fake.key("key-1"))
+
+	// the keys are rotated
+	fake.rotate(t, "key-2")
+	assertKey(t, c, "key-2", fake.key("key-2"))
+
+	_, err := c.PublicKey("key-3")
+	if !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrKeyNotFound)
+	}
+	if fake.fetched() != 3 {
+		t.Errorf("keys are fetched %d times, want 3 times", fake.fetched())
+	}
+}
+
+func TestPublicKeyOfUnknownKidIsThrottled(t *testing.T) {
+	fake := newFakeJwks(t, "key-1")
+	c := New(fake.server.URL, time.Hour, time.Minute)
+	assertKey(t, c, "key-1", fake.key("key-1"))
+
+	for i := 0; i < 10; i++ {
+		_, err := c.PublicKey("unknown")
+		if !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("got error %v, want %v", err, ErrKeyNotFound)
+		}
+	}
+	// the keys were fetched within the interval
+	if fake.fetched() != 1 {
+		t.Errorf("keys are fetched %d times, want once", fake.fetched())
+	}
+	// after the interval, the keys are fetched again
+	fake.rotate(t, "unknown")
+	c.attemptedAt = c.attemptedAt.Add(-time.Minute)
+	assertKey(t, c, "unknown", fake.key("unknown"))
+}
+
+func TestPublicKeyIsStaleOnError(t *testing.T) {
+	fake := newFakeJwks(t, "key-1")
+	c := New(fake.server.URL, time.Hour, time.Minute)
+	want := fake.key("key-1")
+	assertKey(t, c, "key-1", want)
+
+	fake.setStatus(http.StatusInternalServerError)
+	fake.rotate(t, "key-1")
+	c.fetchedAt = c.fetchedAt.Add(-time.Hour)
+	c.attemptedAt = c.attemptedAt.Add(-time.Hour)
+	assertKey(t, c, "key-1", want)
+	if fake.fetched() != 2 {
+		t.Errorf("keys are fetched %d times, want twice", fake.fetched())
+	}
+}
+
+func TestPublicKeyReturnsFetchErrorWithoutKeys(t *testing.T) {
+	fake := newFakeJwks(t, "key-1")
+	fake.setStatus(http.StatusInternalServerError)
+	c := New(fake.server.URL, time.Hour, time.Minute)
+
+	for i := 0; i < 5; i++ {
+		_, err := c.PublicKey("key-1")
+		if err == nil || errors.Is(err, ErrKeyNotFound) || !strings.Contains(err.Error(), "status 500") {
+			t.Fatalf("got error %v, want the error of the fetch", err)
+		}
+	}
+	// the first fetch is not throttled, the fetches after a failure are
+	if fake.fetched() != 1 {
+		t.Errorf("keys are fetched %d times, want once", fake.fetched())
+	}
+	// after the interval, the keys are fetched again
+	fake.setStatus(http.StatusOK)
+	c.attemptedAt = c.attemptedAt.Add(-time.Minute)
+	assertKey(t, c, "key-1", fake.key("key-1"))
+	if fake.fetched() != 2 {
+		t.Errorf("keys are fetched %d times, want twice", fake.fetched())
+	}
+}
+
+func TestPublicKeyIsFetchedOnceConcurrently(t *testing.T) {
+	fake := newFakeJwks(t, "key-1")
+	fake.release = make(chan struct{})
+	c := New(fake.server.URL, time.Hour, time.Minute)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.PublicKey("key-1")
+			errs <- err
+		}()
+	}
+	// the lock is not held while the keys are fetched
+	for fake.fetched() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	c.mu.Lock()
+	fetching := c.fetching != nil
+	c.mu.Unlock()
+	if !fetching {
+		t.Errorf("fetch is not running")
+	}
+	close(fake.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if fake.fetched() != 1 {
+		t.Errorf("keys are fetched %d times, want once", fake.fetched())
+	}
+}
+
+func TestKeyfuncRequiresKid(t *testing.T) {
+	fake := newFakeJwks(t, "key-1")
+	c := New(fake.server.URL, time.Hour, time.Minute)
+
+	_, err := c.Keyfunc(&jwt.Token{Header: map[string]interface{}{"alg": "RS256"}})
+	if err == nil {
+		t.Errorf("token without kid is accepted")
+	}
+	if fake.fetched() != 0 {
+		t.Errorf("keys are fetched for a token without kid")
+	}
+}
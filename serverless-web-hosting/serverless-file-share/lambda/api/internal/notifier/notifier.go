@@ -0,0 +1,94 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/secret"
+	"go.uber.org/zap"
+)
+
+// timeout of a single delivery, failed deliveries are retried by the table stream
+const DELIVERY_TIMEOUT time.Duration = 10 * time.Second
+
+// Notification tells the owner of a share, that the share is downloaded
+type Notification struct {
+	// Id is unique per download, receivers can drop retried deliveries by it
+	Id            string `json:"id"`
+	ShareId       string `json:"shareId"`
+	Owner         string `json:"owner"`
+	Path          string `json:"path"`
+	Filename      string `json:"filename"`
+	AccessedBy    string `json:"accessedBy"`
+	AccessedAt    string `json:"accessedAt"`
+	DownloadCount int    `json:"downloadCount"`
+	MaxDownloads  int    `json:"maxDownloads"`
+}
+
+// Notifier delivers notifications to the owners of shares
+type Notifier interface {
+	Notify(notification *Notification) error
+}
+
+// New returns the notifiers, which are configured. Nothing is delivered if none is configured. The password of
+// the smtp server and the secret of the webhook are read from secrets manager, if they are not set in the env.
+func New(config *appConfig.Config) Notifier {
+	notifiers := multiNotifier{}
+	if config.SmtpHost != "" {
+		zap.L().Info("notifying by email", zap.String("host", config.SmtpHost))
+		password, err := secret.Resolve(context.TODO(), config.SmtpPassword, config.SmtpPasswordSecretName)
+		if err != nil {
+			zap.L().Panic("failed to read smtp password", zap.Error(err))
+		}
+		notifiers = append(notifiers, NewSmtpNotifier(config.SmtpHost, config.SmtpPort, config.SmtpUsername, password, config.SmtpFrom))
+	}
+	if config.WebhookUrl != "" {
+		zap.L().Info("notifying by webhook", zap.String("url", config.WebhookUrl))
+		webhookSecret, err := secret.Resolve(context.TODO(), config.WebhookSecret, config.WebhookSecretName)
+		if err != nil {
+			zap.L().Panic("failed to read webhook secret", zap.Error(err))
+		}
+		if webhookSecret == "" {
+			zap.L().Panic(fmt.Sprintf("%s or %s must be set", appConfig.ENV_WEBHOOK_SECRET, appConfig.ENV_WEBHOOK_SECRET_NAME))
+		}
+		notifiers = append(notifiers, NewWebhookNotifier(config.WebhookUrl, webhookSecret))
+	}
+	if len(notifiers) == 0 {
+		zap.L().Warn("no notifier is configured, notifications are dropped")
+	}
+	return notifiers
+}
+
+// multiNotifier delivers every notification by all of its notifiers. If one of them fails, the notification is
+// retried by the table stream and delivered again by all of them, also by those, which delivered it before.
+// Receivers drop these duplicates by the id of the notification, which is part of the Message-ID of the email
+// and the X-FileShare-Event-Id of the webhook.
+type multiNotifier []Notifier
+
+func (n multiNotifier) Notify(notification *Notification) error {
+	errs := []string{}
+	for _, notifier := range n {
+		err := notifier.Notify(notification)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// returns the text of the notification, which is sent by email
+func (n *Notification) text() string {
+	downloads := fmt.Sprintf("%d", n.DownloadCount)
+	if n.MaxDownloads > 0 {
+		downloads = fmt.Sprintf("%d of %d", n.DownloadCount, n.MaxDownloads)
+	}
+	return fmt.Sprintf("Your shared file %s was downloaded by %s at %s.\r\n\r\nPath: %s\r\nShare: %s\r\nDownloads: %s\r\n",
+		n.Filename, n.AccessedBy, n.AccessedAt, n.Path, n.ShareId, downloads)
+}
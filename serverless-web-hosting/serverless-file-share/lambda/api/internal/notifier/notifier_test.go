@@ -0,0 +1,52 @@
+package notifier
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type recordingNotifier struct {
+	err       error
+	delivered []string
+}
+
+func (n *recordingNotifier) Notify(notification *Notification) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.delivered = append(n.delivered, notification.Id)
+	return nil
+}
+
+func TestMultiNotifierDeliversByAllNotifiers(t *testing.T) {
+	var (
+		email   = &recordingNotifier{}
+		webhook = &recordingNotifier{err: errors.New("webhook answered with status 503")}
+		n       = multiNotifier{email, webhook}
+	)
+	notification := testNotification()
+
+	err := n.Notify(notification)
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("got error %v, want the error of the webhook", err)
+	}
+	// the retry delivers the email again, receivers drop it by the id of the notification
+	webhook.err = nil
+	err = n.Notify(notification)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(email.delivered) != 2 || email.delivered[0] != notification.Id || email.delivered[1] != notification.Id {
+		t.Errorf("got email deliveries %v, want the same id twice", email.delivered)
+	}
+	if len(webhook.delivered) != 1 {
+		t.Errorf("got webhook deliveries %v, want one", webhook.delivered)
+	}
+}
+
+func TestMultiNotifierWithoutNotifiers(t *testing.T) {
+	if err := (multiNotifier{}).Notify(testNotification()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package notifier
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type smtpNotifier struct {
+	address  string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+// NewSmtpNotifier sends the notifications by email to the owners of the shares, whose usernames are their emails.
+// The connection is upgraded with STARTTLS, if the server supports it. Credentials are only sent over TLS.
+func NewSmtpNotifier(host string, port int, username, password, from string) Notifier {
+	return &smtpNotifier{
+		address:  net.JoinHostPort(host, strconv.Itoa(port)),
+		host:     host,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+func (n *smtpNotifier) Notify(notification *Notification) error {
+	if !strings.Contains(notification.Owner, "@") || strings.ContainsAny(notification.Owner, "\r\n") {
+		return fmt.Errorf("owner %s has no email address", notification.Owner)
+	}
+	err := n.send(notification.Owner, n.message(notification))
+	if err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+	return nil
+}
+
+func (n *smtpNotifier) send(to string, message []byte) error {
+	conn, err := net.DialTimeout("tcp", n.address, DELIVERY_TIMEOUT)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(DELIVERY_TIMEOUT))
+	client, err := smtp.NewClient(conn, n.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: n.host})
+		if err != nil {
+			return err
+		}
+	}
+	if n.username != "" {
+		// PlainAuth refuses to send credentials without TLS, except to localhost
+		err = client.Auth(smtp.PlainAuth("", n.username, n.password, n.host))
+		if err != nil {
+			return err
+		}
+	}
+	err = client.Mail(n.from)
+	if err != nil {
+		return err
+	}
+	err = client.Rcpt(to)
+	if err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(message)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (n *smtpNotifier) message(notification *Notification) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", n.from)
+	fmt.Fprintf(&b, "To: %s\r\n", notification.Owner)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", notification.Filename+" was downloaded"))
+	fmt.Fprintf(&b, "Message-ID: <%s@%s>\r\n", notification.Id, n.host)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(notification.text())
+	return b.Bytes()
+}
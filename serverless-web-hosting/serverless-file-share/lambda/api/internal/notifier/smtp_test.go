@@ -0,0 +1,239 @@
+package notifier
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSmtp is a smtp server without TLS, which records the commands of its clients. Replies override the
+// reply to the commands of their verbs.
+type fakeSmtp struct {
+	listener   net.Listener
+	extensions []string
+	replies    map[string]string
+	mu         sync.Mutex
+	commands   []string
+	data       string
+	done       chan struct{}
+}
+
+func newFakeSmtp(t *testing.T, replies map[string]string, extensions ...string) *fakeSmtp {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	server := &fakeSmtp{listener: listener, extensions: extensions, replies: replies, done: make(chan struct{})}
+	t.Cleanup(func() { listener.Close() })
+	go server.serve()
+	return server
+}
+
+// returns a notifier, which connects to the fake server under the name of host. PlainAuth only sends
+// credentials without TLS to localhost.
+func (s *fakeSmtp) notifier(host, username, password string) *smtpNotifier {
+	return &smtpNotifier{
+		address:  s.listener.Addr().String(),
+		host:     host,
+		username: username,
+		password: password,
+		from:     "fileshare@example.com",
+	}
+}
+
+func (s *fakeSmtp) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer close(s.done)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(lines ...string) {
+		conn.Write([]byte(strings.Join(lines, "\r\n") + "\r\n"))
+	}
+	reply("220 smtp.example.com ESMTP fake")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		if override, ok := s.replies[verb]; ok {
+			reply(override)
+			continue
+		}
+		switch verb {
+		case "EHLO":
+			lines := []string{"250-smtp.example.com"}
+			for _, extension := range s.extensions {
+				lines = append(lines, "250-"+extension)
+			}
+			lines = append(lines, "250 8BITMIME")
+			reply(lines...)
+		case "HELO", "MAIL", "RCPT", "RSET", "NOOP":
+			reply("250 OK")
+		case "STARTTLS":
+			reply("454 TLS not available")
+		case "AUTH":
+			reply("235 Authentication successful")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 OK queued")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// returns the commands received until the client disconnected
+func (s *fakeSmtp) received() ([]string, string) {
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.commands, s.data
+}
+
+func hasCommand(commands []string, verb string) bool {
+	for _, command := range commands {
+		if strings.HasPrefix(strings.ToUpper(command), strings.ToUpper(verb)) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSmtpNotifierNotify(t *testing.T) {
+	tests := []struct {
+		name               string
+		host               string
+		username, password string
+		extensions         []string
+		replies            map[string]string
+		// the delivery fails with an error containing this message, if it is set
+		wantMessage string
+		// commands, which must be sent or must not be sent
+		wantCommands    []string
+		notWantCommands []string
+	}{
+		{
+			name:            "without STARTTLS support",
+			host:            "smtp.example.com",
+			wantCommands:    []string{"MAIL FROM:<fileshare@example.com>", "RCPT TO:<owner@example.com>", "DATA", "QUIT"},
+			notWantCommands: []string{"STARTTLS", "AUTH"},
+		},
+		{
+			name:            "credentials without TLS",
+			host:            "smtp.example.com",
+			username:        "user",
+			password:        "password",
+			extensions:      []string{"AUTH PLAIN LOGIN"},
+			wantMessage:     "unencrypted connection",
+			notWantCommands: []string{"AUTH", "MAIL"},
+		},
+		{
+			name:            "authentication failure",
+			host:            "localhost",
+			username:        "user",
+			password:        "wrong",
+			extensions:      []string{"AUTH PLAIN LOGIN"},
+			replies:         map[string]string{"AUTH": "535 5.7.8 Authentication credentials invalid"},
+			wantMessage:     "535",
+			wantCommands:    []string{"AUTH PLAIN"},
+			notWantCommands: []string{"MAIL", "DATA"},
+		},
+		{
+			name:            "sender rejected",
+			host:            "smtp.example.com",
+			replies:         map[string]string{"MAIL": "553 5.7.1 Sender address rejected"},
+			wantMessage:     "553",
+			notWantCommands: []string{"RCPT", "DATA"},
+		},
+		{
+			name:            "recipient rejected",
+			host:            "smtp.example.com",
+			replies:         map[string]string{"RCPT": "550 5.1.1 Mailbox unavailable"},
+			wantMessage:     "550",
+			wantCommands:    []string{"MAIL FROM:<fileshare@example.com>"},
+			notWantCommands: []string{"DATA"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeSmtp(t, tt.replies, tt.extensions...)
+			notification := testNotification()
+
+			err := server.notifier(tt.host, tt.username, tt.password).Notify(notification)
+			commands, data := server.received()
+			for _, want := range tt.wantCommands {
+				if !hasCommand(commands, want) {
+					t.Errorf("command %s is missing: %v", want, commands)
+				}
+			}
+			for _, notWant := range tt.notWantCommands {
+				if hasCommand(commands, notWant) {
+					t.Errorf("command %s is sent: %v", notWant, commands)
+				}
+			}
+			if tt.host != "localhost" {
+				for _, command := range commands {
+					if strings.Contains(command, "cGFzc3dvcmQ") {
+						t.Errorf("password is sent without TLS: %s", command)
+					}
+				}
+			}
+			if tt.wantMessage != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantMessage) {
+					t.Fatalf("got error %v, want error containing %q", err, tt.wantMessage)
+				}
+				if data != "" {
+					t.Errorf("email is sent after failure: %v", commands)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, want := range []string{"To: owner@example.com\r\n", "Message-ID: <" + notification.Id + "@" + tt.host + ">\r\n", "report.pdf was downloaded by reader@example.com"} {
+				if !strings.Contains(data, want) {
+					t.Errorf("message does not contain %q:\n%s", want, data)
+				}
+			}
+		})
+	}
+}
+
+func TestSmtpNotifierRejectsOwnerWithoutEmail(t *testing.T) {
+	notifier := NewSmtpNotifier("smtp.example.com", 587, "", "", "fileshare@example.com")
+	for _, owner := range []string{"owner", "owner@example.com\r\nBcc: other@example.com"} {
+		notification := testNotification()
+		notification.Owner = owner
+		if err := notifier.Notify(notification); err == nil {
+			t.Errorf("notification is sent to %q", owner)
+		}
+	}
+}
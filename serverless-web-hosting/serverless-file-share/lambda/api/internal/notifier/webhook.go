@@ -0,0 +1,71 @@
+package notifier
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// headers of a webhook delivery. The signature is the hex encoded HMAC-SHA256 of "<timestamp>.<body>",
+// so that receivers can verify the sender and reject replayed deliveries.
+const (
+	HEADER_EVENT_ID  string = "X-FileShare-Event-Id"
+	HEADER_TIMESTAMP string = "X-FileShare-Timestamp"
+	HEADER_SIGNATURE string = "X-FileShare-Signature"
+)
+
+type webhookNotifier struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+// NewWebhookNotifier posts the notifications as json to the url, signed with the secret
+func NewWebhookNotifier(url, secret string) Notifier {
+	return &webhookNotifier{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: DELIVERY_TIMEOUT},
+	}
+}
+
+func (n *webhookNotifier) Notify(notification *Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HEADER_EVENT_ID, notification.Id)
+	req.Header.Set(HEADER_TIMESTAMP, timestamp)
+	req.Header.Set(HEADER_SIGNATURE, "sha256="+Sign(n.secret, timestamp, body))
+	res, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %v", err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered with status %d", res.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the signature of a webhook delivery
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,149 @@
+package notifier
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testWebhookSecret = "test-webhook-secret"
+
+func testNotification() *Notification {
+	return &Notification{
+		Id:            "01H0000000000000000000000",
+		ShareId:       "share-id",
+		Owner:         "owner@example.com",
+		Path:          "users/owner@example.com/report.pdf",
+		Filename:      "report.pdf",
+		AccessedBy:    "reader@example.com",
+		AccessedAt:    "2023-05-01T10:00:00Z",
+		DownloadCount: 2,
+		MaxDownloads:  10,
+	}
+}
+
+func TestWebhookNotifierSignsDelivery(t *testing.T) {
+	received := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read body: %v", err)
+		}
+		received <- r
+		bodies <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	notification := testNotification()
+	err := NewWebhookNotifier(server.URL, testWebhookSecret).Notify(notification)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r, body := <-received, <-bodies
+
+	if r.Method != http.MethodPost {
+		t.Errorf("got method %s, want POST", r.Method)
+	}
+	if got := r.Header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("got content type %s, want application/json", got)
+	}
+	if got := r.Header.Get(HEADER_EVENT_ID); got != notification.Id {
+		t.Errorf("got event id %s, want %s", got, notification.Id)
+	}
+	// the receiver verifies the signature with the shared secret, as documented for webhooks
+	timestamp := r.Header.Get(HEADER_TIMESTAMP)
+	if timestamp == "" {
+		t.Fatalf("timestamp header is missing")
+	}
+	signature := strings.TrimPrefix(r.Header.Get(HEADER_SIGNATURE), "sha256=")
+	if want := Sign([]byte(testWebhookSecret), timestamp, body); !hmac.Equal([]byte(signature), []byte(want)) {
+		t.Errorf("got signature %s, want %s", signature, want)
+	}
+	if wrong := Sign([]byte("other-secret"), timestamp, body); hmac.Equal([]byte(signature), []byte(wrong)) {
+		t.Errorf("signature is valid for another secret")
+	}
+	delivered := new(Notification)
+	if err := json.Unmarshal(body, delivered); err != nil {
+		t.Fatalf("body is not a notification: %v", err)
+	}
+	if *delivered != *notification {
+		t.Errorf("got notification %+v, want %+v", *delivered, *notification)
+	}
+}
+
+func TestWebhookNotifierFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		// the delivery fails with an error containing this message
+		wantMessage string
+	}{
+		{
+			name:        "service unavailable",
+			handler:     func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusServiceUnavailable) },
+			wantMessage: "status 503",
+		},
+		{
+			name:        "not found",
+			handler:     func(w http.ResponseWriter, r *http.Request) { http.NotFound(w, r) },
+			wantMessage: "status 404",
+		},
+		{
+			name:        "unauthorized",
+			handler:     func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusUnauthorized) },
+			wantMessage: "status 401",
+		},
+		{
+			name: "redirect to error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/moved" {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				http.Redirect(w, r, "/moved", http.StatusTemporaryRedirect)
+			},
+			wantMessage: "status 500",
+		},
+		{
+			name: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				// the connection is only watched for closing, after the body is read
+				io.Copy(io.Discard, r.Body)
+				// the client gives up and closes the connection
+				<-r.Context().Done()
+			},
+			wantMessage: "failed to call webhook",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+			notifier := NewWebhookNotifier(server.URL, testWebhookSecret).(*webhookNotifier)
+			notifier.client.Timeout = 200 * time.Millisecond
+
+			err := notifier.Notify(testNotification())
+			if err == nil || !strings.Contains(err.Error(), tt.wantMessage) {
+				t.Errorf("got error %v, want error containing %q", err, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	// printf '1700000000.{}' | openssl dgst -sha256 -hmac secret
+	want := "b8569b78799ff9e3cbff0fc2d63a33a2b57f3282abd07c37ae5e8e7d79a5f163"
+	if got := Sign([]byte("secret"), "1700000000", []byte("{}")); got != want {
+		t.Errorf("got signature %s, want %s", got, want)
+	}
+	if Sign([]byte("secret"), "1700000000", []byte("{}")) == Sign([]byte("secret"), "1700000001", []byte("{}")) {
+		t.Errorf("signature does not cover the timestamp")
+	}
+}
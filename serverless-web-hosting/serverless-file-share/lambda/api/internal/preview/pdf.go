@@ -0,0 +1,62 @@
+package preview
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var (
+	pdfStream = regexp.MustCompile(`(?s)\d\s+obj\b(.*?)\bstream\r?\n`)
+	pdfObject = regexp.MustCompile(`\d\s+obj\b`)
+	pdfLength = regexp.MustCompile(`/Length\s+(\d+)(\s+\d+\s+R)?`)
+	pdfImage  = regexp.MustCompile(`/Subtype\s*/Image\b`)
+	// jpeg streams without any other filter are decoded as they are
+	pdfJpeg = regexp.MustCompile(`/Filter\s*(/DCTDecode\b|\[\s*/DCTDecode\s*\])`)
+)
+
+// returns the first jpeg image of a pdf in the order of the document. Images in compressed object streams
+// and images of other encodings are not found.
+func firstPdfImage(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return nil, fmt.Errorf("%w: file is not a pdf", ErrUnsupported)
+	}
+	for offset := 0; offset < len(data); {
+		match := pdfStream.FindSubmatchIndex(data[offset:])
+		if match == nil {
+			break
+		}
+		// objects without stream are skipped, the dictionary of the stream follows the last object header
+		dict := data[offset+match[2] : offset+match[3]]
+		if headers := pdfObject.FindAllIndex(dict, -1); len(headers) > 0 {
+			dict = dict[headers[len(headers)-1][1]:]
+		}
+		start := offset + match[1]
+		end := streamEnd(data, start, dict)
+		if end < 0 {
+			break
+		}
+		if pdfImage.Match(dict) && pdfJpeg.Match(dict) {
+			return data[start:end], nil
+		}
+		offset = end
+	}
+	return nil, fmt.Errorf("%w: pdf has no jpeg image", ErrUnsupported)
+}
+
+// returns the end of the stream, which starts at given offset. The length is taken from the dictionary of
+// the stream, if it is given directly, otherwise the stream ends at the next endstream.
+func streamEnd(data []byte, start int, dict []byte) int {
+	if match := pdfLength.FindSubmatch(dict); match != nil && len(match[2]) == 0 {
+		length, err := strconv.Atoi(string(match[1]))
+		if err == nil && length >= 0 && start+length <= len(data) {
+			return start + length
+		}
+	}
+	end := bytes.Index(data[start:], []byte("endstream"))
+	if end < 0 {
+		return -1
+	}
+	return start + end
+}
@@ -0,0 +1,150 @@
+package preview
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"strings"
+)
+
+// content type of the previews, which are encoded as jpeg regardless of the type of their file
+const CONTENT_TYPE string = "image/jpeg"
+
+// limits of the generation of previews
+const (
+	// longest edge of a preview, smaller images are not scaled up
+	MAX_EDGE_IN_PIXELS int = 256
+	// larger files are not read, so that the processor does not run out of memory
+	MAX_SOURCE_SIZE_IN_BYTES int64 = 32 * 1024 * 1024
+	// images are not decoded, if their header declares more pixels, which protects against decompression bombs
+	MAX_SOURCE_PIXELS int = 50 * 1000 * 1000
+	JPEG_QUALITY      int = 80
+)
+
+var (
+	// ErrUnsupported is returned, if no preview can be generated of the content type or content of a file
+	ErrUnsupported = errors.New("preview is not supported")
+	// ErrTooLarge is returned, if the file or its image exceeds the limits of the generation
+	ErrTooLarge = errors.New("file is too large for a preview")
+)
+
+// Supports returns true, if a preview may be generated of files of given content type
+func Supports(contentType string) bool {
+	switch mediaType(contentType) {
+	case "image/jpeg", "image/png", "image/gif", "application/pdf":
+		return true
+	}
+	return false
+}
+
+// Generate returns the preview of a file with given content type as jpeg. Images are decoded by the decoders
+// of the standard library. PDFs are not rendered, their preview is the first jpeg image embedded in the
+// document, which is the first page of scanned documents.
+func Generate(r io.Reader, contentType string) ([]byte, error) {
+	if !Supports(contentType) {
+		return nil, fmt.Errorf("%w: content type %s", ErrUnsupported, contentType)
+	}
+	data, err := io.ReadAll(io.LimitReader(r, MAX_SOURCE_SIZE_IN_BYTES+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > MAX_SOURCE_SIZE_IN_BYTES {
+		return nil, fmt.Errorf("%w: file has more than %d bytes", ErrTooLarge, MAX_SOURCE_SIZE_IN_BYTES)
+	}
+	if mediaType(contentType) == "application/pdf" {
+		data, err = firstPdfImage(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	img, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	out := new(bytes.Buffer)
+	err = jpeg.Encode(out, thumbnail(img, MAX_EDGE_IN_PIXELS), &jpeg.Options{Quality: JPEG_QUALITY})
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// decodes an image, whose dimensions are checked before its pixels are decoded
+func decode(data []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, fmt.Errorf("%w: image is empty", ErrUnsupported)
+	}
+	if config.Width > MAX_SOURCE_PIXELS/config.Height {
+		return nil, fmt.Errorf("%w: image has %dx%d pixels", ErrTooLarge, config.Width, config.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	return img, nil
+}
+
+// scales the image down, so that its longest edge has at most maxEdge pixels. Every pixel of the thumbnail
+// is the average of the pixels of the image, which it covers. Transparent pixels are drawn on white.
+func thumbnail(img image.Image, maxEdge int) image.Image {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	width, height := srcWidth, srcHeight
+	if width > maxEdge || height > maxEdge {
+		if width >= height {
+			width, height = maxEdge, max(1, srcHeight*maxEdge/srcWidth)
+		} else {
+			width, height = max(1, srcWidth*maxEdge/srcHeight), maxEdge
+		}
+	}
+	src := image.NewRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+	draw.Draw(src, src.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Over)
+	if width == srcWidth && height == srcHeight {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*srcHeight/height, max((y+1)*srcHeight/height, y*srcHeight/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*srcWidth/width, max((x+1)*srcWidth/width, x*srcWidth/width+1)
+			var r, g, b, n int
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(x0, sy)
+				for sx := x0; sx < x1; sx++ {
+					r += int(src.Pix[offset])
+					g += int(src.Pix[offset+1])
+					b += int(src.Pix[offset+2])
+					offset += 4
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: 0xff})
+		}
+	}
+	return dst
+}
+
+func mediaType(contentType string) string {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
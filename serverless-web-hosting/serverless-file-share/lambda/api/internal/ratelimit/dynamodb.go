@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/repository"
+)
+
+// a bucket, which is changed by concurrent requests while it is taken from, is read again this many times
+const MAX_CONFLICT_RETRIES int = 3
+
+// dynamoDbLimiter keeps the buckets in the table. A bucket is read and written back with the refill time, which
+// was read, as condition, so that concurrent requests cannot take the same token.
+type dynamoDbLimiter struct {
+	repository repository.DynamoDbRepository
+}
+
+func NewDynamoDbLimiter(r repository.DynamoDbRepository) Limiter {
+	return &dynamoDbLimiter{repository: r}
+}
+
+func (l *dynamoDbLimiter) Take(key string, limit appConfig.RateLimit) (time.Duration, error) {
+	if !limit.Enabled() {
+		return 0, nil
+	}
+	for attempt := 0; attempt <= MAX_CONFLICT_RETRIES; attempt++ {
+		now := time.Now()
+		b := newBucket(limit, now)
+		var previousRefilledAt int64
+		item, err := l.repository.GetRateBucket(key)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return 0, err
+		}
+		if item != nil {
+			b.tokens = item.Tokens
+			b.refilledAt = time.UnixMilli(item.RefilledAt)
+			previousRefilledAt = item.RefilledAt
+		}
+		// a throttled request does not change the bucket, because its refill is computed again by the next request
+		retryAfter := b.take(limit, now)
+		if retryAfter > 0 {
+			return retryAfter, nil
+		}
+		// the refill time changes with every write, so that concurrent writes within a millisecond conflict as well
+		refilledAt := b.refilledAt.UnixMilli()
+		if refilledAt <= previousRefilledAt {
+			refilledAt = previousRefilledAt + 1
+		}
+		bucketItem := new(entities.Asset)
+		bucketItem.InitNewRateAsset(key, b.tokens, time.UnixMilli(refilledAt))
+		// buckets are deleted by the ttl of the table after they are full again
+		bucketItem.Ttl = b.fullAt(limit).Add(time.Minute).Unix()
+		err = l.repository.PutRateBucket(bucketItem, previousRefilledAt)
+		if errors.Is(err, repository.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("bucket %s is changed by %d concurrent requests: %w", key, MAX_CONFLICT_RETRIES+1, repository.ErrConflict)
+}
@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+)
+
+// buckets, which are full again, are dropped once the limiter holds this many buckets
+const MAX_MEMORY_BUCKETS int = 10000
+
+// memoryLimiter keeps the buckets in memory of a single process
+type memoryLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+}
+
+type memoryBucket struct {
+	*bucket
+	limit appConfig.RateLimit
+}
+
+func NewMemoryLimiter() Limiter {
+	return &memoryLimiter{buckets: map[string]*memoryBucket{}}
+}
+
+func (l *memoryLimiter) Take(key string, limit appConfig.RateLimit) (time.Duration, error) {
+	if !limit.Enabled() {
+		return 0, nil
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= MAX_MEMORY_BUCKETS {
+			l.dropFullBuckets(now)
+		}
+		b = &memoryBucket{bucket: newBucket(limit, now)}
+		l.buckets[key] = b
+	}
+	b.limit = limit
+	return b.take(limit, now), nil
+}
+
+// full buckets are dropped, because a new bucket is full as well
+func (l *memoryLimiter) dropFullBuckets(now time.Time) {
+	for key, b := range l.buckets {
+		if !b.fullAt(b.limit).After(now) {
+			delete(l.buckets, key)
+		}
+	}
+}
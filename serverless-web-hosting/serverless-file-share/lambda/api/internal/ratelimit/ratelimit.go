@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/repository"
+	"go.uber.org/zap"
+)
+
+// ErrTooManyRequests is returned, if a request is throttled by a rate limit
+var ErrTooManyRequests = errors.New("too many requests")
+
+// Limiter limits requests by token buckets, which are kept per key
+type Limiter interface {
+	// Take takes a token from the bucket of given key. It returns zero, if the request is allowed, otherwise the
+	// time until the next token is refilled.
+	Take(key string, limit appConfig.RateLimit) (time.Duration, error)
+}
+
+// New returns a limiter, whose buckets are stored in the table in production, so that they are shared by all
+// instances of the lambdas. Locally, the buckets are kept in memory.
+func New(config *appConfig.Config, r repository.DynamoDbRepository) Limiter {
+	if config.Env == appConfig.Local {
+		zap.L().Info("creating in-memory rate limiter")
+		return NewMemoryLimiter()
+	}
+	zap.L().Info("creating dynamodb rate limiter")
+	return NewDynamoDbLimiter(r)
+}
+
+// AccessKeyBucket returns the key of the bucket of an access key. Access keys are never stored, so that the
+// bucket is keyed by their hash.
+func AccessKeyBucket(accessKey string) string {
+	hash := sha256.Sum256([]byte(accessKey))
+	return "key:" + hex.EncodeToString(hash[:16])
+}
+
+// SourceIpBucket returns the key of the bucket of a source ip
+func SourceIpBucket(sourceIp string) string {
+	return "ip:" + sourceIp
+}
+
+// bucket is a token bucket, which is refilled continuously since refilledAt
+type bucket struct {
+	tokens     float64
+	refilledAt time.Time
+}
+
+// returns a full bucket
+func newBucket(limit appConfig.RateLimit, now time.Time) *bucket {
+	return &bucket{tokens: float64(limit.Burst), refilledAt: now}
+}
+
+// refills the bucket until now and takes a token, if there is one. It returns the time until the next token is
+// refilled, if the bucket is empty.
+func (b *bucket) take(limit appConfig.RateLimit, now time.Time) time.Duration {
+	if elapsed := now.Sub(b.refilledAt); elapsed > 0 {
+		b.tokens += float64(elapsed) / float64(limit.Interval())
+		if b.tokens > float64(limit.Burst) {
+			b.tokens = float64(limit.Burst)
+		}
+		b.refilledAt = now
+	}
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) * float64(limit.Interval()))
+}
+
+// returns the time, at which the bucket is full again
+func (b *bucket) fullAt(limit appConfig.RateLimit) time.Time {
+	return b.refilledAt.Add(time.Duration((float64(limit.Burst) - b.tokens) * float64(limit.Interval())))
+}
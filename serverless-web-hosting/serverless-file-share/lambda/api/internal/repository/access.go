@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/oklog/ulid"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	appTypes "github.com/unitypark/serverless-file-share/lambda/api/types"
+	"go.uber.org/zap"
+)
+
+// ULID_TIME_LENGTH is the length of the timestamp at the beginning of a ulid. Access items are sorted by
+// their ulid, so a time range of the accesses of a share is a range of these prefixes.
+const ULID_TIME_LENGTH int = 10
+
+// ListAccesses returns the downloads of the share with given id between from and to, oldest first.
+// The returned cursor continues the listing and is empty on the last page.
+func (r *dynamoDbRepository) ListAccesses(shareId string, from, to time.Time, limit int32, cursor string) ([]entities.Asset, string, error) {
+	keyCondition := expression.Key(appTypes.PK).Equal(expression.Value(appTypes.KEY_PREFIX + shareId)).And(
+		expression.Key(appTypes.SK).Between(
+			expression.Value(appTypes.ACCESS_PREFIX+ulidTime(from)),
+			// the highest character of crockford's base32 is Z, so ~ sorts after every ulid of the same time
+			expression.Value(appTypes.ACCESS_PREFIX+ulidTime(to)+"~"),
+		),
+	)
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCondition).Build()
+	if err != nil {
+		return nil, "", err
+	}
+	return r.queryAccesses(&dynamodb.QueryInput{
+		TableName:                 r.table,
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		Limit:                     aws.Int32(limit),
+	}, cursor)
+}
+
+// ListAllAccesses returns the downloads of all shares between from and to, oldest first.
+// The returned cursor continues the listing and is empty on the last page.
+func (r *dynamoDbRepository) ListAllAccesses(from, to time.Time, limit int32, cursor string) ([]entities.Asset, string, error) {
+	keyCondition := expression.Key(appTypes.ATTRIBUTE_TYPE).Equal(expression.Value(appTypes.TYPE_ACCESS)).And(
+		expression.Key(appTypes.ATTRIBUTE_ACCESSED_AT).Between(
+			expression.Value(from.UTC().Format(appTypes.TIME_FORMAT)),
+			expression.Value(to.UTC().Format(appTypes.TIME_FORMAT)),
+		),
+	)
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCondition).Build()
+	if err != nil {
+		return nil, "", err
+	}
+	return r.queryAccesses(&dynamodb.QueryInput{
+		TableName:                 r.table,
+		IndexName:                 aws.String(appTypes.ACCESS_INDEX),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		KeyConditionExpression:    expr.KeyCondition(),
+		Limit:                     aws.Int32(limit),
+	}, cursor)
+}
+
+func (r *dynamoDbRepository) queryAccesses(queryInput *dynamodb.QueryInput, cursor string) ([]entities.Asset, string, error) {
+	accesses := []entities.Asset{}
+	startKey, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	queryInput.ExclusiveStartKey = startKey
+	queryOutput, err := r.client.Query(context.TODO(), queryInput)
+	if err != nil {
+		zap.L().Error("unexpected error during query", zap.Error(err))
+		return nil, "", err
+	}
+	err = attributevalue.UnmarshalListOfMaps(queryOutput.Items, &accesses)
+	if err != nil {
+		return nil, "", err
+	}
+	nextCursor, err := encodeCursor(queryOutput.LastEvaluatedKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return accesses, nextCursor, nil
+}
+
+// returns the timestamp part of a ulid of given time
+func ulidTime(t time.Time) string {
+	return ulid.MustNew(ulid.Timestamp(t), nil).String()[:ULID_TIME_LENGTH]
+}
@@ -0,0 +1,244 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	appTypes "github.com/unitypark/serverless-file-share/lambda/api/types"
+	"go.uber.org/zap"
+)
+
+// CreateFile records a file, which is being uploaded. A file, which is already recorded, keeps its record
+// until the new upload is processed, so that it stays shareable in the meantime.
+func (r *dynamoDbRepository) CreateFile(entity *entities.Asset) error {
+	item, err := attributevalue.MarshalMap(entity)
+	if err != nil {
+		return err
+	}
+	_, err = r.client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           r.table,
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(PK)"),
+	})
+	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			zap.L().Info("file is already recorded", zap.String("path", entity.Path))
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *dynamoDbRepository) GetFile(path string) (*entities.Asset, error) {
+	file := new(entities.Asset)
+	getItemOutput, err := r.client.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: r.table,
+		Key:       fileKey(path),
+	})
+	if err != nil {
+		zap.L().Error("unexpected error during getItem", zap.Error(err))
+		return nil, err
+	}
+	if getItemOutput.Item == nil {
+		return nil, fmt.Errorf("cannot find file with given path: %w", ErrNotFound)
+	}
+	err = attributevalue.UnmarshalMap(getItemOutput.Item, file)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// AddReservation records the size of an upload, which is reserved in the usage of the file's owner, on the
+// record of the file, so that the reservation is released when the upload is processed or aborted
+func (r *dynamoDbRepository) AddReservation(path string, size int64) error {
+	update := expression.Add(
+		expression.Name(appTypes.ATTRIBUTE_RESERVED_BYTES), expression.Value(size),
+	).Set(
+		expression.Name(appTypes.ATTRIBUTE_RESERVED_AT), expression.Value(entities.GetCurrentUTCTime().Format(appTypes.TIME_FORMAT)),
+	)
+	return r.updateFile(path, update, expression.Name(appTypes.PK).AttributeExists())
+}
+
+// ReleaseReservation removes the size of an upload from the reservations of the file. It returns false, if
+// less is reserved, e.g. because the reservation was released by the processing of the upload already.
+func (r *dynamoDbRepository) ReleaseReservation(path string, size int64) (bool, error) {
+	update := expression.Add(
+		expression.Name(appTypes.ATTRIBUTE_RESERVED_BYTES), expression.Value(-size),
+	)
+	condition := expression.Name(appTypes.ATTRIBUTE_RESERVED_BYTES).GreaterThanEqual(expression.Value(size))
+	err := r.updateFile(path, update, condition)
+	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *dynamoDbRepository) updateFile(path string, update expression.UpdateBuilder, condition expression.ConditionBuilder) error {
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return err
+	}
+	_, err = r.client.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:                 r.table,
+		Key:                       fileKey(path),
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeValues: expr.Values(),
+		ExpressionAttributeNames:  expr.Names(),
+	})
+	return err
+}
+
+// DeleteUploadingFile removes the record of a file, whose upload was aborted before it was ever processed.
+// The record is kept, while other uploads of the file are reserved.
+func (r *dynamoDbRepository) DeleteUploadingFile(path string) error {
+	condition := expression.Name(appTypes.ATTRIBUTE_STATE).Equal(expression.Value(appTypes.STATE_UPLOADING)).And(
+		expression.Name(appTypes.ATTRIBUTE_RESERVED_BYTES).AttributeNotExists().Or(
+			expression.Name(appTypes.ATTRIBUTE_RESERVED_BYTES).LessThanEqual(expression.Value(0)),
+		),
+	)
+	expr, err := expression.NewBuilder().WithCondition(condition).Build()
+	if err != nil {
+		return err
+	}
+	_, err = r.client.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName:                 r.table,
+		Key:                       fileKey(path),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeValues: expr.Values(),
+		ExpressionAttributeNames:  expr.Names(),
+	})
+	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteFile removes the record of a file, which is deleted from the bucket, and returns the removed record
+func (r *dynamoDbRepository) DeleteFile(path string) (*entities.Asset, error) {
+	deletedFile := new(entities.Asset)
+	deleteItemOutput, err := r.client.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+		TableName:    r.table,
+		Key:          fileKey(path),
+		ReturnValues: types.ReturnValueAllOld,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if deleteItemOutput.Attributes == nil {
+		return nil, fmt.Errorf("cannot find file with given path: %w", ErrNotFound)
+	}
+	err = attributevalue.UnmarshalMap(deleteItemOutput.Attributes, deletedFile)
+	if err != nil {
+		return nil, err
+	}
+	return deletedFile, nil
+}
+
+// UpdateProcessedFile records the metadata and the state of an uploaded file. Files, which were not
+// uploaded over the api, are recorded as well with the owner of the home folder as uploader. An infected
+// version is added to the quarantined versions of the file.
+func (r *dynamoDbRepository) UpdateProcessedFile(file *entities.Asset) (*entities.Asset, error) {
+	processedFile := new(entities.Asset)
+	update := expression.Set(
+		expression.Name(appTypes.ATTRIBUTE_TYPE), expression.Value(appTypes.TYPE_FILE),
+	).Set(
+		expression.Name(appTypes.ATTRIBUTE_PATH), expression.Value(file.Path),
+	).Set(
+		expression.Name(appTypes.ATTRIBUTE_STATE), expression.Value(file.State),
+	).Set(
+		expression.Name(appTypes.ATTRIBUTE_SCAN_RESULT), expression.Value(file.ScanResult),
+	).Set(
+		expression.Name(appTypes.ATTRIBUTE_FILE_SIZE), expression.Value(file.FileSize),
+	).Set(
+		expression.Name(appTypes.ATTRIBUTE_CONTENT_TYPE), expression.Value(file.ContentType),
+	).Set(
+		expression.Name(appTypes.ATTRIBUTE_SHA256), expression.Value(file.Sha256),
+	).Set(
+		expression.Name(appTypes.ATTRIBUTE_PROCESSED_AT), expression.Value(file.ProcessedAt),
+	).Set(
+		expression.Name(appTypes.ATTRIBUTE_UPLOADED_BY), expression.IfNotExists(expression.Name(appTypes.ATTRIBUTE_CREATED_BY), expression.Value(file.UploadedBy)),
+	)
+	if file.VersionId != "" {
+		update = update.Set(expression.Name(appTypes.ATTRIBUTE_VERSION_ID), expression.Value(file.VersionId))
+		if file.State == appTypes.STATE_QUARANTINED {
+			update = update.Add(expression.Name(appTypes.ATTRIBUTE_QUARANTINED), expression.Value(&types.AttributeValueMemberSS{Value: []string{file.VersionId}}))
+		}
+	} else {
+		// an unversioned object replaces the version, which was processed before
+		update = update.Remove(expression.Name(appTypes.ATTRIBUTE_VERSION_ID))
+	}
+	if file.PreviewPath != "" {
+		update = update.Set(expression.Name(appTypes.ATTRIBUTE_PREVIEW_PATH), expression.Value(file.PreviewPath))
+	} else {
+		update = update.Remove(expression.Name(appTypes.ATTRIBUTE_PREVIEW_PATH))
+	}
+	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return nil, err
+	}
+	updateItemOutput, err := r.client.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:                 r.table,
+		Key:                       fileKey(file.Path),
+		ReturnValues:              types.ReturnValueAllNew,
+		UpdateExpression:          expr.Update(),
+		ExpressionAttributeValues: expr.Values(),
+		ExpressionAttributeNames:  expr.Names(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = attributevalue.UnmarshalMap(updateItemOutput.Attributes, processedFile)
+	if err != nil {
+		return nil, err
+	}
+	return processedFile, nil
+}
+
+// AddQuarantinedVersion records an infected version of a file, which was overwritten before it was processed
+func (r *dynamoDbRepository) AddQuarantinedVersion(path, versionId string) error {
+	update := expression.Set(
+		expression.Name(appTypes.ATTRIBUTE_TYPE), expression.Value(appTypes.TYPE_FILE),
+	).Set(
+		expression.Name(appTypes.ATTRIBUTE_PATH), expression.Value(path),
+	).Add(
+		expression.Name(appTypes.ATTRIBUTE_QUARANTINED), expression.Value(&types.AttributeValueMemberSS{Value: []string{versionId}}),
+	)
+	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		return err
+	}
+	_, err = r.client.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:                 r.table,
+		Key:                       fileKey(path),
+		UpdateExpression:          expr.Update(),
+		ExpressionAttributeValues: expr.Values(),
+		ExpressionAttributeNames:  expr.Names(),
+	})
+	return err
+}
+
+func fileKey(path string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		appTypes.PK: &types.AttributeValueMemberS{Value: appTypes.FILE_PREFIX + path},
+		appTypes.SK: &types.AttributeValueMemberS{Value: appTypes.TYPE_FILE},
+	}
+}
@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/client"
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	appTypes "github.com/unitypark/serverless-file-share/lambda/api/types"
+	"go.uber.org/zap"
+)
+
+// legacy assets were stored with the path as PK and a ulid as SK. The share itself was marked with
+// INIT in AccessedAt and AccessedBy, every download added a copy of the share with the accessing user.
+const LEGACY_SHARE_MARKER string = "INIT"
+
+type MigrationRepository interface {
+	MigrateLegacyAssets() (int, error)
+}
+
+type legacyShare struct {
+	share    *entities.Asset
+	accesses []entities.Asset
+}
+
+func NewMigrationRepository(client *client.Client, retention appConfig.RetentionPolicy) MigrationRepository {
+	return &dynamoDbRepository{
+		table:     client.Table,
+		client:    client.DynamoDbClient,
+		retention: retention,
+	}
+}
+
+// MigrateLegacyAssets copies the shares and downloads of legacy assets into items keyed by the access key.
+// The downloads of a share are written before the share, and they are keyed by the ulid of their legacy item,
+// so that a run, which failed in between, is resumed by running it again: downloads, which were written
+// before, are kept. Already migrated shares are skipped with their downloads. Legacy items are left untouched.
+func (r *dynamoDbRepository) MigrateLegacyAssets() (int, error) {
+	legacyShares, err := r.scanLegacyAssets()
+	if err != nil {
+		return 0, err
+	}
+	migrated := 0
+	for accessKey, legacy := range legacyShares {
+		if legacy.share == nil {
+			zap.L().Warn("skipping downloads without share", zap.String("accessKey", accessKey))
+			continue
+		}
+		share := *legacy.share
+		share.PK = appTypes.KEY_PREFIX + accessKey
+		share.SK = appTypes.TYPE_SHARE
+		share.Type = appTypes.TYPE_SHARE
+		share.Path = legacy.share.PK
+		share.Filename = filepath.Base(share.Path)
+		share.AccessedAt = ""
+		share.AccessedBy = ""
+		share.DownloadCount = len(legacy.accesses)
+		share.MaxDownloads = ALLOWED_DOWNLOAD_COUNT
+		share.Ttl = r.retention.Ttl(&share)
+
+		exists, err := r.itemExists(share.PK, share.SK)
+		if err != nil {
+			return migrated, err
+		}
+		if exists {
+			zap.L().Info("share is already migrated", zap.String("accessKey", accessKey))
+			continue
+		}
+		for _, access := range legacy.accesses {
+			accessAsset := entities.Asset{
+				PK:         share.PK,
+				SK:         appTypes.ACCESS_PREFIX + access.SK,
+				Type:       appTypes.TYPE_ACCESS,
+				Path:       share.Path,
+				Filename:   share.Filename,
+				AccessKey:  accessKey,
+				AccessedAt: access.AccessedAt,
+				AccessedBy: access.AccessedBy,
+			}
+			accessAsset.Ttl = r.retention.Ttl(&accessAsset)
+			_, err = r.putNewItem(accessAsset)
+			if err != nil {
+				return migrated, err
+			}
+		}
+		created, err := r.putNewItem(share)
+		if err != nil {
+			return migrated, err
+		}
+		if !created {
+			zap.L().Info("share is already migrated", zap.String("accessKey", accessKey))
+			continue
+		}
+		zap.L().Info("share is migrated", zap.String("accessKey", accessKey), zap.Int("downloads", len(legacy.accesses)))
+		migrated++
+	}
+	return migrated, nil
+}
+
+// returns true, if the item of given key exists
+func (r *dynamoDbRepository) itemExists(pk, sk string) (bool, error) {
+	getItemOutput, err := r.client.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: r.table,
+		Key: map[string]types.AttributeValue{
+			appTypes.PK: &types.AttributeValueMemberS{Value: pk},
+			appTypes.SK: &types.AttributeValueMemberS{Value: sk},
+		},
+		ProjectionExpression: aws.String(appTypes.PK),
+		ConsistentRead:       aws.Bool(true),
+	})
+	if err != nil {
+		return false, err
+	}
+	return getItemOutput.Item != nil, nil
+}
+
+// writes given asset, unless its item exists. It returns false, if the item exists.
+func (r *dynamoDbRepository) putNewItem(asset entities.Asset) (bool, error) {
+	item, err := attributevalue.MarshalMap(asset)
+	if err != nil {
+		return false, err
+	}
+	_, err = r.client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:           r.table,
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(PK)"),
+	})
+	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *dynamoDbRepository) scanLegacyAssets() (map[string]*legacyShare, error) {
+	legacyShares := map[string]*legacyShare{}
+	filter := expression.Name(appTypes.ATTRIBUTE_ACCESS_KEY).AttributeExists().And(
+		expression.Name(appTypes.ATTRIBUTE_TYPE).AttributeNotExists(),
+	)
+	expr, err := expression.NewBuilder().WithFilter(filter).Build()
+	if err != nil {
+		return nil, err
+	}
+	paginator := dynamodb.NewScanPaginator(r.client, &dynamodb.ScanInput{
+		TableName:                 r.table,
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		FilterExpression:          expr.Filter(),
+	})
+	for paginator.HasMorePages() {
+		scanOutput, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			zap.L().Error("unexpected error during scan item", zap.Error(err))
+			return nil, err
+		}
+		assets := []entities.Asset{}
+		err = attributevalue.UnmarshalListOfMaps(scanOutput.Items, &assets)
+		if err != nil {
+			return nil, err
+		}
+		for i := range assets {
+			asset := assets[i]
+			if strings.HasPrefix(asset.PK, appTypes.KEY_PREFIX) {
+				continue
+			}
+			legacy, ok := legacyShares[asset.AccessKey]
+			if !ok {
+				legacy = new(legacyShare)
+				legacyShares[asset.AccessKey] = legacy
+			}
+			if asset.AccessedAt == LEGACY_SHARE_MARKER && asset.AccessedBy == LEGACY_SHARE_MARKER {
+				legacy.share = &asset
+			} else {
+				legacy.accesses = append(legacy.accesses, asset)
+			}
+		}
+	}
+	zap.L().Info("legacy assets are scanned", zap.Int("shares", len(legacyShares)))
+	return legacyShares, nil
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	appTypes "github.com/unitypark/serverless-file-share/lambda/api/types"
+)
+
+// GetRateBucket returns the token bucket of a rate limit, ErrNotFound if nothing was taken from it yet
+func (r *dynamoDbRepository) GetRateBucket(key string) (*entities.Asset, error) {
+	bucket := new(entities.Asset)
+	getItemOutput, err := r.client.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName:      r.table,
+		Key:            rateKey(key),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if getItemOutput.Item == nil {
+		return nil, fmt.Errorf("cannot find rate bucket %s: %w", key, ErrNotFound)
+	}
+	err = attributevalue.UnmarshalMap(getItemOutput.Item, bucket)
+	if err != nil {
+		return nil, err
+	}
+	return bucket, nil
+}
+
+// PutRateBucket writes the token bucket of a rate limit, unless it was refilled by another request since it was
+// read. The refill time of a new bucket is zero. ErrConflict is returned, if the bucket was changed.
+func (r *dynamoDbRepository) PutRateBucket(bucket *entities.Asset, previousRefilledAt int64) error {
+	item, err := attributevalue.MarshalMap(bucket)
+	if err != nil {
+		return err
+	}
+	condition := expression.AttributeNotExists(expression.Name(appTypes.PK))
+	if previousRefilledAt != 0 {
+		condition = expression.Name(appTypes.ATTRIBUTE_REFILLED_AT).Equal(expression.Value(previousRefilledAt))
+	}
+	expr, err := expression.NewBuilder().WithCondition(condition).Build()
+	if err != nil {
+		return err
+	}
+	_, err = r.client.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:                 r.table,
+		Item:                      item,
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeValues: expr.Values(),
+		ExpressionAttributeNames:  expr.Names(),
+	})
+	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return fmt.Errorf("rate bucket %s is changed: %w", bucket.PK, ErrConflict)
+		}
+		return err
+	}
+	return nil
+}
+
+func rateKey(key string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		appTypes.PK: &types.AttributeValueMemberS{Value: appTypes.RATE_PREFIX + key},
+		appTypes.SK: &types.AttributeValueMemberS{Value: appTypes.TYPE_RATE},
+	}
+}
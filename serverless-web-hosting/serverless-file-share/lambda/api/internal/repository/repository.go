@@ -12,218 +12,267 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/unitypark/serverless-file-share/lambda/api/internal/client"
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
 	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
 	appTypes "github.com/unitypark/serverless-file-share/lambda/api/types"
 	"go.uber.org/zap"
 )
 
+var (
+	// ErrNotFound is returned, if the requested item does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrConsumed is returned, if a one-time share was downloaded before or the download limit of a share is reached
+	ErrConsumed = errors.New("share is consumed")
+	// ErrRevoked is returned, if a share was revoked by its sharer
+	ErrRevoked = errors.New("share is revoked")
+	// ErrExpired is returned, if the expiring time of a share has passed
+	ErrExpired = errors.New("share is expired")
+	// ErrPreparing is returned, if the archive of a shared folder is not ready to be downloaded yet
+	ErrPreparing = errors.New("share is being prepared")
+	// ErrInactive is returned, if a share cannot be downloaded in its state, e.g. its archive failed
+	ErrInactive = errors.New("share is not active")
+	// ErrQuotaExceeded is returned, if a reservation would exceed the storage quota of the user
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrConflict is returned, if an item was changed by another request since it was read
+	ErrConflict = errors.New("conflict")
+)
+
 const (
+	// download limit of shares, which were created before the limit could be chosen per share
 	ALLOWED_DOWNLOAD_COUNT int = 100
 )
 
 type DynamoDbRepository interface {
-	GetAssetUrl(accessKey, username string) (*entities.Asset, error)
+	GetAssetUrl(shareId, username string) (*entities.Asset, error)
 	CreateAssetUrl(entity *entities.Asset) (*entities.Asset, error)
+	CreateUpload(entity *entities.Asset) (*entities.Asset, error)
+	GetUpload(uploadId string) (*entities.Asset, error)
+	UpdateUpload(uploadId, state string, parts []entities.Part) (*entities.Asset, error)
+	GetShare(shareId string) (*entities.Asset, error)
+	ListShares(username string, limit int32, cursor string) ([]entities.Asset, string, error)
+	RevokeShare(shareId, username string) (*entities.Asset, error)
+	RecordFailedAttempt(shareId string, maxAttempts int, lockDuration time.Duration) (*entities.Asset, error)
+	UpdateShareState(shareId, state string) (*entities.Asset, error)
+	SetObjectDeleted(shareId string) error
+	CreateFile(entity *entities.Asset) error
+	GetFile(path string) (*entities.Asset, error)
+	DeleteUploadingFile(path string) error
+	AddReservation(path string, size int64) error
+	ReleaseReservation(path string, size int64) (bool, error)
+	UpdateProcessedFile(file *entities.Asset) (*entities.Asset, error)
+	AddQuarantinedVersion(path, versionId string) error
+	DeleteFile(path string) (*entities.Asset, error)
+	ListAccesses(shareId string, from, to time.Time, limit int32, cursor string) ([]entities.Asset, string, error)
+	ListAllAccesses(from, to time.Time, limit int32, cursor string) ([]entities.Asset, string, error)
+	GetUsage(username string) (*entities.Asset, error)
+	AddUsage(username string, delta int64) (*entities.Asset, error)
+	ReserveUsage(username string, size, quota int64) (*entities.Asset, error)
+	SetQuota(username string, quota int64) (*entities.Asset, error)
+	ScanAssets(itemTypes []string, fn func(asset *entities.Asset) error) error
+	UpdateTtl(asset *entities.Asset) error
+	GetRateBucket(key string) (*entities.Asset, error)
+	PutRateBucket(bucket *entities.Asset, previousRefilledAt int64) error
 }
 
 type dynamoDbRepository struct {
 	table  *string
 	client *dynamodb.Client
+	// shares, downloads and uploads are written with the ttl of the retention policy
+	retention appConfig.RetentionPolicy
 }
 
-func NewRepository(client *client.Client) DynamoDbRepository {
+func NewRepository(client *client.Client, retention appConfig.RetentionPolicy) DynamoDbRepository {
 	return &dynamoDbRepository{
-		table:  client.Table,
-		client: client.DynamoDbClient,
+		table:     client.Table,
+		client:    client.DynamoDbClient,
+		retention: retention,
 	}
 }
 
-func (r *dynamoDbRepository) GetAssetUrl(accessKey, username string) (*entities.Asset, error) {
-	var isAssetDownloadUrlValid bool
-	assets, err := r.scanAssetByAccessKey(accessKey)
+func (r *dynamoDbRepository) GetAssetUrl(shareId, username string) (*entities.Asset, error) {
+	preparedAsset, err := r.GetShare(shareId)
 	if err != nil {
 		zap.L().Error("unexpected error during getItem", zap.Error(err))
 		return nil, err
 	}
-	preparedAsset := &(*assets)[len(*assets)-1]
-	isAssetDownloadUrlValid = isAssetUrlValid(preparedAsset)
-	if len(*assets) >= ALLOWED_DOWNLOAD_COUNT+1 {
-		isAssetDownloadUrlValid = false
-	}
-	if isAssetDownloadUrlValid {
-		var (
-			currentTime = entities.GetCurrentUTCTime()
-			update      = expression.Set(
-				expression.Name("AccessKey"), expression.Value(preparedAsset.AccessKey),
-			).Set(
-				expression.Name("Filename"), expression.Value(preparedAsset.Filename),
-			).Set(
-				expression.Name("Url"), expression.Value(preparedAsset.Url),
-			).Set(
-				expression.Name("CreatedAt"), expression.Value(preparedAsset.CreatedAt),
-			).Set(
-				expression.Name("CreatedBy"), expression.Value(preparedAsset.CreatedBy),
-			).Set(
-				expression.Name("ExpiringAt"), expression.Value(preparedAsset.ExpiringAt),
-			).Set(
-				expression.Name("AccessedAt"), expression.Value(currentTime.Format(appTypes.TIME_FORMAT)),
-			).Set(
-				expression.Name("AccessedBy"), expression.Value(username),
-			)
-			expr, _         = expression.NewBuilder().WithUpdate(update).Build()
-			updateItemInput = &dynamodb.UpdateItemInput{
-				TableName: r.table,
-				Key: map[string]types.AttributeValue{
-					appTypes.PK: &types.AttributeValueMemberS{Value: preparedAsset.PK},
-					appTypes.SK: &types.AttributeValueMemberS{Value: entities.GetUlid(currentTime)},
-				},
-				ReturnValues:              types.ReturnValueAllNew,
-				UpdateExpression:          expr.Update(),
-				ExpressionAttributeValues: expr.Values(),
-				ExpressionAttributeNames:  expr.Names(),
-			}
-		)
-		zap.L().Info("updating hitcount and state of the asset")
-		_, err := r.client.UpdateItem(context.TODO(), updateItemInput)
-		if err != nil {
-			return nil, err
-		}
-		return preparedAsset, nil
-	} else {
-		return nil, errors.New("url is not valid")
+	err = CheckShareValid(preparedAsset)
+	if err != nil {
+		return nil, err
 	}
-}
 
-func (r *dynamoDbRepository) CreateAssetUrl(entity *entities.Asset) (*entities.Asset, error) {
-	url, err := r.findAsset(entity.PK)
+	// download counter is increased only if the share is still valid at the time of writing,
+	// so that concurrent requests cannot exceed the allowed download count. A one-time share is
+	// consumed by the same write, so that only one of concurrent requests succeeds.
+	var (
+		currentTime = entities.GetCurrentUTCTime()
+		accessAsset = new(entities.Asset)
+		update      = expression.Add(
+			expression.Name(appTypes.ATTRIBUTE_DOWNLOAD_COUNT), expression.Value(1),
+		).Remove(
+			expression.Name(appTypes.ATTRIBUTE_FAILED_ATTEMPTS),
+		)
+		condition = expression.Name(appTypes.ATTRIBUTE_EXPIRING_AT).GreaterThan(
+			expression.Value(currentTime.Format(appTypes.TIME_FORMAT)),
+		).And(
+			expression.Name(appTypes.ATTRIBUTE_DOWNLOAD_COUNT).AttributeNotExists().Or(
+				expression.Name(appTypes.ATTRIBUTE_DOWNLOAD_COUNT).LessThan(expression.Name(appTypes.ATTRIBUTE_MAX_DOWNLOADS)),
+				expression.Name(appTypes.ATTRIBUTE_MAX_DOWNLOADS).AttributeNotExists().And(
+					expression.Name(appTypes.ATTRIBUTE_DOWNLOAD_COUNT).LessThan(expression.Value(ALLOWED_DOWNLOAD_COUNT)),
+				),
+			),
+		).And(
+			expression.Name(appTypes.ATTRIBUTE_STATE).AttributeNotExists().Or(
+				expression.Name(appTypes.ATTRIBUTE_STATE).Equal(expression.Value(appTypes.STATE_ACTIVE)),
+			),
+		)
+	)
+	if preparedAsset.OneTime {
+		update = update.Set(
+			expression.Name(appTypes.ATTRIBUTE_STATE), expression.Value(appTypes.STATE_CONSUMED),
+		).Set(
+			expression.Name(appTypes.ATTRIBUTE_CONSUMED_AT), expression.Value(currentTime.Format(appTypes.TIME_FORMAT)),
+		)
+	}
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
 	if err != nil {
-		zap.L().Error("unexpected error during getItem", zap.Error(err))
 		return nil, err
 	}
-	if !isAssetUrlValid(url) {
-		zap.L().Debug(fmt.Sprintf("creating new asset entity for path: %s", entity.PK))
-		var (
-			newUrl = new(entities.Asset)
-			update = expression.Set(
-				expression.Name("AccessKey"), expression.Value(entity.AccessKey),
-			).Set(
-				expression.Name("Filename"), expression.Value(entity.Filename),
-			).Set(
-				expression.Name("Url"), expression.Value(entity.Url),
-			).Set(
-				expression.Name("CreatedAt"), expression.Value(entity.CreatedAt),
-			).Set(
-				expression.Name("CreatedBy"), expression.Value(entity.CreatedBy),
-			).Set(
-				expression.Name("ExpiringAt"), expression.Value(entity.ExpiringAt),
-			).Set(
-				expression.Name("AccessedAt"), expression.Value(entity.AccessedAt),
-			).Set(
-				expression.Name("AccessedBy"), expression.Value(entity.AccessedBy),
-			)
-			expr, _         = expression.NewBuilder().WithUpdate(update).Build()
-			updateItemInput = &dynamodb.UpdateItemInput{
-				TableName: r.table,
-				Key: map[string]types.AttributeValue{
-					appTypes.PK: &types.AttributeValueMemberS{Value: entity.PK},
-					appTypes.SK: &types.AttributeValueMemberS{Value: entity.SK},
+	accessAsset.InitNewAccessAsset(preparedAsset, username, currentTime)
+	accessAsset.Ttl = r.retention.Ttl(accessAsset)
+	accessItem, err := attributevalue.MarshalMap(accessAsset)
+	if err != nil {
+		return nil, err
+	}
+	transactWriteItemsInput := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					TableName:                 r.table,
+					Key:                       shareKey(shareId),
+					UpdateExpression:          expr.Update(),
+					ConditionExpression:       expr.Condition(),
+					ExpressionAttributeValues: expr.Values(),
+					ExpressionAttributeNames:  expr.Names(),
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName: r.table,
+					Item:      accessItem,
 				},
-				ReturnValues:              types.ReturnValueAllNew,
-				UpdateExpression:          expr.Update(),
-				ExpressionAttributeValues: expr.Values(),
-				ExpressionAttributeNames:  expr.Names(),
+			},
+		},
+	}
+	zap.L().Info("updating download count of the asset")
+	_, err = r.client.TransactWriteItems(context.TODO(), transactWriteItemsInput)
+	if err != nil {
+		var transactionCanceled *types.TransactionCanceledException
+		if errors.As(err, &transactionCanceled) && isConditionalCheckFailed(transactionCanceled) {
+			// the share was changed since it was read, it is read again to tell why it cannot be downloaded
+			zap.L().Info("share cannot be downloaded anymore", zap.Error(err))
+			share, err := r.GetShare(shareId)
+			if err != nil {
+				return nil, err
 			}
-		)
-		updateItemOutput, err := r.client.UpdateItem(context.TODO(), updateItemInput)
-		if err != nil {
-			return nil, err
-		}
-
-		err = attributevalue.UnmarshalMap(updateItemOutput.Attributes, newUrl)
-		if err != nil {
-			return nil, err
+			if err = CheckShareValid(share); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("share was downloaded concurrently: %w", ErrConsumed)
 		}
-		zap.L().Debug("returning url entity", zap.Any("url", newUrl))
-		return newUrl, nil
+		return nil, err
 	}
-	zap.L().Debug("returning url entity", zap.Any("url", url))
-	return url, nil
+	preparedAsset.DownloadCount++
+	if preparedAsset.OneTime {
+		preparedAsset.State = appTypes.STATE_CONSUMED
+		preparedAsset.ConsumedAt = currentTime.Format(appTypes.TIME_FORMAT)
+	}
+	return preparedAsset, nil
 }
 
-func (r *dynamoDbRepository) scanAssetByAccessKey(accessKey string) (*[]entities.Asset, error) {
-	zap.L().Debug("call GetItem to check if given url exists in db")
-	urls := &[]entities.Asset{}
-	filter := expression.Name(appTypes.ATTRIBUTE_ACCESS_KEY).Equal(expression.Value(accessKey))
-	expr, _ := expression.NewBuilder().WithFilter(filter).Build()
-	scanInput := &dynamodb.ScanInput{
-		TableName:                 r.table,
-		ExpressionAttributeNames:  expr.Names(),
-		ExpressionAttributeValues: expr.Values(),
-		FilterExpression:          expr.Filter(),
-	}
-	scanOutput, err := r.client.Scan(context.TODO(), scanInput)
+// CreateAssetUrl stores a new share, every share has its own download limit and expiring time
+func (r *dynamoDbRepository) CreateAssetUrl(entity *entities.Asset) (*entities.Asset, error) {
+	zap.L().Debug(fmt.Sprintf("creating new asset entity for path: %s", entity.Path))
+	entity.Ttl = r.retention.Ttl(entity)
+	item, err := attributevalue.MarshalMap(entity)
 	if err != nil {
-		zap.L().Error("unexpected error during scan item", zap.Error(err))
 		return nil, err
 	}
-
-	if scanOutput.Count > 0 {
-		zap.L().Info("given path exists in db")
-		err = attributevalue.UnmarshalListOfMaps(scanOutput.Items, urls)
-		if err != nil {
-			return nil, err
-		}
-		zap.L().Info("output is parsed to object", zap.Any("data", urls))
-		return urls, nil
+	putItemInput := &dynamodb.PutItemInput{
+		TableName:           r.table,
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(PK)"),
+	}
+	_, err = r.client.PutItem(context.TODO(), putItemInput)
+	if err != nil {
+		return nil, err
 	}
-	return nil, errors.New("cannot find url with given path")
+	zap.L().Debug("returning url entity", zap.Any("url", entity))
+	return entity, nil
 }
 
-func (r *dynamoDbRepository) findAsset(path string) (*entities.Asset, error) {
-	zap.L().Debug("call GetItem to check if given asset exists in db")
-	urls := &[]entities.Asset{}
-	keyCondition := expression.Key(appTypes.PK).Equal(expression.Value(path))
-	filter := expression.Name(appTypes.ATTRIBUTE_ACCESSED_AT).Equal(expression.Value("INIT")).And(
-		expression.Name(appTypes.ATTRIBUTE_ACCESSED_BY).Equal(expression.Value("INIT")),
-	)
-	expr, _ := expression.NewBuilder().WithKeyCondition(keyCondition).WithFilter(filter).Build()
-	queryInput := &dynamodb.QueryInput{
-		TableName:                 r.table,
-		ExpressionAttributeNames:  expr.Names(),
-		ExpressionAttributeValues: expr.Values(),
-		KeyConditionExpression:    expr.KeyCondition(),
-		FilterExpression:          expr.Filter(),
-		ScanIndexForward:          aws.Bool(false),
-		Limit:                     aws.Int32(1),
-	}
-	queryOutput, err := r.client.Query(context.TODO(), queryInput)
+func (r *dynamoDbRepository) GetShare(shareId string) (*entities.Asset, error) {
+	zap.L().Debug("call GetItem to check if given access key exists in db")
+	share := new(entities.Asset)
+	getItemInput := &dynamodb.GetItemInput{
+		TableName: r.table,
+		Key:       shareKey(shareId),
+	}
+	getItemOutput, err := r.client.GetItem(context.TODO(), getItemInput)
 	if err != nil {
 		zap.L().Error("unexpected error during getItem", zap.Error(err))
 		return nil, err
 	}
-
-	if queryOutput.Count > 0 {
-		zap.L().Info("given path exists in db")
-		err = attributevalue.UnmarshalListOfMaps(queryOutput.Items, urls)
-		if err != nil {
-			return nil, err
-		}
-		zap.L().Info("output is parsed to object", zap.Any("data", urls))
-		return &(*urls)[0], nil
+	if getItemOutput.Item == nil {
+		return nil, fmt.Errorf("cannot find url with given share id: %w", ErrNotFound)
+	}
+	err = attributevalue.UnmarshalMap(getItemOutput.Item, share)
+	if err != nil {
+		return nil, err
 	}
-	return nil, nil
+	zap.L().Info("output is parsed to object", zap.Any("data", share))
+	return share, nil
+}
+
+// returns true, if the transaction is canceled by the condition of its first item, which is the update of the share
+func isConditionalCheckFailed(err *types.TransactionCanceledException) bool {
+	return len(err.CancellationReasons) > 0 && aws.ToString(err.CancellationReasons[0].Code) == "ConditionalCheckFailed"
 }
 
-func isAssetUrlValid(asset *entities.Asset) bool {
-	if asset == nil {
-		zap.L().Info("url is not found")
-		return false
+// CheckShareValid returns an error, if the share cannot be downloaded anymore
+func CheckShareValid(asset *entities.Asset) error {
+	if asset.State == appTypes.STATE_REVOKED {
+		return fmt.Errorf("share was revoked at %s: %w", asset.RevokedAt, ErrRevoked)
+	}
+	if asset.State == appTypes.STATE_CONSUMED {
+		return fmt.Errorf("one-time share was downloaded at %s: %w", asset.ConsumedAt, ErrConsumed)
+	}
+	if asset.State == appTypes.STATE_PREPARING {
+		return fmt.Errorf("%w: archive of the folder is not ready yet, try again later", ErrPreparing)
+	}
+	if asset.State != "" && asset.State != appTypes.STATE_ACTIVE {
+		return fmt.Errorf("share is %s: %w", asset.State, ErrInactive)
 	}
 	if isInThePast(asset.ExpiringAt) {
-		zap.L().Info("given url is expired")
-		return false
-	} else {
-		return true
+		return fmt.Errorf("share expired at %s: %w", asset.ExpiringAt, ErrExpired)
+	}
+	if asset.DownloadCount >= maxDownloads(asset) {
+		return fmt.Errorf("share was downloaded %d times: %w", asset.DownloadCount, ErrConsumed)
+	}
+	return nil
+}
+
+// returns the download limit of the share, shares created before the limit could be chosen have the default limit
+func maxDownloads(asset *entities.Asset) int {
+	if asset.MaxDownloads == 0 {
+		return ALLOWED_DOWNLOAD_COUNT
+	}
+	return asset.MaxDownloads
+}
+
+func shareKey(shareId string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		appTypes.PK: &types.AttributeValueMemberS{Value: appTypes.KEY_PREFIX + shareId},
+		appTypes.SK: &types.AttributeValueMemberS{Value: appTypes.TYPE_SHARE},
 	}
 }
 
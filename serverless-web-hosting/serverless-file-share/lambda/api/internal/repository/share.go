@@ -0,0 +1,293 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	appTypes "github.com/unitypark/serverless-file-share/lambda/api/types"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidCursor is returned, if the cursor of a listing was not issued by the repository
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListShares returns the shares created by given user, latest first. The returned cursor continues
+// the listing and is empty on the last page. The index holds other items of the user as well, which are
+// filtered after the limit is applied, so that it is queried until the page is full.
+func (r *dynamoDbRepository) ListShares(username string, limit int32, cursor string) ([]entities.Asset, string, error) {
+	shares := []entities.Asset{}
+	startKey, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	keyCondition := expression.Key(appTypes.ATTRIBUTE_CREATED_BY).Equal(expression.Value(username))
+	filter := expression.Name(appTypes.ATTRIBUTE_TYPE).Equal(expression.Value(appTypes.TYPE_SHARE))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCondition).WithFilter(filter).Build()
+	if err != nil {
+		return nil, "", err
+	}
+	for {
+		// the remaining limit ends the query at the last share of the page, so that the cursor skips no share
+		queryInput := &dynamodb.QueryInput{
+			TableName:                 r.table,
+			IndexName:                 aws.String(appTypes.CREATED_BY_INDEX),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			KeyConditionExpression:    expr.KeyCondition(),
+			FilterExpression:          expr.Filter(),
+			ScanIndexForward:          aws.Bool(false),
+			Limit:                     aws.Int32(limit - int32(len(shares))),
+			ExclusiveStartKey:         startKey,
+		}
+		queryOutput, err := r.client.Query(context.TODO(), queryInput)
+		if err != nil {
+			zap.L().Error("unexpected error during query", zap.Error(err))
+			return nil, "", err
+		}
+		page := []entities.Asset{}
+		err = attributevalue.UnmarshalListOfMaps(queryOutput.Items, &page)
+		if err != nil {
+			return nil, "", err
+		}
+		shares = append(shares, page...)
+		startKey = queryOutput.LastEvaluatedKey
+		if len(startKey) == 0 || int32(len(shares)) >= limit {
+			break
+		}
+	}
+	nextCursor, err := encodeCursor(startKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return shares, nextCursor, nil
+}
+
+// RevokeShare marks the share as revoked, so that its access key cannot be used anymore
+func (r *dynamoDbRepository) RevokeShare(shareId, username string) (*entities.Asset, error) {
+	var (
+		share  = new(entities.Asset)
+		update = expression.Set(
+			expression.Name(appTypes.ATTRIBUTE_STATE), expression.Value(appTypes.STATE_REVOKED),
+		).Set(
+			expression.Name(appTypes.ATTRIBUTE_REVOKED_AT), expression.Value(entities.GetCurrentUTCTime().Format(appTypes.TIME_FORMAT)),
+		)
+		condition = expression.Name(appTypes.PK).AttributeExists().And(
+			expression.Name(appTypes.ATTRIBUTE_CREATED_BY).Equal(expression.Value(username)),
+		)
+	)
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return nil, err
+	}
+	updateItemInput := &dynamodb.UpdateItemInput{
+		TableName:                 r.table,
+		Key:                       shareKey(shareId),
+		ReturnValues:              types.ReturnValueAllNew,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeValues: expr.Values(),
+		ExpressionAttributeNames:  expr.Names(),
+	}
+	zap.L().Info("revoking share", zap.String("shareId", shareId))
+	updateItemOutput, err := r.client.UpdateItem(context.TODO(), updateItemInput)
+	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return nil, fmt.Errorf("cannot find share of user with given share id: %w", ErrNotFound)
+		}
+		return nil, err
+	}
+	err = attributevalue.UnmarshalMap(updateItemOutput.Attributes, share)
+	if err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// SetObjectDeleted records, that the object of a one-time share was deleted after its url expired. A share,
+// which was deleted by the ttl of the table in the meantime, is not recreated.
+func (r *dynamoDbRepository) SetObjectDeleted(shareId string) error {
+	var (
+		update = expression.Set(
+			expression.Name(appTypes.ATTRIBUTE_OBJECT_DELETED), expression.Value(entities.GetCurrentUTCTime().Format(appTypes.TIME_FORMAT)),
+		)
+		condition = expression.Name(appTypes.PK).AttributeExists()
+	)
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return err
+	}
+	_, err = r.client.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:                 r.table,
+		Key:                       shareKey(shareId),
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeValues: expr.Values(),
+		ExpressionAttributeNames:  expr.Names(),
+	})
+	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// UpdateShareState finishes the preparation of a share with given state. A share, which is not being prepared
+// anymore e.g. revoked in the meantime, is left untouched.
+func (r *dynamoDbRepository) UpdateShareState(shareId, state string) (*entities.Asset, error) {
+	var (
+		share     = new(entities.Asset)
+		update    = expression.Set(expression.Name(appTypes.ATTRIBUTE_STATE), expression.Value(state))
+		condition = expression.Name(appTypes.ATTRIBUTE_STATE).Equal(expression.Value(appTypes.STATE_PREPARING))
+	)
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return nil, err
+	}
+	updateItemOutput, err := r.client.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:                 r.table,
+		Key:                       shareKey(shareId),
+		ReturnValues:              types.ReturnValueAllNew,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeValues: expr.Values(),
+		ExpressionAttributeNames:  expr.Names(),
+	})
+	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return nil, fmt.Errorf("cannot find share in preparation with given share id: %w", ErrNotFound)
+		}
+		return nil, err
+	}
+	err = attributevalue.UnmarshalMap(updateItemOutput.Attributes, share)
+	if err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// RecordFailedAttempt counts a wrong passphrase of the share. Once the count reaches max attempts,
+// the share is locked for given duration and the count starts again. Every attempt is recorded by a single
+// conditional write: it is counted while the count stays below max attempts, otherwise it locks the share.
+// Concurrent attempts therefore cannot pass max attempts without locking the share.
+func (r *dynamoDbRepository) RecordFailedAttempt(shareId string, maxAttempts int, lockDuration time.Duration) (*entities.Asset, error) {
+	var (
+		now      = entities.GetCurrentUTCTime()
+		unlocked = expression.Name(appTypes.ATTRIBUTE_LOCKED_UNTIL).AttributeNotExists().Or(
+			expression.Name(appTypes.ATTRIBUTE_LOCKED_UNTIL).LessThanEqual(expression.Value(now.Format(appTypes.TIME_FORMAT))),
+		)
+		countUpdate = expression.Add(
+			expression.Name(appTypes.ATTRIBUTE_FAILED_ATTEMPTS), expression.Value(1),
+		)
+		countCondition = unlocked.And(
+			expression.Name(appTypes.ATTRIBUTE_FAILED_ATTEMPTS).AttributeNotExists().Or(
+				expression.Name(appTypes.ATTRIBUTE_FAILED_ATTEMPTS).LessThan(expression.Value(maxAttempts - 1)),
+			),
+		)
+	)
+	share, err := r.updateShare(shareId, countUpdate, countCondition)
+	if !errors.Is(err, ErrConflict) {
+		return share, err
+	}
+
+	lockedUntil := now.Add(lockDuration).Format(appTypes.TIME_FORMAT)
+	lockUpdate := expression.Set(
+		expression.Name(appTypes.ATTRIBUTE_LOCKED_UNTIL), expression.Value(lockedUntil),
+	).Remove(
+		expression.Name(appTypes.ATTRIBUTE_FAILED_ATTEMPTS),
+	)
+	lockCondition := unlocked.And(
+		expression.Name(appTypes.ATTRIBUTE_FAILED_ATTEMPTS).AttributeNotExists().Or(
+			expression.Name(appTypes.ATTRIBUTE_FAILED_ATTEMPTS).GreaterThanEqual(expression.Value(maxAttempts - 1)),
+		),
+	)
+	share, err = r.updateShare(shareId, lockUpdate, lockCondition)
+	if errors.Is(err, ErrConflict) {
+		// the share is locked by a concurrent attempt
+		return r.GetShare(shareId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	zap.L().Info("locking share after too many wrong passphrases", zap.String("shareId", shareId), zap.String("lockedUntil", lockedUntil))
+	return share, nil
+}
+
+// updates the share, if it exists and matches given condition. ErrConflict is returned, if it does not match.
+func (r *dynamoDbRepository) updateShare(shareId string, update expression.UpdateBuilder, condition expression.ConditionBuilder) (*entities.Asset, error) {
+	share := new(entities.Asset)
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(
+		expression.Name(appTypes.PK).AttributeExists().And(condition),
+	).Build()
+	if err != nil {
+		return nil, err
+	}
+	updateItemOutput, err := r.client.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:                 r.table,
+		Key:                       shareKey(shareId),
+		ReturnValues:              types.ReturnValueAllNew,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeValues: expr.Values(),
+		ExpressionAttributeNames:  expr.Names(),
+	})
+	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return nil, fmt.Errorf("share %s was changed: %w", shareId, ErrConflict)
+		}
+		return nil, err
+	}
+	err = attributevalue.UnmarshalMap(updateItemOutput.Attributes, share)
+	if err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// encodes the last evaluated key of a query into an opaque cursor for the client
+func encodeCursor(lastEvaluatedKey map[string]types.AttributeValue) (string, error) {
+	if len(lastEvaluatedKey) == 0 {
+		return "", nil
+	}
+	key := map[string]string{}
+	err := attributevalue.UnmarshalMap(lastEvaluatedKey, &key)
+	if err != nil {
+		return "", err
+	}
+	out, err := json.Marshal(key)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(out), nil
+}
+
+func decodeCursor(cursor string) (map[string]types.AttributeValue, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	out, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	key := map[string]string{}
+	err = json.Unmarshal(out, &key)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return attributevalue.MarshalMap(key)
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	appTypes "github.com/unitypark/serverless-file-share/lambda/api/types"
+	"go.uber.org/zap"
+)
+
+// ScanAssets calls fn for every item of given types in the table
+func (r *dynamoDbRepository) ScanAssets(itemTypes []string, fn func(asset *entities.Asset) error) error {
+	if len(itemTypes) == 0 {
+		return errors.New("item types are missing")
+	}
+	values := make([]expression.OperandBuilder, 0, len(itemTypes)-1)
+	for _, itemType := range itemTypes[1:] {
+		values = append(values, expression.Value(itemType))
+	}
+	filter := expression.Name(appTypes.ATTRIBUTE_TYPE).In(expression.Value(itemTypes[0]), values...)
+	expr, err := expression.NewBuilder().WithFilter(filter).Build()
+	if err != nil {
+		return err
+	}
+	paginator := dynamodb.NewScanPaginator(r.client, &dynamodb.ScanInput{
+		TableName:                 r.table,
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		FilterExpression:          expr.Filter(),
+	})
+	for paginator.HasMorePages() {
+		scanOutput, err := paginator.NextPage(context.TODO())
+		if err != nil {
+			zap.L().Error("unexpected error during scan item", zap.Error(err))
+			return err
+		}
+		assets := []entities.Asset{}
+		err = attributevalue.UnmarshalListOfMaps(scanOutput.Items, &assets)
+		if err != nil {
+			return err
+		}
+		for i := range assets {
+			err = fn(&assets[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// UpdateTtl sets the ttl of the retention policy on an item, which was written without ttl. Items, which were
+// deleted in the meantime, are not recreated.
+func (r *dynamoDbRepository) UpdateTtl(asset *entities.Asset) error {
+	ttl := r.retention.Ttl(asset)
+	if ttl == 0 {
+		return nil
+	}
+	var (
+		update    = expression.Set(expression.Name(appTypes.ATTRIBUTE_TTL), expression.Value(ttl))
+		condition = expression.Name(appTypes.PK).AttributeExists()
+	)
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return err
+	}
+	_, err = r.client.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName: r.table,
+		Key: map[string]types.AttributeValue{
+			appTypes.PK: &types.AttributeValueMemberS{Value: asset.PK},
+			appTypes.SK: &types.AttributeValueMemberS{Value: asset.SK},
+		},
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeValues: expr.Values(),
+		ExpressionAttributeNames:  expr.Names(),
+	})
+	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return nil
+		}
+		return err
+	}
+	asset.Ttl = ttl
+	return nil
+}
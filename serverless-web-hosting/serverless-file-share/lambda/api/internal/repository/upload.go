@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	appTypes "github.com/unitypark/serverless-file-share/lambda/api/types"
+	"go.uber.org/zap"
+)
+
+func (r *dynamoDbRepository) CreateUpload(entity *entities.Asset) (*entities.Asset, error) {
+	entity.Ttl = r.retention.Ttl(entity)
+	item, err := attributevalue.MarshalMap(entity)
+	if err != nil {
+		return nil, err
+	}
+	putItemInput := &dynamodb.PutItemInput{
+		TableName:           r.table,
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(PK)"),
+	}
+	zap.L().Info("creating upload entity", zap.String("uploadId", entity.UploadId))
+	_, err = r.client.PutItem(context.TODO(), putItemInput)
+	if err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+func (r *dynamoDbRepository) GetUpload(uploadId string) (*entities.Asset, error) {
+	upload := new(entities.Asset)
+	getItemInput := &dynamodb.GetItemInput{
+		TableName:      r.table,
+		Key:            uploadKey(uploadId),
+		ConsistentRead: aws.Bool(true),
+	}
+	getItemOutput, err := r.client.GetItem(context.TODO(), getItemInput)
+	if err != nil {
+		zap.L().Error("unexpected error during getItem", zap.Error(err))
+		return nil, err
+	}
+	if getItemOutput.Item == nil {
+		return nil, fmt.Errorf("cannot find upload with given id: %w", ErrNotFound)
+	}
+	err = attributevalue.UnmarshalMap(getItemOutput.Item, upload)
+	if err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// UpdateUpload persists the state and the uploaded parts of a multipart upload, as long as it is in progress
+func (r *dynamoDbRepository) UpdateUpload(uploadId, state string, parts []entities.Part) (*entities.Asset, error) {
+	var (
+		upload = new(entities.Asset)
+		update = expression.Set(
+			expression.Name(appTypes.ATTRIBUTE_STATE), expression.Value(state),
+		).Set(
+			expression.Name(appTypes.ATTRIBUTE_PARTS), expression.Value(parts),
+		)
+		condition = expression.Name(appTypes.ATTRIBUTE_STATE).Equal(expression.Value(appTypes.STATE_IN_PROGRESS))
+	)
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(condition).Build()
+	if err != nil {
+		return nil, err
+	}
+	updateItemInput := &dynamodb.UpdateItemInput{
+		TableName:                 r.table,
+		Key:                       uploadKey(uploadId),
+		ReturnValues:              types.ReturnValueAllNew,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeValues: expr.Values(),
+		ExpressionAttributeNames:  expr.Names(),
+	}
+	zap.L().Info("updating upload entity", zap.String("uploadId", uploadId), zap.String("state", state))
+	updateItemOutput, err := r.client.UpdateItem(context.TODO(), updateItemInput)
+	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return nil, errors.New("upload is not in progress")
+		}
+		return nil, err
+	}
+	err = attributevalue.UnmarshalMap(updateItemOutput.Attributes, upload)
+	if err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+func uploadKey(uploadId string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		appTypes.PK: &types.AttributeValueMemberS{Value: appTypes.UPLOAD_PREFIX + uploadId},
+		appTypes.SK: &types.AttributeValueMemberS{Value: appTypes.TYPE_UPLOAD},
+	}
+}
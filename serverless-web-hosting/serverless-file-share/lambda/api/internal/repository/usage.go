@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	appTypes "github.com/unitypark/serverless-file-share/lambda/api/types"
+	"go.uber.org/zap"
+)
+
+// GetUsage returns the storage usage of the user, a user who has not stored anything yet uses nothing
+func (r *dynamoDbRepository) GetUsage(username string) (*entities.Asset, error) {
+	usage := new(entities.Asset)
+	getItemOutput, err := r.client.GetItem(context.TODO(), &dynamodb.GetItemInput{
+		TableName: r.table,
+		Key:       usageKey(username),
+	})
+	if err != nil {
+		zap.L().Error("unexpected error during getItem", zap.Error(err))
+		return nil, err
+	}
+	if getItemOutput.Item == nil {
+		usage.InitNewUsageAsset(username)
+		return usage, nil
+	}
+	err = attributevalue.UnmarshalMap(getItemOutput.Item, usage)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// AddUsage adds the delta atomically to the bytes stored by the user, a negative delta frees storage
+func (r *dynamoDbRepository) AddUsage(username string, delta int64) (*entities.Asset, error) {
+	update := expression.Add(
+		expression.Name(appTypes.ATTRIBUTE_USED_BYTES), expression.Value(delta),
+	)
+	return r.updateUsage(username, update, nil)
+}
+
+// ReserveUsage adds the size of an upload atomically to the bytes stored by the user, if they stay within the
+// quota. ErrQuotaExceeded is returned otherwise. A quota of zero does not limit the usage.
+func (r *dynamoDbRepository) ReserveUsage(username string, size, quota int64) (*entities.Asset, error) {
+	update := expression.Add(
+		expression.Name(appTypes.ATTRIBUTE_USED_BYTES), expression.Value(size),
+	)
+	if quota <= 0 {
+		return r.updateUsage(username, update, nil)
+	}
+	if size > quota {
+		return nil, fmt.Errorf("the file of %d bytes exceeds the quota of %d bytes: %w", size, quota, ErrQuotaExceeded)
+	}
+	// dynamodb does not compute in conditions, so that the usage is compared with the quota minus the size
+	condition := expression.Name(appTypes.ATTRIBUTE_USED_BYTES).AttributeNotExists().Or(
+		expression.Name(appTypes.ATTRIBUTE_USED_BYTES).LessThanEqual(expression.Value(quota - size)),
+	)
+	usage, err := r.updateUsage(username, update, &condition)
+	if err != nil {
+		var conditionalCheckFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionalCheckFailed) {
+			return nil, fmt.Errorf("the file of %d bytes does not fit into the quota of %d bytes: %w", size, quota, ErrQuotaExceeded)
+		}
+		return nil, err
+	}
+	return usage, nil
+}
+
+// SetQuota overrides the quota of the user's role, a quota of zero restores the quota of the role
+func (r *dynamoDbRepository) SetQuota(username string, quota int64) (*entities.Asset, error) {
+	update := expression.Set(
+		expression.Name(appTypes.ATTRIBUTE_QUOTA), expression.Value(quota),
+	)
+	if quota == 0 {
+		update = expression.Remove(expression.Name(appTypes.ATTRIBUTE_QUOTA))
+	}
+	return r.updateUsage(username, update, nil)
+}
+
+// updates the usage of the user, if it matches the condition. A nil condition matches any usage.
+func (r *dynamoDbRepository) updateUsage(username string, update expression.UpdateBuilder, condition *expression.ConditionBuilder) (*entities.Asset, error) {
+	usage := new(entities.Asset)
+	update = update.Set(
+		expression.Name(appTypes.ATTRIBUTE_TYPE), expression.Value(appTypes.TYPE_USAGE),
+	).Set(
+		expression.Name(appTypes.ATTRIBUTE_USERNAME), expression.Value(username),
+	).Set(
+		expression.Name(appTypes.ATTRIBUTE_UPDATED_AT), expression.Value(entities.GetCurrentUTCTime().Format(appTypes.TIME_FORMAT)),
+	)
+	builder := expression.NewBuilder().WithUpdate(update)
+	if condition != nil {
+		builder = builder.WithCondition(*condition)
+	}
+	expr, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	updateItemOutput, err := r.client.UpdateItem(context.TODO(), &dynamodb.UpdateItemInput{
+		TableName:                 r.table,
+		Key:                       usageKey(username),
+		ReturnValues:              types.ReturnValueAllNew,
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeValues: expr.Values(),
+		ExpressionAttributeNames:  expr.Names(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = attributevalue.UnmarshalMap(updateItemOutput.Attributes, usage)
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+func usageKey(username string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		appTypes.PK: &types.AttributeValueMemberS{Value: appTypes.USAGE_PREFIX + username},
+		appTypes.SK: &types.AttributeValueMemberS{Value: appTypes.TYPE_USAGE},
+	}
+}
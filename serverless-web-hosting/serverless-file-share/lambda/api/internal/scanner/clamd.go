@@ -0,0 +1,116 @@
+package scanner
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// chunks of the INSTREAM command, clamd limits the whole stream by its StreamMaxLength
+const CLAMD_CHUNK_SIZE_IN_BYTES int = 64 * 1024
+
+// ErrScanFailed is returned, if clamd cannot scan the content e.g. because it exceeds the size limit
+var ErrScanFailed = errors.New("scan failed")
+
+type clamdScanner struct {
+	network string
+	address string
+	timeout time.Duration
+}
+
+// NewClamdScanner returns a scanner, which streams the content to clamd at given address with the INSTREAM command.
+// The address is either tcp://host:port or unix:///path/to/clamd.sock.
+func NewClamdScanner(address string, timeout time.Duration) (Scanner, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid clamd address %s: %v", address, err)
+	}
+	switch u.Scheme {
+	case "tcp":
+		return &clamdScanner{network: "tcp", address: u.Host, timeout: timeout}, nil
+	case "unix":
+		return &clamdScanner{network: "unix", address: u.Path, timeout: timeout}, nil
+	default:
+		return nil, fmt.Errorf("invalid clamd address %s: scheme must be tcp or unix", address)
+	}
+}
+
+func (s *clamdScanner) Scan(r io.Reader) (*Result, error) {
+	conn, err := net.DialTimeout(s.network, s.address, s.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %v", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("zINSTREAM\x00"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send command to clamd: %v", err)
+	}
+	writeErr := s.stream(conn, r)
+	// clamd answers and closes the connection, if the stream exceeds its limit
+	reply, err := s.readReply(conn)
+	if err != nil {
+		if writeErr != nil {
+			return nil, writeErr
+		}
+		return nil, err
+	}
+	return parseReply(reply)
+}
+
+// sends the content in chunks prefixed by their length, a chunk of length zero terminates the stream
+func (s *clamdScanner) stream(conn net.Conn, r io.Reader) error {
+	chunk := make([]byte, CLAMD_CHUNK_SIZE_IN_BYTES)
+	size := make([]byte, 4)
+	for {
+		n, err := r.Read(chunk)
+		if n > 0 {
+			conn.SetWriteDeadline(time.Now().Add(s.timeout))
+			binary.BigEndian.PutUint32(size, uint32(n))
+			_, writeErr := conn.Write(append(size, chunk[:n]...))
+			if writeErr != nil {
+				return fmt.Errorf("failed to stream content to clamd: %v", writeErr)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read content: %v", err)
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	_, err := conn.Write(size)
+	if err != nil {
+		return fmt.Errorf("failed to terminate stream to clamd: %v", err)
+	}
+	return nil
+}
+
+func (s *clamdScanner) readReply(conn net.Conn) (string, error) {
+	conn.SetReadDeadline(time.Now().Add(s.timeout))
+	reply, err := bufio.NewReader(conn).ReadString('\x00')
+	if err != nil && !(err == io.EOF && len(reply) > 0) {
+		return "", fmt.Errorf("failed to read reply of clamd: %v", err)
+	}
+	return strings.TrimRight(reply, "\x00\n"), nil
+}
+
+// parses replies like "stream: OK", "stream: Eicar-Signature FOUND" or "INSTREAM size limit exceeded. ERROR"
+func parseReply(reply string) (*Result, error) {
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return &Result{Infected: true, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrScanFailed, reply)
+	}
+}
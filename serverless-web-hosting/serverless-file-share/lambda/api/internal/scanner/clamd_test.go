@@ -0,0 +1,299 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClamd answers the INSTREAM command like clamd. It replies with the reply of the content, or with the
+// size limit error as soon as the stream exceeds maxLength. With reset, it resets the connection after the
+// command, without a reply, it lets the scanner run into its timeout.
+type fakeClamd struct {
+	maxLength int
+	reply     func(content []byte) string
+	reset     bool
+}
+
+// stream received by the fake clamd
+type clamdStream struct {
+	chunks  []int
+	content []byte
+}
+
+// starts the fake clamd and returns its address and the streams it received
+func (f fakeClamd) start(t *testing.T) (string, chan clamdStream) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	streams := make(chan clamdStream, 1)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.handle(conn, streams)
+		}
+	}()
+	return "tcp://" + listener.Addr().String(), streams
+}
+
+func (f fakeClamd) handle(conn net.Conn, streams chan clamdStream) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	command, err := r.ReadString('\x00')
+	if err != nil || command != "zINSTREAM\x00" {
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+	if f.reset {
+		conn.(*net.TCPConn).SetLinger(0)
+		return
+	}
+	stream := clamdStream{chunks: []int{}, content: []byte{}}
+	size := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, size); err != nil {
+			return
+		}
+		length := int(binary.BigEndian.Uint32(size))
+		if length == 0 {
+			break
+		}
+		chunk := make([]byte, length)
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return
+		}
+		stream.chunks = append(stream.chunks, length)
+		stream.content = append(stream.content, chunk...)
+		if len(stream.content) > f.maxLength {
+			conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			// the rest of the stream is drained, so that the reply is not dropped by a reset of the connection
+			io.Copy(io.Discard, r)
+			return
+		}
+	}
+	streams <- stream
+	if f.reply == nil {
+		// the scanner closes the connection after its timeout
+		io.Copy(io.Discard, r)
+		return
+	}
+	conn.Write([]byte(f.reply(stream.content) + "\x00"))
+}
+
+// replies like clamd with the eicar signature, if the content contains the marker
+func eicarReply(content []byte) string {
+	if bytes.Contains(content, []byte("EICAR")) {
+		return "stream: Eicar-Signature FOUND"
+	}
+	return "stream: OK"
+}
+
+func TestClamdScannerScan(t *testing.T) {
+	const maxLength = 1024 * 1024
+	tests := []struct {
+		name    string
+		clamd   fakeClamd
+		content []byte
+		want    *Result
+		// the scan fails with this error, or with an error containing this message
+		wantErr     error
+		wantMessage string
+		// chunks streamed to clamd, nil if they are not checked
+		wantChunks []int
+	}{
+		{
+			name:    "clean",
+			clamd:   fakeClamd{maxLength: maxLength, reply: eicarReply},
+			content: []byte("hello world"),
+			want:    &Result{},
+		},
+		{
+			name:    "infected",
+			clamd:   fakeClamd{maxLength: maxLength, reply: eicarReply},
+			content: []byte("X5O!P%@AP[4\\PZX54(P^)7CC)7}$EICAR"),
+			want:    &Result{Infected: true, Signature: "Eicar-Signature"},
+		},
+		{
+			name:       "empty",
+			clamd:      fakeClamd{maxLength: maxLength, reply: eicarReply},
+			content:    []byte{},
+			want:       &Result{},
+			wantChunks: []int{},
+		},
+		{
+			name:       "chunked",
+			clamd:      fakeClamd{maxLength: maxLength, reply: eicarReply},
+			content:    bytes.Repeat([]byte("a"), 2*CLAMD_CHUNK_SIZE_IN_BYTES+10),
+			want:       &Result{},
+			wantChunks: []int{CLAMD_CHUNK_SIZE_IN_BYTES, CLAMD_CHUNK_SIZE_IN_BYTES, 10},
+		},
+		{
+			name:        "size limit exceeded",
+			clamd:       fakeClamd{maxLength: CLAMD_CHUNK_SIZE_IN_BYTES, reply: eicarReply},
+			content:     bytes.Repeat([]byte("a"), 64*CLAMD_CHUNK_SIZE_IN_BYTES),
+			wantErr:     ErrScanFailed,
+			wantMessage: "size limit exceeded",
+		},
+		{
+			name:        "scan error",
+			clamd:       fakeClamd{maxLength: maxLength, reply: func([]byte) string { return "stream: Can't allocate memory ERROR" }},
+			content:     []byte("hello world"),
+			wantErr:     ErrScanFailed,
+			wantMessage: "Can't allocate memory",
+		},
+		{
+			name:        "connection reset",
+			clamd:       fakeClamd{maxLength: maxLength, reset: true},
+			content:     bytes.Repeat([]byte("a"), 16*CLAMD_CHUNK_SIZE_IN_BYTES),
+			wantMessage: "clamd",
+		},
+		{
+			name:        "no reply",
+			clamd:       fakeClamd{maxLength: maxLength},
+			content:     []byte("hello world"),
+			wantMessage: "failed to read reply of clamd",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address, streams := tt.clamd.start(t)
+			s, err := NewClamdScanner(address, 200*time.Millisecond)
+			if err != nil {
+				t.Fatalf("failed to create scanner: %v", err)
+			}
+
+			result, err := s.Scan(bytes.NewReader(tt.content))
+			if tt.wantMessage != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantMessage) {
+					t.Fatalf("got result %+v and error %v, want error containing %q", result, err, tt.wantMessage)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("got error %v, want %v", err, tt.wantErr)
+				}
+				if tt.wantErr == nil && errors.Is(err, ErrScanFailed) {
+					t.Errorf("failure of the connection is reported as failed scan: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *result != *tt.want {
+				t.Errorf("got %+v, want %+v", *result, *tt.want)
+			}
+			stream := <-streams
+			if !bytes.Equal(stream.content, tt.content) {
+				t.Errorf("clamd received %d bytes, want %d", len(stream.content), len(tt.content))
+			}
+			if tt.wantChunks != nil && !equalChunks(stream.chunks, tt.wantChunks) {
+				t.Errorf("got chunks %v, want %v", stream.chunks, tt.wantChunks)
+			}
+		})
+	}
+}
+
+func TestClamdScannerConnectionRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	address := "tcp://" + listener.Addr().String()
+	listener.Close()
+	s, err := NewClamdScanner(address, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+
+	_, err = s.Scan(strings.NewReader("hello world"))
+	if err == nil || !strings.Contains(err.Error(), "failed to connect to clamd") {
+		t.Errorf("got error %v, want failed connection", err)
+	}
+}
+
+func equalChunks(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestNewClamdScanner(t *testing.T) {
+	tests := []struct {
+		address string
+		network string
+		target  string
+		wantErr bool
+	}{
+		{address: "tcp://clamd.internal:3310", network: "tcp", target: "clamd.internal:3310"},
+		{address: "unix:///var/run/clamd.sock", network: "unix", target: "/var/run/clamd.sock"},
+		{address: "http://clamd.internal:3310", wantErr: true},
+		{address: "clamd.internal:3310", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			s, err := NewClamdScanner(tt.address, time.Second)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for %s", tt.address)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			clamd := s.(*clamdScanner)
+			if clamd.network != tt.network || clamd.address != tt.target {
+				t.Errorf("got %s %s, want %s %s", clamd.network, clamd.address, tt.network, tt.target)
+			}
+		})
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	tests := []struct {
+		reply   string
+		want    *Result
+		wantErr bool
+	}{
+		{reply: "stream: OK", want: &Result{}},
+		{reply: "OK", want: &Result{}},
+		{reply: "stream: Win.Test.EICAR_HDB-1 FOUND", want: &Result{Infected: true, Signature: "Win.Test.EICAR_HDB-1"}},
+		{reply: "INSTREAM size limit exceeded. ERROR", wantErr: true},
+		{reply: "stream: Can't allocate memory ERROR", wantErr: true},
+		{reply: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reply, func(t *testing.T) {
+			result, err := parseReply(tt.reply)
+			if tt.wantErr {
+				if !errors.Is(err, ErrScanFailed) {
+					t.Fatalf("got result %+v and error %v, want %v", result, err, ErrScanFailed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *result != *tt.want {
+				t.Errorf("got %+v, want %+v", *result, *tt.want)
+			}
+		})
+	}
+}
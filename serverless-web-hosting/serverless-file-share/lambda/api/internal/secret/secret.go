@@ -0,0 +1,43 @@
+package secret
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	goConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// timeout of reading a secret at cold start
+const SECRETS_MANAGER_TIMEOUT time.Duration = 10 * time.Second
+
+// Resolve returns given value, if it is set, otherwise the value of the secret with given name or arn. It returns
+// an empty value, if neither is set.
+func Resolve(ctx context.Context, value, secretId string) (string, error) {
+	if value != "" || secretId == "" {
+		return value, nil
+	}
+	return GetString(ctx, secretId)
+}
+
+// GetString returns the value of the secret with given name or arn
+func GetString(ctx context.Context, secretId string) (string, error) {
+	cfg, err := goConfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(ctx, SECRETS_MANAGER_TIMEOUT)
+	defer cancel()
+	out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretId),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s: %v", secretId, err)
+	}
+	if aws.ToString(out.SecretString) == "" {
+		return "", fmt.Errorf("secret %s has no string value", secretId)
+	}
+	return *out.SecretString, nil
+}
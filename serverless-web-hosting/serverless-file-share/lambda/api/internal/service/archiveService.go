@@ -0,0 +1,197 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/blobstore"
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/repository"
+	appTypes "github.com/unitypark/serverless-file-share/lambda/api/types"
+	"go.uber.org/zap"
+)
+
+// only a single part of the archive is held in memory, so the archive can grow up to 10000 parts of this size
+const ARCHIVE_PART_SIZE_IN_BYTES int64 = 32 * 1024 * 1024
+
+type ArchiveService interface {
+	PrepareArchive(shareId string) error
+}
+
+type archiveService struct {
+	appConfig  *appConfig.Config
+	repository repository.DynamoDbRepository
+	blobStore  blobstore.BlobStore
+}
+
+// NewArchiveService is used to create a single instance of the service
+func NewArchiveService(c *appConfig.Config, r repository.DynamoDbRepository, b blobstore.BlobStore) ArchiveService {
+	return &archiveService{
+		appConfig:  c,
+		repository: r,
+		blobStore:  b,
+	}
+}
+
+// PrepareArchive streams all objects of the shared folder as zip archive into a multipart upload.
+// The share becomes ACTIVE once the archive is completed, or FAILED if it cannot be built.
+func (s *archiveService) PrepareArchive(shareId string) error {
+	share, err := s.repository.GetShare(shareId)
+	if err != nil {
+		return err
+	}
+	if share.State != appTypes.STATE_PREPARING {
+		zap.L().Info("share is not being prepared", zap.String("shareId", shareId), zap.String("state", share.State))
+		return nil
+	}
+	state := appTypes.STATE_ACTIVE
+	err = s.writeArchive(share.Path, share.ArchivePath)
+	if err != nil {
+		zap.L().Error("failed to prepare archive", zap.String("shareId", shareId), zap.Error(err))
+		state = appTypes.STATE_FAILED
+	}
+	_, err = s.repository.UpdateShareState(shareId, state)
+	if errors.Is(err, repository.ErrNotFound) {
+		zap.L().Info("share is not being prepared anymore", zap.String("shareId", shareId))
+		return nil
+	}
+	return err
+}
+
+func (s *archiveService) writeArchive(folder, archivePath string) error {
+	uploadId, err := s.blobStore.CreateMultipartUpload(archivePath, "application/zip")
+	if err != nil {
+		return err
+	}
+	w := &partWriter{
+		blobStore: s.blobStore,
+		key:       archivePath,
+		uploadId:  uploadId,
+		buf:       make([]byte, 0, ARCHIVE_PART_SIZE_IN_BYTES),
+	}
+	err = s.zipFolder(folder, w)
+	if err == nil {
+		err = w.complete()
+	}
+	if err != nil {
+		abortErr := s.blobStore.AbortMultipartUpload(archivePath, uploadId)
+		if abortErr != nil {
+			zap.L().Error("failed to abort multipart upload", zap.Error(abortErr))
+		}
+		return err
+	}
+	zap.L().Info("archive is prepared", zap.String("archivePath", archivePath), zap.Int("parts", len(w.parts)))
+	return nil
+}
+
+// writes every object under the folder into the zip archive, named relative to the folder
+func (s *archiveService) zipFolder(folder string, w io.Writer) error {
+	archive := zip.NewWriter(w)
+	err := s.blobStore.List(folder, func(object blobstore.ObjectInfo) error {
+		// folders created in the console are empty objects ending with a slash
+		if strings.HasSuffix(object.Key, "/") {
+			return nil
+		}
+		// only files, which are processed and clean, are shared
+		file, err := s.repository.GetFile(object.Key)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		if file == nil || file.State != appTypes.STATE_AVAILABLE {
+			zap.L().Info("skipping file, which is not available", zap.String("path", object.Key))
+			return nil
+		}
+		// the version, which was scanned, is archived, because the object may be overwritten after its scan
+		err = s.zipObject(archive, object.Key, file.VersionId, strings.TrimPrefix(object.Key, folder), object.LastModified)
+		if errors.Is(err, blobstore.ErrNotFound) {
+			zap.L().Info("skipping file, whose scanned version is not found", zap.String("path", object.Key), zap.String("versionId", file.VersionId))
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func (s *archiveService) zipObject(archive *zip.Writer, key, versionId, name string, modified time.Time) error {
+	body, err := s.blobStore.GetVersion(key, versionId)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	}
+	entry, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, body)
+	if err != nil {
+		return fmt.Errorf("failed to archive object %s: %v", key, err)
+	}
+	return nil
+}
+
+// partWriter uploads everything written to it as parts of a multipart upload
+type partWriter struct {
+	blobStore blobstore.BlobStore
+	key       string
+	uploadId  string
+	buf       []byte
+	parts     []blobstore.Part
+}
+
+func (w *partWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+		if len(w.buf) == cap(w.buf) {
+			err := w.flush()
+			if err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *partWriter) flush() error {
+	partNumber := int32(len(w.parts) + 1)
+	if int64(partNumber) > MAX_PART_COUNT {
+		return fmt.Errorf("archive exceeds %d parts", MAX_PART_COUNT)
+	}
+	etag, err := w.blobStore.UploadPart(w.key, w.uploadId, partNumber, bytes.NewReader(w.buf))
+	if err != nil {
+		return err
+	}
+	w.parts = append(w.parts, blobstore.Part{
+		PartNumber: partNumber,
+		ETag:       etag,
+	})
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// uploads the last part and assembles the archive
+func (w *partWriter) complete() error {
+	if len(w.buf) > 0 || len(w.parts) == 0 {
+		err := w.flush()
+		if err != nil {
+			return err
+		}
+	}
+	return w.blobStore.CompleteMultipartUpload(w.key, w.uploadId, w.parts)
+}
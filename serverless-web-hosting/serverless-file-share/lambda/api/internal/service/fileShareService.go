@@ -2,118 +2,886 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"sort"
+	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/accesskey"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/blobstore"
 	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
 	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	passphraseHasher "github.com/unitypark/serverless-file-share/lambda/api/internal/passphrase"
 	"github.com/unitypark/serverless-file-share/lambda/api/internal/repository"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/secret"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/urlsigner"
+	appTypes "github.com/unitypark/serverless-file-share/lambda/api/types"
 	"go.uber.org/zap"
 )
 
+// limits of s3 multipart uploads (https://docs.aws.amazon.com/AmazonS3/latest/userguide/qfacts.html)
+const (
+	MIN_PART_SIZE_IN_BYTES      int64 = 5 * 1024 * 1024
+	DEFAULT_PART_SIZE_IN_BYTES  int64 = 16 * 1024 * 1024
+	MAX_PART_COUNT              int64 = 10000
+	MAX_FILE_SIZE_IN_BYTES      int64 = 5 * 1024 * 1024 * 1024 * 1024
+	MAX_PRESIGNED_PARTS_IN_CALL int   = 100
+	// s3 accepts files of up to 5 GB by a single post, larger files are uploaded in parts
+	MAX_POST_SIZE_IN_BYTES int64 = 5 * 1024 * 1024 * 1024
+)
+
+// protection of shares with passphrase
+const (
+	MAX_PASSPHRASE_LENGTH          int           = 256
+	MAX_FAILED_PASSPHRASE_ATTEMPTS int           = 5
+	PASSPHRASE_LOCK_DURATION       time.Duration = 15 * time.Minute
+)
+
+// urls of previews are only valid for a short time, because they are shown right after they are returned
+const PREVIEW_URL_EXPIRING_TIME time.Duration = 5 * time.Minute
+
 var (
-	s3Client  *s3.Client
-	presigner *s3.PresignClient
+	// ErrInvalidInput is returned, if the request of the client is not acceptable
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrNotFound is returned, if the requested item does not exist or is not visible to the user
+	ErrNotFound = repository.ErrNotFound
+	// ErrWrongPassphrase is returned, if the passphrase of a protected share is missing or wrong
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+	// ErrLocked is returned, if a protected share is locked after too many wrong passphrases
+	ErrLocked = errors.New("share is locked")
+	// ErrNotAvailable is returned, if a file is not processed after its upload yet
+	ErrNotAvailable = errors.New("file is not available")
+	// ErrQuarantined is returned, if malware is found in a file
+	ErrQuarantined = errors.New("file is quarantined")
+	// ErrPreparing is returned, if the archive of a shared folder is not ready to be downloaded yet
+	ErrPreparing = repository.ErrPreparing
+	// ErrForbidden is returned, if the user may not access the requested path
+	ErrForbidden = errors.New("forbidden")
+	// ErrQuotaExceeded is returned, if an upload would exceed the storage quota of the user
+	ErrQuotaExceeded = repository.ErrQuotaExceeded
+	// ErrConsumed is returned, if a one-time share was downloaded before or the download limit of a share is reached
+	ErrConsumed = repository.ErrConsumed
+	// ErrRevoked is returned, if a share was revoked by its sharer
+	ErrRevoked = repository.ErrRevoked
+	// ErrExpired is returned, if the expiring time of a share has passed
+	ErrExpired = repository.ErrExpired
+	// ErrInactive is returned, if a share cannot be downloaded in its state
+	ErrInactive = repository.ErrInactive
+	// ErrRangeNotSatisfiable is returned, if the requested range starts after the end of the shared object
+	ErrRangeNotSatisfiable = blobstore.ErrInvalidRange
+	// ErrNotInProgress is returned, if a multipart upload is completed or aborted already
+	ErrNotInProgress = errors.New("upload is not in progress")
 )
 
+// Content is the object of a share, which is streamed through the api. Body is nil, if the client has the
+// content already, and Range is nil, if the whole object is sent.
+type Content struct {
+	Share  *entities.Asset
+	Object *blobstore.ObjectInfo
+	Range  *blobstore.ByteRange
+	Body   io.ReadCloser
+}
+
 // Service is an interface from which our api module can access our repository of all our models.
 type FileShareService interface {
-	CreateUploadUrl(path string, expiringMinutes int) (*entities.Asset, error)
-	CreateDownloadUrl(path, username string, expiringMinutes int) (*entities.Asset, error)
-	GetUrl(accessKey, username string) (*entities.Asset, error)
+	CreateUploadUrl(path string, identity *entities.Identity, fileSize int64, contentType string, expiringMinutes int) (*entities.Asset, error)
+	GetUploadParts(uploadId string, identity *entities.Identity, expiringMinutes int) (*entities.Asset, error)
+	CompleteUpload(uploadId string, identity *entities.Identity, parts []entities.Part) (*entities.Asset, error)
+	AbortUpload(uploadId string, identity *entities.Identity) (*entities.Asset, error)
+	CreateDownloadUrl(request entities.PostDownloadRequest, identity *entities.Identity) (*entities.Asset, error)
+	GetUrl(accessKey, username, passphrase string) (*entities.Asset, error)
+	GetContent(request entities.ContentRequest, username string) (*Content, error)
+	ListFileVersions(path string, identity *entities.Identity) ([]blobstore.ObjectInfo, error)
+	ListShares(username string, limit int, cursor string) ([]entities.Asset, string, error)
+	GetShare(shareId, username string) (*entities.Asset, error)
+	RevokeShare(shareId, username string) (*entities.Asset, error)
+	ListAccesses(shareId, username string, from, to time.Time, limit int, cursor string) ([]entities.Asset, string, error)
+	ListAllAccesses(from, to time.Time, limit int, cursor string) ([]entities.Asset, string, error)
+	GetUsage(identity *entities.Identity) (*entities.Asset, error)
+	GetQuota(username string) (*entities.Asset, error)
+	SetQuota(username string, quota int64) (*entities.Asset, error)
 }
 
 type fileShareService struct {
 	appConfig  *appConfig.Config
 	repository repository.DynamoDbRepository
+	blobStore  blobstore.BlobStore
+	hasher     *accesskey.Hasher
+	urlSigner  urlsigner.UrlSigner
 }
 
 // NewFileShareService is used to create a single instance of the service
-func NewFileShareService(c *appConfig.Config, r repository.DynamoDbRepository) FileShareService {
+func NewFileShareService(c *appConfig.Config, r repository.DynamoDbRepository, b blobstore.BlobStore) FileShareService {
 	return &fileShareService{
 		appConfig:  c,
 		repository: r,
+		blobStore:  b,
+		hasher:     newHasher(c),
+		urlSigner:  urlsigner.New(c, b),
+	}
+}
+
+// returns the hasher of the access keys. Outside of local mode, the service does not start without the secret of
+// the hasher, so that share ids are never keyed by a known secret.
+func newHasher(c *appConfig.Config) *accesskey.Hasher {
+	accessKeySecret, err := secret.Resolve(context.TODO(), c.AccessKeySecret, c.AccessKeySecretName)
+	if err != nil {
+		zap.L().Panic("failed to read access key secret", zap.Error(err))
+	}
+	if accessKeySecret == "" {
+		zap.L().Panic(fmt.Sprintf("%s or %s must be set", appConfig.ENV_ACCESS_KEY_SECRET, appConfig.ENV_ACCESS_KEY_SECRET_NAME))
 	}
+	return accesskey.NewHasher(accessKeySecret)
 }
 
-func (s *fileShareService) CreateUploadUrl(path string, expiringMinutes int) (*entities.Asset, error) {
-	url, err := s.createS3PresignedPostUrl(path, expiringMinutes)
+// CreateUploadUrl checks the upload against the upload policy of the user's role and reserves its size in the
+// quota of the owner of the path. Files up to 5 GB are uploaded by a presigned post, which enforces size and
+// content type. Larger files are uploaded in parts, for which the presigned urls of the first parts are returned.
+func (s *fileShareService) CreateUploadUrl(path string, identity *entities.Identity, fileSize int64, contentType string, expiringMinutes int) (*entities.Asset, error) {
+	if !identity.CanAccessPath(path) {
+		return nil, fmt.Errorf("%w: uploads are only allowed under %s", ErrForbidden, identity.HomePath())
+	}
+	policy := s.appConfig.UploadPolicy(identity.Role())
+	maxFileSize := policy.MaxFileSize
+	if maxFileSize > MAX_FILE_SIZE_IN_BYTES {
+		maxFileSize = MAX_FILE_SIZE_IN_BYTES
+	}
+	if fileSize <= 0 || fileSize > maxFileSize {
+		return nil, fmt.Errorf("%w: file size must be between 1 and %d bytes", ErrInvalidInput, maxFileSize)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: content type %q is invalid", ErrInvalidInput, contentType)
+	}
+	contentTypePrefix, ok := policy.ContentTypePrefix(mediaType)
+	if !ok {
+		return nil, fmt.Errorf("%w: content type %s is not allowed, allowed are %s", ErrInvalidInput, mediaType, strings.Join(policy.ContentTypes, ", "))
+	}
+	owner, err := s.reserveUsage(path, identity, fileSize)
+	if err != nil {
+		return nil, err
+	}
+
+	fileEntity := new(entities.Asset)
+	fileEntity.InitNewFileAsset(path, identity.Username)
+	err = s.repository.CreateFile(fileEntity)
+	if err == nil && owner != "" {
+		err = s.repository.AddReservation(path, fileSize)
+	}
 	if err != nil {
+		s.freeUsage(owner, fileSize)
 		return nil, err
 	}
-	urlEntity := new(entities.Asset)
-	urlEntity.InitNewUploadAsset(path, *url, expiringMinutes)
-	return urlEntity, nil
+	upload, err := s.createUpload(path, identity, fileSize, mediaType, contentTypePrefix, expiringMinutes)
+	if err != nil {
+		s.releaseUpload(path, fileSize)
+		return nil, err
+	}
+	return upload, nil
+}
+
+// reserves the size of the upload in the usage of the owner of the path, so that concurrent uploads cannot
+// exceed the quota together. The reservation is recorded on the file and settled, when the upload is processed.
+// It returns the owner, in whose usage the size is reserved, or an empty name, if the path is outside of
+// home folders.
+func (s *fileShareService) reserveUsage(path string, identity *entities.Identity, fileSize int64) (string, error) {
+	owner := entities.PathOwner(path)
+	if owner == "" {
+		return "", nil
+	}
+	usage, err := s.repository.GetUsage(owner)
+	if err != nil {
+		return "", err
+	}
+	// admins are not limited by the quota of their role in the home folders of other users
+	quota := usage.Quota
+	if quota == 0 && owner == identity.Username {
+		quota = s.appConfig.UploadPolicy(identity.Role()).Quota
+	}
+	_, err = s.repository.ReserveUsage(owner, fileSize, quota)
+	if err != nil {
+		return "", err
+	}
+	return owner, nil
+}
+
+// releases the reservation of an upload, which is aborted or which failed to be created
+func (s *fileShareService) releaseUpload(path string, fileSize int64) {
+	err := releaseReservation(s.repository, path, fileSize)
+	if err != nil {
+		zap.L().Error("failed to release reservation", zap.String("path", path), zap.Int64("size", fileSize), zap.Error(err))
+	}
+}
+
+func (s *fileShareService) freeUsage(owner string, size int64) {
+	if owner == "" {
+		return
+	}
+	_, err := s.repository.AddUsage(owner, -size)
+	if err != nil {
+		zap.L().Error("failed to free reserved usage", zap.String("username", owner), zap.Int64("size", size), zap.Error(err))
+	}
+}
+
+// releases bytes reserved for uploads of the file and frees them in the usage of the owner of its path. Bytes,
+// which were released already, are not freed twice.
+func releaseReservation(r repository.DynamoDbRepository, path string, size int64) error {
+	owner := entities.PathOwner(path)
+	if owner == "" {
+		return nil
+	}
+	released, err := r.ReleaseReservation(path, size)
+	if err != nil || !released {
+		return err
+	}
+	_, err = r.AddUsage(owner, -size)
+	return err
+}
+
+func (s *fileShareService) createUpload(path string, identity *entities.Identity, fileSize int64, mediaType, contentTypePrefix string, expiringMinutes int) (*entities.Asset, error) {
+	if fileSize <= MAX_POST_SIZE_IN_BYTES {
+		post, err := s.blobStore.PresignPost(blobstore.PostPolicy{
+			Key:               path,
+			ContentType:       mediaType,
+			ContentTypePrefix: contentTypePrefix,
+			MaxContentLength:  fileSize,
+			Expires:           time.Duration(expiringMinutes) * time.Minute,
+		})
+		if err != nil {
+			return nil, err
+		}
+		postEntity := new(entities.Asset)
+		postEntity.InitNewPostAsset(path, identity.Username, mediaType, fileSize, post.Url, post.Fields)
+		return postEntity, nil
+	}
+
+	uploadId, err := s.blobStore.CreateMultipartUpload(path, mediaType)
+	if err != nil {
+		return nil, err
+	}
+	zap.L().Debug("multipart upload is created", zap.String("uploadId", uploadId))
+	uploadEntity := new(entities.Asset)
+	uploadEntity.InitNewUploadAsset(path, uploadId, identity.Username, fileSize, getPartSize(fileSize))
+	createdUpload, err := s.repository.CreateUpload(uploadEntity)
+	if err != nil {
+		return nil, err
+	}
+	err = s.presignPendingParts(createdUpload, expiringMinutes)
+	if err != nil {
+		return nil, err
+	}
+	return createdUpload, nil
+}
+
+// GetUploadParts synchronizes the uploaded parts with s3 and returns presigned urls of the pending parts,
+// so that a client can resume an interrupted upload. The upload is only written, if its parts changed.
+func (s *fileShareService) GetUploadParts(uploadId string, identity *entities.Identity, expiringMinutes int) (*entities.Asset, error) {
+	upload, err := s.getOwnUpload(uploadId, identity)
+	if err != nil {
+		return nil, err
+	}
+	if upload.State != appTypes.STATE_IN_PROGRESS {
+		return upload, nil
+	}
+	parts, err := s.listUploadedParts(upload)
+	if err != nil {
+		return nil, err
+	}
+	if !equalParts(upload.Parts, parts) {
+		upload, err = s.repository.UpdateUpload(uploadId, appTypes.STATE_IN_PROGRESS, parts)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = s.presignPendingParts(upload, expiringMinutes)
+	if err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// CompleteUpload assembles the object from the given parts. If no parts are given, all parts uploaded to s3 are used.
+func (s *fileShareService) CompleteUpload(uploadId string, identity *entities.Identity, parts []entities.Part) (*entities.Asset, error) {
+	upload, err := s.getOwnUpload(uploadId, identity)
+	if err != nil {
+		return nil, err
+	}
+	if upload.State != appTypes.STATE_IN_PROGRESS {
+		return nil, fmt.Errorf("%w: upload is %s", ErrNotInProgress, upload.State)
+	}
+	// presigned urls of parts do not restrict their size, so the declared file size is checked before completing
+	uploadedParts, err := s.listUploadedParts(upload)
+	if err != nil {
+		return nil, err
+	}
+	var uploadedSize int64
+	for _, part := range uploadedParts {
+		uploadedSize += part.Size
+	}
+	if uploadedSize > upload.FileSize {
+		return nil, fmt.Errorf("%w: uploaded %d bytes, but declared %d bytes", ErrInvalidInput, uploadedSize, upload.FileSize)
+	}
+	if len(parts) == 0 {
+		parts = uploadedParts
+	}
+	if len(parts) != int(upload.PartCount) {
+		return nil, fmt.Errorf("expected %d parts, but got %d", upload.PartCount, len(parts))
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	completedParts := make([]blobstore.Part, 0, len(parts))
+	for _, part := range parts {
+		if part.ETag == "" {
+			return nil, fmt.Errorf("etag of part %d is missing", part.PartNumber)
+		}
+		completedParts = append(completedParts, blobstore.Part{
+			PartNumber: part.PartNumber,
+			ETag:       part.ETag,
+		})
+	}
+	err = s.blobStore.CompleteMultipartUpload(upload.Path, upload.UploadId, completedParts)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.UpdateUpload(uploadId, appTypes.STATE_COMPLETED, parts)
+}
+
+// AbortUpload aborts the multipart upload and lets s3 free the storage of the uploaded parts
+func (s *fileShareService) AbortUpload(uploadId string, identity *entities.Identity) (*entities.Asset, error) {
+	upload, err := s.getOwnUpload(uploadId, identity)
+	if err != nil {
+		return nil, err
+	}
+	if upload.State != appTypes.STATE_IN_PROGRESS {
+		return nil, fmt.Errorf("%w: upload is %s", ErrNotInProgress, upload.State)
+	}
+	err = s.blobStore.AbortMultipartUpload(upload.Path, upload.UploadId)
+	if err != nil {
+		return nil, err
+	}
+	s.releaseUpload(upload.Path, upload.FileSize)
+	err = s.repository.DeleteUploadingFile(upload.Path)
+	if err != nil {
+		return nil, err
+	}
+	return s.repository.UpdateUpload(uploadId, appTypes.STATE_ABORTED, upload.Parts)
 }
 
-// Url is a service layer that helps create url in DynamoDB Table
-func (s *fileShareService) CreateDownloadUrl(path, username string, expiringMinutes int) (*entities.Asset, error) {
-	url, err := s.createS3PresignedGetUrl(path, expiringMinutes)
+// Url is a service layer that helps create url in DynamoDB Table. A shared file is pinned to given version,
+// or to its current version, so that its content cannot change after it is shared. A one-time share is
+// downloaded once, and its file is deleted after its url expired, if the sharer asks for it.
+func (s *fileShareService) CreateDownloadUrl(request entities.PostDownloadRequest, identity *entities.Identity) (*entities.Asset, error) {
+	if !identity.CanAccessPath(request.Path) {
+		return nil, fmt.Errorf("%w: shares are only allowed under %s", ErrForbidden, identity.HomePath())
+	}
+	if request.DeleteObject && (!request.OneTime || strings.HasSuffix(request.Path, "/")) {
+		return nil, fmt.Errorf("%w: deleteObject is only allowed for one-time shares of files", ErrInvalidInput)
+	}
+	if request.OneTime {
+		request.MaxDownloads = 1
+	}
+	if request.MaxDownloads <= 0 || request.MaxDownloads > s.appConfig.MaxDownloadCount {
+		return nil, fmt.Errorf("%w: maxDownloads must be between 1 and %d", ErrInvalidInput, s.appConfig.MaxDownloadCount)
+	}
+	if request.ExpiresIn <= 0 || request.ExpiresIn > s.appConfig.MaxDownloadExpiringMinutes {
+		return nil, fmt.Errorf("%w: expiresIn must be between 1 and %d minutes", ErrInvalidInput, s.appConfig.MaxDownloadExpiringMinutes)
+	}
+	if len(request.Passphrase) > MAX_PASSPHRASE_LENGTH {
+		return nil, fmt.Errorf("%w: passphrase must not be longer than %d characters", ErrInvalidInput, MAX_PASSPHRASE_LENGTH)
+	}
+	policy, err := s.urlPolicy(request)
+	if err != nil {
+		return nil, err
+	}
+	var passphraseHash string
+	if request.Passphrase != "" {
+		hash, err := passphraseHasher.Hash(request.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+		passphraseHash = hash
+	}
+	accessKey, err := accesskey.New()
+	if err != nil {
+		return nil, err
+	}
+	shareId := s.hasher.ShareId(accessKey)
+	// a folder is downloaded as zip archive, which is prepared after the share is created
+	downloadPath := request.Path
+	if strings.HasSuffix(request.Path, "/") {
+		if request.VersionId != "" {
+			return nil, fmt.Errorf("%w: versions of folders cannot be shared", ErrInvalidInput)
+		}
+		err = s.checkFolderExists(request.Path)
+		if err != nil {
+			return nil, err
+		}
+		downloadPath = appTypes.ARCHIVE_PREFIX + shareId + ".zip"
+	} else {
+		request.VersionId, err = s.checkVersionAvailable(request.Path, request.VersionId)
+		if err != nil {
+			return nil, err
+		}
+		// only the shared version is deleted, so that the file can be overwritten in the meantime
+		if request.DeleteObject && request.VersionId == "" {
+			return nil, fmt.Errorf("%w: deleteObject requires a versioned bucket", ErrInvalidInput)
+		}
+	}
+	url, err := s.createSignedGetUrl(downloadPath, request.VersionId, policy)
 	if err != nil {
 		return nil, err
 	}
 	urlEntity := new(entities.Asset)
-	urlEntity.InitNewDownloadAsset(path, *url, username, expiringMinutes)
+	urlEntity.InitNewDownloadAsset(shareId, request.Path, *url, identity.Username, passphraseHash, request.ExpiresIn, request.MaxDownloads)
+	urlEntity.VersionId = request.VersionId
+	urlEntity.Notify = request.Notify
+	urlEntity.OneTime = request.OneTime
+	urlEntity.DeleteObject = request.DeleteObject
+	urlEntity.IpAddress = policy.IpAddress
+	if !policy.NotBefore.IsZero() {
+		urlEntity.NotBefore = policy.NotBefore.Format(appTypes.TIME_FORMAT)
+	}
+	if urlEntity.IsFolder() {
+		urlEntity.InitArchive(downloadPath)
+	}
 	createdAssetUrl, err := s.repository.CreateAssetUrl(urlEntity)
 	zap.L().Debug("returned from CreateAssetUrl", zap.Any("item", createdAssetUrl))
 	if err != nil {
 		return nil, err
 	}
+	// the access key is handed out once to the sharer and never stored
+	createdAssetUrl.AccessKey = accessKey
 	return createdAssetUrl, nil
 }
 
 // Url is a service layer that helps to retrieve original url from DynamoDB Table
-func (s *fileShareService) GetUrl(accessKey, username string) (*entities.Asset, error) {
-	url, err := s.repository.GetAssetUrl(accessKey, username)
+func (s *fileShareService) GetUrl(accessKey, username, passphrase string) (*entities.Asset, error) {
+	share, err := s.findShare(accessKey)
+	if err != nil {
+		return nil, err
+	}
+	// shares, which cannot be downloaded anymore, do not count wrong passphrases
+	err = repository.CheckShareValid(share)
+	if err != nil {
+		return nil, err
+	}
+	if share.PassphraseHash != "" {
+		err = s.verifyPassphrase(share, passphrase)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = s.checkShareAvailable(share)
+	if err != nil {
+		return nil, err
+	}
+	url, err := s.repository.GetAssetUrl(share.ShareId(), username)
 	zap.L().Debug("returned from GetAssetUrl", zap.Any("item", url))
 	if err != nil {
 		return nil, err
 	}
+	url.PreviewUrl = s.previewUrl(url)
 	return url, nil
 }
 
-func (s *fileShareService) createS3PresignedGetUrl(path string, expiringMinutes int) (*string, error) {
-	cfg, _ := config.LoadDefaultConfig(context.TODO())
-	if s3Client == nil {
-		s3Client = s3.NewFromConfig(cfg)
+// GetContent opens the object of the share of given access key, so that it is streamed through the api. Like
+// GetUrl, it counts a download of the share, once the object is opened and unless the client has the content already. If the range is not
+// satisfiable, the content is returned with the error, so that the size of the object can be sent.
+func (s *fileShareService) GetContent(request entities.ContentRequest, username string) (*Content, error) {
+	share, err := s.findShare(request.AccessKey)
+	if err != nil {
+		return nil, err
+	}
+	// shares, which cannot be downloaded anymore, do not count wrong passphrases
+	err = repository.CheckShareValid(share)
+	if err != nil {
+		return nil, err
+	}
+	if share.PassphraseHash != "" {
+		err = s.verifyPassphrase(share, request.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = s.checkShareAvailable(share)
+	if err != nil {
+		return nil, err
+	}
+	// the address of the caller is not known behind cloudfront, restricted shares are only downloaded by their url
+	if share.IpAddress != "" {
+		return nil, fmt.Errorf("%w: share is restricted to ip address %s", ErrForbidden, share.IpAddress)
+	}
+	if share.NotBefore != "" && share.NotBefore > entities.GetCurrentUTCTime().Format(appTypes.TIME_FORMAT) {
+		return nil, fmt.Errorf("%w: share is valid from %s", ErrNotAvailable, share.NotBefore)
+	}
+	key, versionId := share.Path, share.VersionId
+	if share.IsFolder() {
+		key, versionId = share.ArchivePath, ""
+	}
+	object, err := s.blobStore.HeadVersion(key, versionId)
+	if err != nil {
+		return nil, err
+	}
+	content := &Content{Share: share, Object: object}
+	// clients revalidating their copy of an active share do not download it again
+	if request.IfNoneMatch != "" && blobstore.MatchesETag(request.IfNoneMatch, object.ETag) && isShareActive(share) {
+		return content, nil
+	}
+	// a range is only sent of the version, which the client has in part, otherwise the whole object is sent
+	if request.IfRange == "" || request.IfRange == object.ETag {
+		content.Range, err = blobstore.ParseRange(request.Range, object.Size)
+		if err != nil {
+			return content, fmt.Errorf("%w: object has %d bytes", ErrRangeNotSatisfiable, object.Size)
+		}
+	}
+	// the object is opened before the download is counted, so that a failed download does not consume the share
+	body, err := s.blobStore.GetRange(key, versionId, content.Range)
+	if err != nil {
+		return nil, err
+	}
+	// every response with content is counted, like every url returned by GetUrl
+	content.Share, err = s.repository.GetAssetUrl(share.ShareId(), username)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	content.Body = body
+	return content, nil
+}
+
+// checks that the object of the share can be downloaded
+func (s *fileShareService) checkShareAvailable(share *entities.Asset) error {
+	// the file may be overwritten by an infected upload after it was shared
+	if !share.IsFolder() {
+		file, err := s.repository.GetFile(share.Path)
+		if err == nil && file.State == appTypes.STATE_QUARANTINED {
+			return fmt.Errorf("%w: malware %s is found", ErrQuarantined, file.ScanResult)
+		}
+	}
+	return nil
+}
+
+// returns the url of the preview of a shared file, if there is a preview of the shared version. The download
+// is not affected by a preview, which cannot be signed, so that failures are only logged.
+func (s *fileShareService) previewUrl(share *entities.Asset) string {
+	if share.IsFolder() {
+		return ""
 	}
-	if presigner == nil {
-		presigner = s3.NewPresignClient(s3Client)
+	file, err := s.repository.GetFile(share.Path)
+	if err != nil || file.PreviewPath == "" || (share.VersionId != "" && share.VersionId != file.VersionId) {
+		return ""
 	}
-	res, err := presigner.PresignGetObject(context.TODO(), &s3.GetObjectInput{
-		Bucket: &s.appConfig.FileshareBucketName,
-		Key:    &path,
-	}, func(opts *s3.PresignOptions) {
-		opts.Expires = time.Duration(expiringMinutes * int(time.Minute))
+	url, err := s.urlSigner.SignGet(file.PreviewPath, "", urlsigner.Policy{
+		ExpiresAt: entities.GetCurrentUTCTime().Add(PREVIEW_URL_EXPIRING_TIME),
 	})
-	zap.L().Debug("presigned url", zap.Any("res", res))
+	if err != nil {
+		zap.L().Warn("failed to sign url of preview", zap.String("previewPath", file.PreviewPath), zap.Error(err))
+		return ""
+	}
+	return url
+}
+
+// returns true, if the share is neither expired nor revoked or consumed
+func isShareActive(share *entities.Asset) bool {
+	if share.State != "" && share.State != appTypes.STATE_ACTIVE {
+		return false
+	}
+	expiredAt, ok := share.ExpiredAt()
+	return ok && entities.GetCurrentUTCTime().Before(expiredAt)
+}
+
+// finds the share of given access key by its HMAC. Legacy shares are stored with the access key itself
+// and are looked up by it, as long as legacy access keys are allowed.
+func (s *fileShareService) findShare(accessKey string) (*entities.Asset, error) {
+	share, err := s.repository.GetShare(s.hasher.ShareId(accessKey))
+	if err == nil || !errors.Is(err, ErrNotFound) {
+		return share, err
+	}
+	if !s.appConfig.AllowLegacyAccessKeys || !accesskey.IsLegacy(accessKey) {
+		return nil, err
+	}
+	zap.L().Info("looking up share of legacy access key")
+	return s.repository.GetShare(accessKey)
+}
+
+// checks the passphrase of a protected share and locks the share after too many wrong attempts
+func (s *fileShareService) verifyPassphrase(share *entities.Asset, passphrase string) error {
+	if share.IsLocked() {
+		return fmt.Errorf("%w until %s", ErrLocked, share.LockedUntil)
+	}
+	if passphrase == "" {
+		return fmt.Errorf("%w: passphrase is required", ErrWrongPassphrase)
+	}
+	ok, err := passphraseHasher.Verify(passphrase, share.PassphraseHash)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+	zap.L().Info("wrong passphrase for share", zap.String("shareId", share.ShareId()))
+	updatedShare, err := s.repository.RecordFailedAttempt(share.ShareId(), MAX_FAILED_PASSPHRASE_ATTEMPTS, PASSPHRASE_LOCK_DURATION)
+	if err != nil {
+		return err
+	}
+	if updatedShare.IsLocked() {
+		return fmt.Errorf("%w until %s", ErrLocked, updatedShare.LockedUntil)
+	}
+	return ErrWrongPassphrase
+}
+
+// ListShares returns a page of the shares created by given user
+func (s *fileShareService) ListShares(username string, limit int, cursor string) ([]entities.Asset, string, error) {
+	shares, nextCursor, err := s.repository.ListShares(username, int32(limit), cursor)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	return shares, nextCursor, err
+}
+
+// GetShare returns the share with given id, if it was created by given user
+func (s *fileShareService) GetShare(shareId, username string) (*entities.Asset, error) {
+	share, err := s.repository.GetShare(shareId)
+	if err != nil {
+		return nil, err
+	}
+	if share.CreatedBy != username {
+		return nil, fmt.Errorf("cannot find share of user with given share id: %w", ErrNotFound)
+	}
+	return share, nil
+}
+
+// RevokeShare invalidates the access key of the share immediately
+func (s *fileShareService) RevokeShare(shareId, username string) (*entities.Asset, error) {
+	return s.repository.RevokeShare(shareId, username)
+}
+
+// ListAccesses returns a page of the downloads of the share with given id, if it was created by given user
+func (s *fileShareService) ListAccesses(shareId, username string, from, to time.Time, limit int, cursor string) ([]entities.Asset, string, error) {
+	if from.After(to) {
+		return nil, "", fmt.Errorf("%w: from must not be after to", ErrInvalidInput)
+	}
+	_, err := s.GetShare(shareId, username)
+	if err != nil {
+		return nil, "", err
+	}
+	accesses, nextCursor, err := s.repository.ListAccesses(shareId, from, to, int32(limit), cursor)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	return accesses, nextCursor, err
+}
+
+// ListAllAccesses returns a page of the downloads of all shares, it is meant for admins only
+func (s *fileShareService) ListAllAccesses(from, to time.Time, limit int, cursor string) ([]entities.Asset, string, error) {
+	if from.After(to) {
+		return nil, "", fmt.Errorf("%w: from must not be after to", ErrInvalidInput)
+	}
+	accesses, nextCursor, err := s.repository.ListAllAccesses(from, to, int32(limit), cursor)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return nil, "", fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	return accesses, nextCursor, err
+}
+
+// GetUsage returns the bytes stored by the user and the quota, which applies to the user
+func (s *fileShareService) GetUsage(identity *entities.Identity) (*entities.Asset, error) {
+	usage, err := s.repository.GetUsage(identity.Username)
+	if err != nil {
+		return nil, err
+	}
+	if usage.Quota == 0 {
+		usage.Quota = s.appConfig.UploadPolicy(identity.Role()).Quota
+	}
+	return usage, nil
+}
+
+// GetQuota returns the usage of any user. Quota is only set, if an admin has set it for the user.
+func (s *fileShareService) GetQuota(username string) (*entities.Asset, error) {
+	return s.repository.GetUsage(username)
+}
+
+// SetQuota sets the quota of any user, a quota of zero restores the quota of the user's role
+func (s *fileShareService) SetQuota(username string, quota int64) (*entities.Asset, error) {
+	if quota < 0 {
+		return nil, fmt.Errorf("%w: quota must not be negative", ErrInvalidInput)
+	}
+	return s.repository.SetQuota(username, quota)
+}
+
+func (s *fileShareService) createSignedGetUrl(path, versionId string, policy urlsigner.Policy) (*string, error) {
+	url, err := s.urlSigner.SignGet(path, versionId, policy)
+	if errors.Is(err, urlsigner.ErrUnsupportedPolicy) {
+		return nil, fmt.Errorf("%w: notBefore and ipAddress require urls signed for cloudfront", ErrInvalidInput)
+	}
+	if err != nil {
+		return nil, err
+	}
+	zap.L().Debug("signed url", zap.String("url", url))
+	return &url, nil
+}
+
+// returns the policy of the url of a share, which expires with the share
+func (s *fileShareService) urlPolicy(request entities.PostDownloadRequest) (urlsigner.Policy, error) {
+	policy := urlsigner.Policy{
+		ExpiresAt: entities.GetCurrentUTCTime().Add(time.Duration(request.ExpiresIn) * time.Minute),
+	}
+	if request.NotBefore != "" {
+		notBefore, err := time.Parse(appTypes.TIME_FORMAT, request.NotBefore)
+		if err != nil || !notBefore.Before(policy.ExpiresAt) {
+			return policy, fmt.Errorf("%w: notBefore must be a time before the share expires", ErrInvalidInput)
+		}
+		policy.NotBefore = notBefore.UTC()
+	}
+	if request.IpAddress != "" {
+		ipAddress, err := urlsigner.ParseIpAddress(request.IpAddress)
+		if err != nil {
+			return policy, fmt.Errorf("%w: ipAddress must be an ip address or cidr", ErrInvalidInput)
+		}
+		policy.IpAddress = ipAddress
+	}
+	return policy, nil
+}
+
+// presigns the urls of the next pending parts. Urls are limited per call to keep the response small.
+func (s *fileShareService) presignPendingParts(upload *entities.Asset, expiringMinutes int) error {
+	pendingParts := upload.PendingParts()
+	if len(pendingParts) > MAX_PRESIGNED_PARTS_IN_CALL {
+		pendingParts = pendingParts[:MAX_PRESIGNED_PARTS_IN_CALL]
+	}
+	for _, part := range pendingParts {
+		url, err := s.blobStore.PresignUploadPart(upload.Path, upload.UploadId, part.PartNumber, time.Duration(expiringMinutes)*time.Minute)
+		if err != nil {
+			return err
+		}
+		part.Url = url
+		upload.Parts = append(upload.Parts, part)
+	}
+	return nil
+}
 
+// ListFileVersions returns the versions of a file, newest first, so that the owner can share an older version
+func (s *fileShareService) ListFileVersions(path string, identity *entities.Identity) ([]blobstore.ObjectInfo, error) {
+	if path == "" || strings.HasSuffix(path, "/") {
+		return nil, fmt.Errorf("%w: path must be a file", ErrInvalidInput)
+	}
+	if !identity.CanAccessPath(path) {
+		return nil, fmt.Errorf("%w: files are only visible under %s", ErrForbidden, identity.HomePath())
+	}
+	versions, err := s.blobStore.ListVersions(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate a pre-signed url: %v", err)
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("cannot find versions of %s: %w", path, ErrNotFound)
 	}
-	return &res.URL, nil
+	return versions, nil
 }
 
-func (s *fileShareService) createS3PresignedPostUrl(path string, expiringMinutes int) (*string, error) {
-	cfg, _ := config.LoadDefaultConfig(context.TODO())
-	if s3Client == nil {
-		s3Client = s3.NewFromConfig(cfg)
+// returns the version to share. Only files, which are processed after their upload, can be shared. Without a
+// version, the processed version is shared. Other versions must exist and must not be quarantined.
+func (s *fileShareService) checkVersionAvailable(path, versionId string) (string, error) {
+	file, err := s.repository.GetFile(path)
+	if err != nil {
+		return "", err
+	}
+	for _, quarantinedVersion := range file.QuarantinedVersions {
+		if versionId == quarantinedVersion {
+			return "", fmt.Errorf("%w: malware is found in version %s", ErrQuarantined, versionId)
+		}
 	}
-	if presigner == nil {
-		presigner = s3.NewPresignClient(s3Client)
+	if versionId == "" || versionId == file.VersionId {
+		if file.State == appTypes.STATE_QUARANTINED {
+			return "", fmt.Errorf("%w: malware %s is found", ErrQuarantined, file.ScanResult)
+		}
+		if file.State != appTypes.STATE_AVAILABLE {
+			return "", fmt.Errorf("%w: file is %s", ErrNotAvailable, file.State)
+		}
+		if file.VersionId != "" {
+			return file.VersionId, nil
+		}
+		// files, which were processed before versions were recorded, are pinned to their current version
+		object, err := s.blobStore.Head(path)
+		if err != nil {
+			return "", err
+		}
+		return object.VersionId, nil
 	}
-	res, err := presigner.PresignPutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket: &s.appConfig.FileshareBucketName,
-		Key:    &path,
-	}, func(opts *s3.PresignOptions) {
-		opts.Expires = time.Duration(expiringMinutes * int(time.Minute))
+	versions, err := s.blobStore.ListVersions(path)
+	if err != nil {
+		return "", err
+	}
+	for _, version := range versions {
+		if version.VersionId == versionId {
+			return versionId, nil
+		}
+	}
+	return "", fmt.Errorf("cannot find version %s of %s: %w", versionId, path, ErrNotFound)
+}
+
+// returns ErrNotFound, if there is no object under given folder
+func (s *fileShareService) checkFolderExists(path string) error {
+	errFound := errors.New("found")
+	err := s.blobStore.List(path, func(object blobstore.ObjectInfo) error {
+		return errFound
 	})
-	zap.L().Debug("presigned url", zap.Any("res", res))
+	if errors.Is(err, errFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("cannot find objects in folder %s: %w", path, ErrNotFound)
+}
+
+// returns the upload of given id, if it was created by the user. Admins may access the uploads of all users.
+func (s *fileShareService) getOwnUpload(uploadId string, identity *entities.Identity) (*entities.Asset, error) {
+	upload, err := s.repository.GetUpload(uploadId)
+	if err != nil {
+		return nil, err
+	}
+	if !identity.IsAdmin && upload.CreatedBy != identity.Username {
+		return nil, fmt.Errorf("%w: upload %s was created by another user", ErrForbidden, uploadId)
+	}
+	return upload, nil
+}
 
+func (s *fileShareService) listUploadedParts(upload *entities.Asset) ([]entities.Part, error) {
+	uploadedParts, err := s.blobStore.ListParts(upload.Path, upload.UploadId)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate a pre-signed url: %v", err)
+		return nil, err
+	}
+	parts := make([]entities.Part, 0, len(uploadedParts))
+	for _, part := range uploadedParts {
+		parts = append(parts, entities.Part{
+			PartNumber: part.PartNumber,
+			ETag:       part.ETag,
+			Size:       part.Size,
+		})
+	}
+	return parts, nil
+}
+
+// returns true, if both lists contain the same parts in the same order
+func equalParts(a, b []entities.Part) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// returns the smallest part size, which is not smaller than default and fits the file into the max part count
+func getPartSize(fileSize int64) int64 {
+	partSize := DEFAULT_PART_SIZE_IN_BYTES
+	for partSize*MAX_PART_COUNT < fileSize {
+		partSize += MIN_PART_SIZE_IN_BYTES
 	}
-	return &res.URL, nil
+	return partSize
 }
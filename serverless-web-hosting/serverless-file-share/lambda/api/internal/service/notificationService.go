@@ -0,0 +1,54 @@
+package service
+
+import (
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/notifier"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/repository"
+	"go.uber.org/zap"
+)
+
+type NotificationService interface {
+	NotifyAccess(access *entities.Asset) error
+}
+
+type notificationService struct {
+	repository repository.DynamoDbRepository
+	notifier   notifier.Notifier
+}
+
+// NewNotificationService is used to create a single instance of the service
+func NewNotificationService(r repository.DynamoDbRepository, n notifier.Notifier) NotificationService {
+	return &notificationService{
+		repository: r,
+		notifier:   n,
+	}
+}
+
+// NotifyAccess notifies the owner of the share about the download, if the owner opted in when sharing.
+// It runs outside of the download, an error lets the delivery be retried.
+func (s *notificationService) NotifyAccess(access *entities.Asset) error {
+	share, err := s.repository.GetShare(access.ShareId())
+	if err != nil {
+		return err
+	}
+	if !share.Notify {
+		zap.L().Info("owner is not notified about downloads of the share", zap.String("shareId", share.ShareId()))
+		return nil
+	}
+	err = s.notifier.Notify(&notifier.Notification{
+		Id:            access.AccessId(),
+		ShareId:       share.ShareId(),
+		Owner:         share.CreatedBy,
+		Path:          share.Path,
+		Filename:      share.Filename,
+		AccessedBy:    access.AccessedBy,
+		AccessedAt:    access.AccessedAt,
+		DownloadCount: share.DownloadCount,
+		MaxDownloads:  share.MaxDownloads,
+	})
+	if err != nil {
+		return err
+	}
+	zap.L().Info("owner is notified about download", zap.String("shareId", share.ShareId()), zap.String("accessId", access.AccessId()))
+	return nil
+}
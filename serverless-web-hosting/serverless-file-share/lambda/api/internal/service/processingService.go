@@ -0,0 +1,230 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/blobstore"
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/preview"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/repository"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/scanner"
+	appTypes "github.com/unitypark/serverless-file-share/lambda/api/types"
+	"go.uber.org/zap"
+)
+
+// http.DetectContentType considers at most this many bytes
+const SNIFF_LENGTH_IN_BYTES int = 512
+
+// timeout of connecting to clamd and of each read and write of the scan
+const CLAMD_TIMEOUT time.Duration = 30 * time.Second
+
+// scan results of files, which are not infected
+const (
+	SCAN_RESULT_CLEAN   string = "CLEAN"
+	SCAN_RESULT_SKIPPED string = "SKIPPED"
+)
+
+type ProcessingService interface {
+	ProcessObject(path, versionId string) (*entities.Asset, error)
+	RemoveObject(path string) error
+}
+
+type processingService struct {
+	appConfig  *appConfig.Config
+	repository repository.DynamoDbRepository
+	blobStore  blobstore.BlobStore
+	scanner    scanner.Scanner
+	scanResult string
+}
+
+// NewProcessingService is used to create a single instance of the service. Uploads are scanned by clamd,
+// if its address is configured.
+func NewProcessingService(c *appConfig.Config, r repository.DynamoDbRepository, b blobstore.BlobStore) (ProcessingService, error) {
+	if c.ClamdAddress == "" {
+		zap.L().Warn("clamd address is not configured, uploads are not scanned for malware")
+		return &processingService{
+			appConfig:  c,
+			repository: r,
+			blobStore:  b,
+			scanner:    scanner.NewNoopScanner(),
+			scanResult: SCAN_RESULT_SKIPPED,
+		}, nil
+	}
+	clamd, err := scanner.NewClamdScanner(c.ClamdAddress, CLAMD_TIMEOUT)
+	if err != nil {
+		return nil, err
+	}
+	return &processingService{
+		appConfig:  c,
+		repository: r,
+		blobStore:  b,
+		scanner:    clamd,
+		scanResult: SCAN_RESULT_CLEAN,
+	}, nil
+}
+
+// ProcessObject reads the uploaded version of the object once to scan it and to compute its checksum, size and
+// real content type. A clean file becomes AVAILABLE for sharing, an infected file is QUARANTINED. The latest
+// version is processed, if the version is not known. If the upload was not started over the api, the owner of the
+// home folder of the path is recorded as uploader, because the principal of the s3 event is not a user of the file
+// share. Images and pdfs, which are available, are read again to generate their preview.
+func (s *processingService) ProcessObject(path, versionId string) (*entities.Asset, error) {
+	latest, err := s.blobStore.Head(path)
+	if err != nil {
+		return nil, err
+	}
+	if versionId == "" {
+		versionId = latest.VersionId
+	}
+	object, err := s.blobStore.GetVersion(path, versionId)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	var (
+		hash    = sha256.New()
+		counter = new(byteCounter)
+		body    = io.TeeReader(object, io.MultiWriter(hash, counter))
+		head    = make([]byte, SNIFF_LENGTH_IN_BYTES)
+	)
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read object %s: %v", path, err)
+	}
+	// the scanner reads the whole object, so that checksum and size are computed along the way
+	result, err := s.scanner.Scan(io.MultiReader(bytes.NewReader(head[:n]), body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan object %s: %v", path, err)
+	}
+
+	file := new(entities.Asset)
+	file.Path = path
+	file.VersionId = versionId
+	file.State = appTypes.STATE_AVAILABLE
+	file.ScanResult = s.scanResult
+	if result.Infected {
+		zap.L().Warn("file is quarantined", zap.String("path", path), zap.String("versionId", versionId), zap.String("signature", result.Signature))
+		file.State = appTypes.STATE_QUARANTINED
+		file.ScanResult = result.Signature
+	}
+	// a version, which is overwritten before it is processed, does not replace the record of the newer version
+	if versionId != latest.VersionId {
+		zap.L().Info("version is superseded", zap.String("path", path), zap.String("versionId", versionId), zap.Bool("infected", result.Infected))
+		if result.Infected {
+			return nil, s.repository.AddQuarantinedVersion(path, versionId)
+		}
+		return nil, nil
+	}
+	file.FileSize = counter.n
+	file.ContentType = http.DetectContentType(head[:n])
+	file.Sha256 = hex.EncodeToString(hash.Sum(nil))
+	file.UploadedBy = entities.PathOwner(path)
+	file.ProcessedAt = entities.GetCurrentUTCTime().Format(appTypes.TIME_FORMAT)
+	// an overwritten file frees the storage of its previous version
+	var previousSize int64
+	previousFile, err := s.repository.GetFile(path)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if previousFile != nil && previousFile.ProcessedAt != "" {
+		previousSize = previousFile.FileSize
+	}
+	if file.State == appTypes.STATE_AVAILABLE && preview.Supports(file.ContentType) && file.FileSize <= preview.MAX_SOURCE_SIZE_IN_BYTES {
+		file.PreviewPath = s.putPreview(path, versionId, file.ContentType)
+	}
+	processedFile, err := s.repository.UpdateProcessedFile(file)
+	if err != nil {
+		return nil, err
+	}
+	// the preview of the previous version is not shown for a version, of which no preview is generated
+	if previousFile != nil && previousFile.PreviewPath != "" && processedFile.PreviewPath == "" {
+		s.deletePreview(previousFile.PreviewPath)
+	}
+	zap.L().Info("file is processed", zap.String("path", path), zap.String("state", processedFile.State), zap.Int64("size", processedFile.FileSize), zap.String("contentType", processedFile.ContentType))
+	// the size reserved by the upload is replaced by the size of the processed file
+	if previousFile != nil && previousFile.ReservedBytes > 0 {
+		err = releaseReservation(s.repository, path, previousFile.ReservedBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if delta := processedFile.FileSize - previousSize; delta != 0 && processedFile.UploadedBy != "" {
+		_, err = s.repository.AddUsage(processedFile.UploadedBy, delta)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return processedFile, nil
+}
+
+// RemoveObject forgets a file, which is deleted from the bucket, and frees the storage of its uploader
+func (s *processingService) RemoveObject(path string) error {
+	deletedFile, err := s.repository.DeleteFile(path)
+	if errors.Is(err, repository.ErrNotFound) {
+		zap.L().Info("deleted file is not recorded", zap.String("path", path))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	zap.L().Info("file is deleted", zap.String("path", path), zap.Int64("size", deletedFile.FileSize))
+	if deletedFile.PreviewPath != "" {
+		s.deletePreview(deletedFile.PreviewPath)
+	}
+	if deletedFile.ProcessedAt == "" || deletedFile.UploadedBy == "" || deletedFile.FileSize == 0 {
+		return nil
+	}
+	_, err = s.repository.AddUsage(deletedFile.UploadedBy, -deletedFile.FileSize)
+	return err
+}
+
+// generates the preview of given version of a file and returns its key. A file without preview is shared all
+// the same, so that failures are only logged and an empty key is returned.
+func (s *processingService) putPreview(path, versionId, contentType string) string {
+	object, err := s.blobStore.GetVersion(path, versionId)
+	if err != nil {
+		zap.L().Warn("failed to read object for preview", zap.String("path", path), zap.Error(err))
+		return ""
+	}
+	defer object.Close()
+	thumbnail, err := preview.Generate(object, contentType)
+	if err != nil {
+		zap.L().Info("no preview is generated", zap.String("path", path), zap.String("contentType", contentType), zap.Error(err))
+		return ""
+	}
+	// the preview of a file is replaced by the preview of its next version
+	previewPath := appTypes.PREVIEW_PREFIX + path + ".jpg"
+	err = s.blobStore.PutObject(previewPath, preview.CONTENT_TYPE, bytes.NewReader(thumbnail))
+	if err != nil {
+		zap.L().Warn("failed to store preview", zap.String("path", path), zap.Error(err))
+		return ""
+	}
+	zap.L().Info("preview is generated", zap.String("path", path), zap.String("previewPath", previewPath), zap.Int("size", len(thumbnail)))
+	return previewPath
+}
+
+func (s *processingService) deletePreview(previewPath string) {
+	err := s.blobStore.Delete(previewPath)
+	if err != nil && !errors.Is(err, blobstore.ErrNotFound) {
+		zap.L().Warn("failed to delete preview", zap.String("previewPath", previewPath), zap.Error(err))
+	}
+}
+
+// byteCounter counts the bytes written to it
+type byteCounter struct {
+	n int64
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/blobstore"
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/repository"
+	appTypes "github.com/unitypark/serverless-file-share/lambda/api/types"
+	"go.uber.org/zap"
+)
+
+// SweepResult counts what is cleaned up by a sweep, or what would be cleaned up by a dry run
+type SweepResult struct {
+	DryRun         bool  `json:"dryRun"`
+	DeletedObjects int   `json:"deletedObjects"`
+	DeletedBytes   int64 `json:"deletedBytes"`
+	AbortedUploads int   `json:"abortedUploads"`
+	BurnedObjects  int   `json:"burnedObjects"`
+	UpdatedTtls    int   `json:"updatedTtls"`
+	Failures       int   `json:"failures"`
+	// reservations of uploads, which were never processed within the retention of uploads
+	ReleasedReservations int `json:"releasedReservations"`
+}
+
+type SweeperService interface {
+	Sweep(dryRun bool) (*SweepResult, error)
+}
+
+type sweeperService struct {
+	appConfig  *appConfig.Config
+	repository repository.DynamoDbRepository
+	blobStore  blobstore.BlobStore
+}
+
+// NewSweeperService is used to create a single instance of the service
+func NewSweeperService(c *appConfig.Config, r repository.DynamoDbRepository, b blobstore.BlobStore) SweeperService {
+	return &sweeperService{
+		appConfig:  c,
+		repository: r,
+		blobStore:  b,
+	}
+}
+
+// Sweep cleans up according to the retention policy. Uploads, which are in progress for longer than their retention,
+// are aborted. Files are deleted, once they were processed and all shares of them or of their folders expired for
+// longer than the retention of files. Records of files, which are not tracked by the table, are kept. Sizes, which
+// are reserved for uploads for longer than the retention of uploads, are released.
+// Items, which were written without ttl, get the ttl of their type. Archives are not swept, they expire by the
+// lifecycle of the bucket. A dry run only logs what would be done.
+func (s *sweeperService) Sweep(dryRun bool) (*SweepResult, error) {
+	var (
+		now      = entities.GetCurrentUTCTime()
+		policy   = s.appConfig.RetentionPolicy
+		result   = &SweepResult{DryRun: dryRun}
+		lastUses = map[string]time.Time{}
+		files    = []*entities.Asset{}
+	)
+	if policy.ShareDays > 0 && policy.ShareDays < policy.FileDays {
+		zap.L().Warn("shares are deleted before the retention of their files passed, files are deleted after their upload only", zap.Int("shareDays", policy.ShareDays), zap.Int("fileDays", policy.FileDays))
+	}
+	err := s.repository.ScanAssets([]string{appTypes.TYPE_SHARE, appTypes.TYPE_ACCESS, appTypes.TYPE_UPLOAD, appTypes.TYPE_FILE}, func(asset *entities.Asset) error {
+		if asset.Ttl == 0 && policy.Ttl(asset) != 0 {
+			result.UpdatedTtls++
+			if !dryRun {
+				s.count(result, s.repository.UpdateTtl(asset), "failed to update ttl", zap.String("pk", asset.PK), zap.String("sk", asset.SK))
+			}
+		}
+		switch asset.Type {
+		case appTypes.TYPE_FILE:
+			files = append(files, asset)
+		case appTypes.TYPE_SHARE:
+			// shares, whose expiring time cannot be read, keep their files
+			expiredAt, ok := asset.ExpiredAt()
+			if !ok {
+				expiredAt = now
+			}
+			if expiredAt.After(lastUses[asset.Path]) {
+				lastUses[asset.Path] = expiredAt
+			}
+			if asset.DeleteObject && asset.ObjectDeletedAt == "" && isUrlExpired(asset, now) {
+				zap.L().Info("deleting object of one-time share", zap.String("shareId", asset.ShareId()), zap.String("path", asset.Path), zap.String("versionId", asset.VersionId), zap.Bool("dryRun", dryRun))
+				result.BurnedObjects++
+				if !dryRun {
+					s.count(result, s.burnObject(asset), "failed to delete object of one-time share", zap.String("shareId", asset.ShareId()))
+				}
+			}
+		case appTypes.TYPE_UPLOAD:
+			startedAt, ok := asset.ExpiredAt()
+			if !ok || asset.State != appTypes.STATE_IN_PROGRESS || policy.UploadDays == 0 ||
+				now.Sub(startedAt) < time.Duration(policy.UploadDays)*24*time.Hour {
+				return nil
+			}
+			zap.L().Info("aborting upload", zap.String("uploadId", asset.UploadId), zap.String("path", asset.Path), zap.Bool("dryRun", dryRun))
+			result.AbortedUploads++
+			if !dryRun {
+				s.count(result, s.abortUpload(asset), "failed to abort upload", zap.String("uploadId", asset.UploadId))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	fileRetention := policy.Retention(appTypes.TYPE_FILE)
+	for _, file := range files {
+		if isReservationStale(file, policy, now) {
+			zap.L().Info("releasing stale reservation", zap.String("path", file.Path), zap.Int64("size", file.ReservedBytes), zap.String("reservedAt", file.ReservedAt), zap.Bool("dryRun", dryRun))
+			result.ReleasedReservations++
+			if !dryRun {
+				s.count(result, s.releaseStaleReservation(file), "failed to release stale reservation", zap.String("path", file.Path))
+			}
+		}
+		// files, which are not processed yet, have no object to delete
+		processedAt, err := time.Parse(appTypes.TIME_FORMAT, file.ProcessedAt)
+		if err != nil || fileRetention <= 0 {
+			continue
+		}
+		lastUse := processedAt
+		for _, path := range sharedPaths(file.Path) {
+			if lastUses[path].After(lastUse) {
+				lastUse = lastUses[path]
+			}
+		}
+		if now.Sub(lastUse) < fileRetention {
+			continue
+		}
+		zap.L().Info("deleting unused file", zap.String("path", file.Path), zap.Time("lastUse", lastUse), zap.Bool("dryRun", dryRun))
+		result.DeletedObjects++
+		result.DeletedBytes += file.FileSize
+		if !dryRun {
+			// the record of the file and the usage of the uploader are updated by the processor
+			s.count(result, s.blobStore.Delete(file.Path), "failed to delete file", zap.String("path", file.Path))
+		}
+	}
+	if fileRetention <= 0 {
+		zap.L().Info("files are kept forever")
+	}
+	zap.L().Info("sweep is finished", zap.Any("result", result))
+	return result, sweepError(result)
+}
+
+// returns true, if the size reserved for uploads of the file was reserved for longer than the retention of
+// uploads, e.g. by a presigned post, which was never used
+func isReservationStale(file *entities.Asset, policy appConfig.RetentionPolicy, now time.Time) bool {
+	if file.ReservedBytes <= 0 || policy.UploadDays == 0 {
+		return false
+	}
+	reservedAt, err := time.Parse(appTypes.TIME_FORMAT, file.ReservedAt)
+	return err == nil && now.Sub(reservedAt) >= time.Duration(policy.UploadDays)*24*time.Hour
+}
+
+// releases the reservation of the file and removes its record, if it was never processed
+func (s *sweeperService) releaseStaleReservation(file *entities.Asset) error {
+	err := releaseReservation(s.repository, file.Path, file.ReservedBytes)
+	if err != nil {
+		return err
+	}
+	if file.ProcessedAt != "" {
+		return nil
+	}
+	return s.repository.DeleteUploadingFile(file.Path)
+}
+
+func (s *sweeperService) abortUpload(upload *entities.Asset) error {
+	err := s.blobStore.AbortMultipartUpload(upload.Path, upload.UploadId)
+	if err != nil && !errors.Is(err, blobstore.ErrNotFound) {
+		return err
+	}
+	err = releaseReservation(s.repository, upload.Path, upload.FileSize)
+	if err != nil {
+		return err
+	}
+	err = s.repository.DeleteUploadingFile(upload.Path)
+	if err != nil {
+		return err
+	}
+	_, err = s.repository.UpdateUpload(upload.UploadId, appTypes.STATE_ABORTED, upload.Parts)
+	return err
+}
+
+// deletes the shared version of the file, other versions and later uploads to the path are kept
+func (s *sweeperService) burnObject(share *entities.Asset) error {
+	err := s.blobStore.DeleteVersion(share.Path, share.VersionId)
+	if err != nil {
+		return err
+	}
+	return s.repository.SetObjectDeleted(share.ShareId())
+}
+
+// a single failure does not stop the sweep, it is counted and logged
+func (s *sweeperService) count(result *SweepResult, err error, msg string, fields ...zap.Field) {
+	if err == nil {
+		return
+	}
+	result.Failures++
+	zap.L().Error(msg, append(fields, zap.Error(err))...)
+}
+
+func sweepError(result *SweepResult) error {
+	if result.Failures > 0 {
+		return fmt.Errorf("sweep failed %d times", result.Failures)
+	}
+	return nil
+}
+
+// returns true, if the presigned url of the share cannot be used anymore. Revoking a share does not
+// invalidate its url, which is signed until the share expires.
+func isUrlExpired(share *entities.Asset, now time.Time) bool {
+	expiringAt, err := time.Parse(appTypes.TIME_FORMAT, share.ExpiringAt)
+	return err == nil && !now.Before(expiringAt)
+}
+
+// returns the paths, whose shares include the object at given key: the key itself and all of its folders
+func sharedPaths(key string) []string {
+	paths := []string{key}
+	for i := range key {
+		if key[i] == '/' {
+			paths = append(paths, key[:i+1])
+		}
+	}
+	return paths
+}
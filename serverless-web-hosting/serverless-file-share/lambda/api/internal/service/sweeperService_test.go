@@ -0,0 +1,231 @@
+package service
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/blobstore"
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/entities"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/repository"
+	appTypes "github.com/unitypark/serverless-file-share/lambda/api/types"
+)
+
+// sweepRepository serves the items of the table to the sweeper and records, what the sweeper changes
+type sweepRepository struct {
+	repository.DynamoDbRepository
+	assets         []*entities.Asset
+	releasedBytes  map[string]int64
+	usageDeltas    map[string]int64
+	deletedUploads []string
+	updatedTtls    int
+}
+
+func (r *sweepRepository) ScanAssets(itemTypes []string, fn func(asset *entities.Asset) error) error {
+	for _, asset := range r.assets {
+		for _, itemType := range itemTypes {
+			if asset.Type != itemType {
+				continue
+			}
+			copied := *asset
+			if err := fn(&copied); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *sweepRepository) UpdateTtl(asset *entities.Asset) error {
+	r.updatedTtls++
+	return nil
+}
+
+func (r *sweepRepository) ReleaseReservation(path string, size int64) (bool, error) {
+	r.releasedBytes[path] += size
+	return true, nil
+}
+
+func (r *sweepRepository) AddUsage(username string, delta int64) (*entities.Asset, error) {
+	r.usageDeltas[username] += delta
+	return &entities.Asset{Username: username}, nil
+}
+
+func (r *sweepRepository) DeleteUploadingFile(path string) error {
+	r.deletedUploads = append(r.deletedUploads, path)
+	return nil
+}
+
+// sweepBlobStore records the objects, which are deleted by the sweeper
+type sweepBlobStore struct {
+	blobstore.BlobStore
+	deleted []string
+}
+
+func (b *sweepBlobStore) Delete(key string) error {
+	b.deleted = append(b.deleted, key)
+	return nil
+}
+
+func daysAgo(now time.Time, days int) string {
+	return now.Add(-time.Duration(days) * 24 * time.Hour).Format(appTypes.TIME_FORMAT)
+}
+
+func processedFile(path string, processedAt string) *entities.Asset {
+	return &entities.Asset{
+		PK:          appTypes.FILE_PREFIX + path,
+		SK:          appTypes.TYPE_FILE,
+		Type:        appTypes.TYPE_FILE,
+		Path:        path,
+		State:       appTypes.STATE_AVAILABLE,
+		FileSize:    100,
+		UploadedBy:  "alice",
+		ProcessedAt: processedAt,
+	}
+}
+
+func expiredShare(path string, expiringAt string) *entities.Asset {
+	return &entities.Asset{
+		PK:         appTypes.KEY_PREFIX + "share-" + path,
+		SK:         appTypes.TYPE_SHARE,
+		Type:       appTypes.TYPE_SHARE,
+		Path:       path,
+		ExpiringAt: expiringAt,
+		Ttl:        1,
+	}
+}
+
+func TestSweepDeletesUnusedFiles(t *testing.T) {
+	now := entities.GetCurrentUTCTime()
+	policy := appConfig.RetentionPolicy{ShareDays: 30, AccessDays: 365, UploadDays: 7, FileDays: 30}
+	tests := []struct {
+		name        string
+		assets      []*entities.Asset
+		dryRun      bool
+		wantDeleted []string
+		// files, which are counted as deleted, also in a dry run
+		wantCount int
+	}{
+		{
+			name:        "unshared file older than retention",
+			assets:      []*entities.Asset{processedFile("users/alice/old.pdf", daysAgo(now, 31))},
+			wantDeleted: []string{"users/alice/old.pdf"},
+			wantCount:   1,
+		},
+		{
+			name:   "unshared file within retention",
+			assets: []*entities.Asset{processedFile("users/alice/new.pdf", daysAgo(now, 10))},
+		},
+		{
+			name: "file shared recently",
+			assets: []*entities.Asset{
+				processedFile("users/alice/shared.pdf", daysAgo(now, 60)),
+				expiredShare("users/alice/shared.pdf", daysAgo(now, 5)),
+			},
+		},
+		{
+			name: "file in folder shared recently",
+			assets: []*entities.Asset{
+				processedFile("users/alice/folder/report.pdf", daysAgo(now, 60)),
+				expiredShare("users/alice/folder/", daysAgo(now, 5)),
+			},
+		},
+		{
+			name: "file, whose share expired before retention",
+			assets: []*entities.Asset{
+				processedFile("users/alice/expired.pdf", daysAgo(now, 90)),
+				expiredShare("users/alice/expired.pdf", daysAgo(now, 31)),
+			},
+			wantDeleted: []string{"users/alice/expired.pdf"},
+			wantCount:   1,
+		},
+		{
+			name:      "dry run",
+			assets:    []*entities.Asset{processedFile("users/alice/old.pdf", daysAgo(now, 31))},
+			dryRun:    true,
+			wantCount: 1,
+		},
+		{
+			name: "file, which is not processed yet",
+			assets: []*entities.Asset{{
+				PK: appTypes.FILE_PREFIX + "users/alice/uploading.pdf", SK: appTypes.TYPE_FILE, Type: appTypes.TYPE_FILE,
+				Path: "users/alice/uploading.pdf", State: appTypes.STATE_UPLOADING, CreatedAt: daysAgo(now, 60),
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &sweepRepository{assets: tt.assets, releasedBytes: map[string]int64{}, usageDeltas: map[string]int64{}}
+			b := &sweepBlobStore{}
+			s := NewSweeperService(&appConfig.Config{RetentionPolicy: policy}, r, b)
+
+			result, err := s.Sweep(tt.dryRun)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !equalStrings(b.deleted, tt.wantDeleted) {
+				t.Errorf("got deleted objects %v, want %v", b.deleted, tt.wantDeleted)
+			}
+			if result.DeletedObjects != tt.wantCount || result.DeletedBytes != int64(tt.wantCount)*100 {
+				t.Errorf("got %d deleted objects of %d bytes, want %d objects", result.DeletedObjects, result.DeletedBytes, tt.wantCount)
+			}
+			if r.updatedTtls != 0 {
+				t.Errorf("ttl is set on %d items, files are kept without ttl", r.updatedTtls)
+			}
+		})
+	}
+}
+
+func TestSweepReleasesStaleReservations(t *testing.T) {
+	now := entities.GetCurrentUTCTime()
+	policy := appConfig.RetentionPolicy{ShareDays: 30, AccessDays: 365, UploadDays: 7, FileDays: 30}
+	// a presigned post, which was never used, and an overwrite of a processed file, which was never used
+	unused := &entities.Asset{
+		PK: appTypes.FILE_PREFIX + "users/alice/unused.pdf", SK: appTypes.TYPE_FILE, Type: appTypes.TYPE_FILE,
+		Path: "users/alice/unused.pdf", State: appTypes.STATE_UPLOADING, CreatedAt: daysAgo(now, 8),
+		ReservedBytes: 300, ReservedAt: daysAgo(now, 8),
+	}
+	overwritten := processedFile("users/alice/overwritten.pdf", daysAgo(now, 10))
+	overwritten.ReservedBytes, overwritten.ReservedAt = 200, daysAgo(now, 8)
+	pending := processedFile("users/alice/pending.pdf", daysAgo(now, 10))
+	pending.ReservedBytes, pending.ReservedAt = 50, daysAgo(now, 1)
+	r := &sweepRepository{
+		assets:        []*entities.Asset{unused, overwritten, pending},
+		releasedBytes: map[string]int64{},
+		usageDeltas:   map[string]int64{},
+	}
+	s := NewSweeperService(&appConfig.Config{RetentionPolicy: policy}, r, &sweepBlobStore{})
+
+	result, err := s.Sweep(false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.ReleasedReservations != 2 {
+		t.Errorf("got %d released reservations, want 2", result.ReleasedReservations)
+	}
+	if r.releasedBytes[unused.Path] != 300 || r.releasedBytes[overwritten.Path] != 200 || r.releasedBytes[pending.Path] != 0 {
+		t.Errorf("got released bytes %v", r.releasedBytes)
+	}
+	if r.usageDeltas["alice"] != -500 {
+		t.Errorf("got usage delta %d, want -500", r.usageDeltas["alice"])
+	}
+	if !equalStrings(r.deletedUploads, []string{unused.Path}) {
+		t.Errorf("got deleted records %v, want only the record of the unprocessed file", r.deletedUploads)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string{}, a...), append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,162 @@
+package urlsigner
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// query parameters of cloudfront signed urls
+// (https://docs.aws.amazon.com/AmazonCloudFront/latest/DeveloperGuide/private-content-creating-signed-url-canned-policy.html)
+const (
+	QUERY_EXPIRES     string = "Expires"
+	QUERY_POLICY      string = "Policy"
+	QUERY_SIGNATURE   string = "Signature"
+	QUERY_KEY_PAIR_ID string = "Key-Pair-Id"
+	QUERY_VERSION_ID  string = "versionId"
+)
+
+// cloudfront replaces the characters of base64, which are invalid in query strings
+var cloudFrontEncoding = strings.NewReplacer("+", "-", "=", "_", "/", "~")
+
+// CloudFrontSigner signs urls of a distribution, whose behavior trusts the key group of the key pair. Urls, which
+// expire only, are signed with a canned policy, other urls with a custom policy.
+type CloudFrontSigner struct {
+	domain     string
+	keyPairId  string
+	privateKey *rsa.PrivateKey
+}
+
+type cloudFrontPolicy struct {
+	Statement []cloudFrontStatement `json:"Statement"`
+}
+
+type cloudFrontStatement struct {
+	Resource  string              `json:"Resource"`
+	Condition cloudFrontCondition `json:"Condition"`
+}
+
+// the order of the conditions is given by cloudfront, canned policies only have DateLessThan
+type cloudFrontCondition struct {
+	DateLessThan    epochTime  `json:"DateLessThan"`
+	DateGreaterThan *epochTime `json:"DateGreaterThan,omitempty"`
+	IpAddress       *sourceIp  `json:"IpAddress,omitempty"`
+}
+
+type epochTime struct {
+	EpochTime int64 `json:"AWS:EpochTime"`
+}
+
+type sourceIp struct {
+	SourceIp string `json:"AWS:SourceIp"`
+}
+
+// NewCloudFrontSigner returns the signer of the distribution at given domain. The private key is PEM encoded
+// in PKCS #1 or PKCS #8.
+func NewCloudFrontSigner(domain, keyPairId, privateKey string) (*CloudFrontSigner, error) {
+	if domain == "" || keyPairId == "" {
+		return nil, errors.New("domain and key pair id of cloudfront are required")
+	}
+	key, err := parsePrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &CloudFrontSigner{
+		domain:     strings.TrimSuffix(strings.TrimPrefix(domain, "https://"), "/"),
+		keyPairId:  keyPairId,
+		privateKey: key,
+	}, nil
+}
+
+func (s *CloudFrontSigner) SignGet(key, versionId string, policy Policy) (string, error) {
+	resource := "https://" + s.domain + "/" + escapeKey(key)
+	if versionId != "" {
+		resource += "?" + QUERY_VERSION_ID + "=" + url.QueryEscape(versionId)
+	}
+	statement := cloudFrontStatement{
+		Resource:  resource,
+		Condition: cloudFrontCondition{DateLessThan: epochTime{policy.ExpiresAt.Unix()}},
+	}
+	canned := policy.NotBefore.IsZero() && policy.IpAddress == ""
+	if !policy.NotBefore.IsZero() {
+		statement.Condition.DateGreaterThan = &epochTime{policy.NotBefore.Unix()}
+	}
+	if policy.IpAddress != "" {
+		statement.Condition.IpAddress = &sourceIp{policy.IpAddress}
+	}
+	encoded, err := encodePolicy(cloudFrontPolicy{Statement: []cloudFrontStatement{statement}})
+	if err != nil {
+		return "", err
+	}
+	hash := sha1.Sum(encoded)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.privateKey, crypto.SHA1, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign policy: %v", err)
+	}
+
+	query := []string{}
+	if canned {
+		query = append(query, QUERY_EXPIRES+"="+strconv.FormatInt(policy.ExpiresAt.Unix(), 10))
+	} else {
+		query = append(query, QUERY_POLICY+"="+cloudFrontEncoding.Replace(base64.StdEncoding.EncodeToString(encoded)))
+	}
+	query = append(query,
+		QUERY_SIGNATURE+"="+cloudFrontEncoding.Replace(base64.StdEncoding.EncodeToString(signature)),
+		QUERY_KEY_PAIR_ID+"="+url.QueryEscape(s.keyPairId),
+	)
+	separator := "?"
+	if versionId != "" {
+		separator = "&"
+	}
+	return resource + separator + strings.Join(query, "&"), nil
+}
+
+// the signed policy must not contain whitespace, and the resource is not escaped for html
+func encodePolicy(policy cloudFrontPolicy) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(policy)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func parsePrivateKey(privateKey string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(privateKey))
+	if block == nil {
+		return nil, errors.New("private key of cloudfront is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key of cloudfront: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key of cloudfront is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i := range segments {
+		segments[i] = url.PathEscape(segments[i])
+	}
+	return strings.Join(segments, "/")
+}
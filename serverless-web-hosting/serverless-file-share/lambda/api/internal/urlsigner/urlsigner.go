@@ -0,0 +1,79 @@
+package urlsigner
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/blobstore"
+	appConfig "github.com/unitypark/serverless-file-share/lambda/api/internal/config"
+	"github.com/unitypark/serverless-file-share/lambda/api/internal/secret"
+	"go.uber.org/zap"
+)
+
+// ErrUnsupportedPolicy is returned, if the signer cannot restrict its urls by the conditions of the policy
+var ErrUnsupportedPolicy = errors.New("policy is not supported")
+
+// Policy tells how long and by whom a signed url can be used. The url is valid at once, if NotBefore is zero,
+// and from every address, if IpAddress is empty.
+type Policy struct {
+	ExpiresAt time.Time
+	NotBefore time.Time
+	// ip address or cidr e.g. 192.0.2.0/24
+	IpAddress string
+}
+
+// UrlSigner signs the urls, over which shared files are downloaded
+type UrlSigner interface {
+	SignGet(key, versionId string, policy Policy) (string, error)
+}
+
+// New returns the signer of the configuration. Urls are presigned by the blob store, unless they are signed
+// for cloudfront with a key pair, whose private key is configured or stored in secrets manager.
+func New(config *appConfig.Config, blobStore blobstore.BlobStore) UrlSigner {
+	if config.DownloadSigner != appConfig.SignerCloudFront {
+		return NewPresigner(blobStore)
+	}
+	privateKey, err := secret.Resolve(context.TODO(), config.CloudFrontPrivateKey, config.CloudFrontPrivateKeySecret)
+	if err != nil {
+		zap.L().Panic("failed to read private key of cloudfront", zap.Error(err))
+	}
+	signer, err := NewCloudFrontSigner(config.CloudFrontDomain, config.CloudFrontKeyPairId, privateKey)
+	if err != nil {
+		zap.L().Panic("failed to create cloudfront signer", zap.Error(err))
+	}
+	zap.L().Info("signing downloads for cloudfront", zap.String("domain", config.CloudFrontDomain))
+	return signer
+}
+
+// ParseIpAddress returns given ip address or cidr as cidr
+func ParseIpAddress(value string) (string, error) {
+	if ip := net.ParseIP(value); ip != nil {
+		if ip.To4() != nil {
+			return ip.String() + "/32", nil
+		}
+		return ip.String() + "/128", nil
+	}
+	_, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return "", err
+	}
+	return network.String(), nil
+}
+
+// presigner signs the urls of the blob store, which are restricted by their expiry only
+type presigner struct {
+	blobStore blobstore.BlobStore
+}
+
+func NewPresigner(blobStore blobstore.BlobStore) UrlSigner {
+	return &presigner{blobStore: blobStore}
+}
+
+func (p *presigner) SignGet(key, versionId string, policy Policy) (string, error) {
+	if !policy.NotBefore.IsZero() || policy.IpAddress != "" {
+		return "", ErrUnsupportedPolicy
+	}
+	return p.blobStore.PresignGetVersion(key, versionId, time.Until(policy.ExpiresAt))
+}
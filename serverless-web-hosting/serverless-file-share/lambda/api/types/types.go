@@ -3,11 +3,103 @@ package types
 import "time"
 
 const (
-	PK                    string = "PK"
-	SK                    string = "SK"
-	ATTRIBUTE_TYPE        string = "Type"
-	ATTRIBUTE_ACCESS_KEY  string = "AccessKey"
-	ATTRIBUTE_ACCESSED_BY string = "AccessedBy"
-	ATTRIBUTE_ACCESSED_AT string = "AccessedAt"
-	TIME_FORMAT           string = time.RFC3339
+	PK                        string = "PK"
+	SK                        string = "SK"
+	ATTRIBUTE_TYPE            string = "Type"
+	ATTRIBUTE_ACCESS_KEY      string = "AccessKey"
+	ATTRIBUTE_ACCESSED_BY     string = "AccessedBy"
+	ATTRIBUTE_ACCESSED_AT     string = "AccessedAt"
+	ATTRIBUTE_STATE           string = "State"
+	ATTRIBUTE_PARTS           string = "Parts"
+	ATTRIBUTE_PATH            string = "Path"
+	ATTRIBUTE_EXPIRING_AT     string = "ExpiringAt"
+	ATTRIBUTE_DOWNLOAD_COUNT  string = "DownloadCount"
+	ATTRIBUTE_MAX_DOWNLOADS   string = "MaxDownloads"
+	ATTRIBUTE_CREATED_BY      string = "CreatedBy"
+	ATTRIBUTE_REVOKED_AT      string = "RevokedAt"
+	ATTRIBUTE_FAILED_ATTEMPTS string = "FailedAttempts"
+	ATTRIBUTE_LOCKED_UNTIL    string = "LockedUntil"
+	ATTRIBUTE_FILE_SIZE       string = "FileSize"
+	ATTRIBUTE_CONTENT_TYPE    string = "ContentType"
+	ATTRIBUTE_SHA256          string = "Sha256"
+	ATTRIBUTE_UPLOADED_BY     string = "UploadedBy"
+	ATTRIBUTE_PROCESSED_AT    string = "ProcessedAt"
+	ATTRIBUTE_RESERVED_BYTES  string = "ReservedBytes"
+	ATTRIBUTE_RESERVED_AT     string = "ReservedAt"
+	ATTRIBUTE_SCAN_RESULT     string = "ScanResult"
+	ATTRIBUTE_USERNAME        string = "Username"
+	ATTRIBUTE_USED_BYTES      string = "UsedBytes"
+	ATTRIBUTE_QUOTA           string = "Quota"
+	ATTRIBUTE_UPDATED_AT      string = "UpdatedAt"
+	ATTRIBUTE_TTL             string = "TTL"
+	ATTRIBUTE_VERSION_ID      string = "VersionId"
+	ATTRIBUTE_QUARANTINED     string = "QuarantinedVersions"
+	ATTRIBUTE_CONSUMED_AT     string = "ConsumedAt"
+	ATTRIBUTE_OBJECT_DELETED  string = "ObjectDeletedAt"
+	ATTRIBUTE_PREVIEW_PATH    string = "PreviewPath"
+	ATTRIBUTE_TOKENS          string = "Tokens"
+	ATTRIBUTE_REFILLED_AT     string = "RefilledAt"
+	PATH_INDEX                string = "PathIndex"
+	CREATED_BY_INDEX          string = "CreatedByIndex"
+	ACCESS_INDEX              string = "AccessIndex"
+	TIME_FORMAT               string = time.RFC3339
+)
+
+// item types stored in the Type attribute of the table
+const (
+	TYPE_UPLOAD string = "UPLOAD"
+	TYPE_SHARE  string = "SHARE"
+	TYPE_ACCESS string = "ACCESS"
+	TYPE_FILE   string = "FILE"
+	TYPE_USAGE  string = "USAGE"
+	TYPE_RATE   string = "RATE"
+)
+
+// key prefixes of the items in the table
+const (
+	UPLOAD_PREFIX string = "UPLOAD#"
+	KEY_PREFIX    string = "KEY#"
+	ACCESS_PREFIX string = "ACCESS#"
+	FILE_PREFIX   string = "FILE#"
+	USAGE_PREFIX  string = "USER#"
+	RATE_PREFIX   string = "RATE#"
+)
+
+// states of a multipart upload
+const (
+	STATE_IN_PROGRESS string = "IN_PROGRESS"
+	STATE_COMPLETED   string = "COMPLETED"
+	STATE_ABORTED     string = "ABORTED"
+)
+
+// states of a file in the bucket
+const (
+	STATE_UPLOADING   string = "UPLOADING"
+	STATE_AVAILABLE   string = "AVAILABLE"
+	STATE_QUARANTINED string = "QUARANTINED"
+)
+
+// states of a share
+const (
+	STATE_PREPARING string = "PREPARING"
+	STATE_ACTIVE    string = "ACTIVE"
+	STATE_REVOKED   string = "REVOKED"
+	STATE_FAILED    string = "FAILED"
+	// one-time shares are consumed by their first download
+	STATE_CONSUMED string = "CONSUMED"
+)
+
+// archives of shared folders are stored under this prefix of the bucket
+const ARCHIVE_PREFIX string = "archives/"
+
+// previews of shared files are generated by the processor under this prefix of the bucket
+const PREVIEW_PREFIX string = "previews/"
+
+// every user, who is not an admin, up- and downloads only files under users/<username>/
+const USER_PREFIX string = "users/"
+
+// roles of the users, which are given by the authorizer
+const (
+	ROLE_ADMIN string = "admin"
+	ROLE_USER  string = "user"
 )
@@ -48,7 +48,7 @@ function DownloaderForm() {
     e.preventDefault();
     setBackendLoading(true);
     await apiClient
-      .get(`/api/downloads/${downloadKey}?id=${appContext.username}`)
+      .get(`/api/downloads/${downloadKey}`)
       .then((resp) => resp.data)
       .then((res) => {
         axios({
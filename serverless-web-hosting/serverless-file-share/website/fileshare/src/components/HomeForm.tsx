@@ -34,19 +34,24 @@ function AdminForm() {
     setBackendLoading(true);
 
     let unixTimestampInSeconds = Math.floor(Date.now() / 1000)
-    let path = `${appContext.username}/${unixTimestampInSeconds}/${files[0].name}`.replace(/\s/g, "").toLowerCase();
-
-    const postUploadsRes = await apiClient.post(`/api/uploads`, { username: appContext.username, path: path })
-    // PUT request: upload file to S3
-    const result = await fetch(postUploadsRes.data.data.url, {
-      method: "PUT",
-      body: files[0],
+    let path = `users/${appContext.username}/${unixTimestampInSeconds}/${files[0].name.replace(/\s/g, "").toLowerCase()}`;
+
+    const contentType = files[0].type || "application/octet-stream";
+    const postUploadsRes = await apiClient.post(`/api/uploads`, { path: path, size: files[0].size, contentType: contentType })
+    // POST request: upload file to S3 with the fields of the presigned post, the file must be the last field
+    const upload = postUploadsRes.data.data;
+    const form = new FormData();
+    Object.entries<string>(upload.fields).forEach(([name, value]) => form.append(name, value));
+    form.append("file", files[0]);
+    const result = await fetch(upload.url, {
+      method: "POST",
+      body: form,
     });
 
     setFileName(files[0].name);
-    if (result.status === 200) {
+    if (result.ok) {
       await apiClient
-        .post(`/api/downloads`, { username: appContext.username, path: path })
+        .post(`/api/downloads`, { path: path })
         .then((resp) => resp.data)
         .then((res) => {
           setResponse(res.data);